@@ -0,0 +1,71 @@
+// Command breachfilter builds the bloom filter the service loads with
+// password.breach.file from a HIBP-style SHA-1 hash list.
+//
+// The list is read twice: once to count its hashes and size the filter,
+// once to fill it.
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/LockMessage/sso/internal/infrastructure/breach"
+)
+
+func main() {
+	var inPath, outPath string
+	var falsePositiveRate float64
+
+	flag.StringVar(&inPath, "in", "", "path to the hash list, one hex SHA-1[:count] per line")
+	flag.StringVar(&outPath, "out", "", "path the bloom filter is written to")
+	flag.Float64Var(&falsePositiveRate, "fp-rate", 0.001, "share of unbreached passwords the filter may wrongly report")
+	flag.Parse()
+
+	if inPath == "" {
+		panic("in is required")
+	}
+	if outPath == "" {
+		panic("out is required")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		panic("fp-rate must be between 0 and 1")
+	}
+
+	var count uint64
+	if err := scan(inPath, func([sha1.Size]byte) { count++ }); err != nil {
+		panic(err)
+	}
+	filter := breach.NewFilter(count, falsePositiveRate)
+	if err := scan(inPath, filter.Add); err != nil {
+		panic(err)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		panic(err)
+	}
+	w := bufio.NewWriter(out)
+	size, err := filter.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("added %d hashes, wrote %d bytes\n", count, size)
+}
+
+func scan(path string, fn func([sha1.Size]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return breach.ScanHashes(bufio.NewReader(f), fn)
+}
@@ -0,0 +1,166 @@
+// Command importer bulk-loads users exported from a legacy system.
+//
+// Records are read from a CSV file with a header row or from JSON lines,
+// with the fields email, username, display_name, password_hash,
+// hash_algorithm and email_verified. Password hashes are stored as they
+// are and upgraded to argon2id on each user's first successful login.
+// Users whose email or username is already taken are skipped.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+	"github.com/LockMessage/sso/internal/repository/postgres"
+)
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "importer: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run imports the file named by args, printing a summary to stdout and the
+// rejected records to stderr.
+func run(args []string, stdout, stderr io.Writer) error {
+	var databaseURL, filePath, format, pepperFile string
+	var batchSize, appID int
+	var stripPlusTag bool
+
+	flags := flag.NewFlagSet("importer", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&databaseURL, "database-url", "", "PostgreSQL database connection URL")
+	flags.StringVar(&filePath, "file", "", "path to the CSV or JSONL file to import")
+	flags.StringVar(&format, "format", "", "csv or jsonl; guessed from the file extension when empty")
+	flags.IntVar(&appID, "app-id", 0, "app the imported users are enrolled in; 0 enrolls them nowhere")
+	flags.IntVar(&batchSize, "batch-size", 1000, "number of users inserted per round trip")
+	flags.BoolVar(&stripPlusTag, "strip-plus-tag", false, "must match the email.strip_plus_tag setting of the service")
+	flags.StringVar(&pepperFile, "pepper-file", os.Getenv("PASSWORD_PEPPER_FILE"), "must match the password.pepper.file setting of the service")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if databaseURL == "" {
+		return errors.New("database-url is required")
+	}
+	if filePath == "" {
+		return errors.New("file is required")
+	}
+	if batchSize <= 0 {
+		return errors.New("batch-size must be positive")
+	}
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(filePath), ".")
+	}
+
+	c := checks{emailPolicy: validation.EmailPolicy{StripPlusTag: stripPlusTag}}
+	peppers, err := loadPeppers(pepperFile)
+	if err != nil {
+		return err
+	}
+	c.peppers = peppers
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := newReader(format, f)
+	if err != nil {
+		return err
+	}
+
+	storage, err := postgres.New(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	stats, err := importUsers(context.Background(), storage, records, c, appID, batchSize, stderr)
+	fmt.Fprintf(stdout, "read %d, rejected %d, imported %d, skipped as duplicates %d\n",
+		stats.read, stats.rejected, stats.imported, stats.read-stats.rejected-stats.imported)
+	return err
+}
+
+// loadPeppers reads the peppers the service is configured with, from
+// PASSWORD_PEPPERS and the pepper file, like the service does.
+func loadPeppers(file string) ([]passhash.Pepper, error) {
+	defs := os.Getenv("PASSWORD_PEPPERS")
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pepper file: %w", err)
+		}
+		defs += "\n" + string(data)
+	}
+	return passhash.ParsePeppers(defs)
+}
+
+type importer interface {
+	ImportUsers(ctx context.Context, users []models.User, appID int) (int64, error)
+}
+
+type importStats struct {
+	read, rejected, imported int64
+}
+
+// importUsers streams records into storage in batches of batchSize, enrolling
+// the users in appID. Invalid records are reported on report, one line each,
+// and skipped.
+func importUsers(ctx context.Context, storage importer, records recordReader, c checks, appID, batchSize int, report io.Writer) (importStats, error) {
+	var stats importStats
+	batch := make([]models.User, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		inserted, err := storage.ImportUsers(ctx, batch, appID)
+		stats.imported += inserted
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		rec, err := records.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		stats.read++
+		var recErr *recordError
+		if err != nil && !errors.As(err, &recErr) {
+			return stats, err
+		}
+		if err == nil {
+			var user models.User
+			if user, err = rec.toUser(c); err == nil {
+				batch = append(batch, user)
+			}
+		}
+		if err != nil {
+			stats.rejected++
+			fmt.Fprintf(report, "record %d: %v\n", stats.read, err)
+			continue
+		}
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	return stats, flush()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+// fakeImporter stores users in memory, skipping emails it already has.
+type fakeImporter struct {
+	batches int
+	appIDs  []int
+	emails  map[string]bool
+}
+
+func (f *fakeImporter) ImportUsers(_ context.Context, users []models.User, appID int) (int64, error) {
+	f.batches++
+	f.appIDs = append(f.appIDs, appID)
+	var inserted int64
+	for _, user := range users {
+		if !f.emails[user.EmailCanonical] {
+			f.emails[user.EmailCanonical] = true
+			inserted++
+		}
+	}
+	return inserted, nil
+}
+
+func TestImportUsers(t *testing.T) {
+	const hash = "salt$3b71f43ff30f4b15b5cd85dd9e95ebc7e84eb5a3"
+	input := "email,username,password_hash,hash_algorithm\n" +
+		"bob@example.com,bob," + hash + ",sha1-salted\n" +
+		"not an email,," + hash + ",sha1-salted\n" +
+		"eve@example.com,eve,salt$nothex,sha1-salted\n" +
+		"Bob@Example.com,," + hash + ",sha1-salted\n" +
+		"carol@example.com,carol," + hash + ",md5\n" +
+		"frank@example.com,frank,\"$argon2id$v=19$m=64,t=1,p=1,keyid=3$c2FsdA$a2V5\",argon2id\n" +
+		"dave@example.com,dave," + hash + ",sha1-salted\n"
+	records, err := newReader("csv", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &fakeImporter{emails: map[string]bool{}}
+	var report strings.Builder
+
+	stats, err := importUsers(context.Background(), storage, records, checks{}, 7, 2, &report)
+	if err != nil {
+		t.Fatalf("importUsers() error = %v", err)
+	}
+	want := importStats{read: 7, rejected: 4, imported: 2}
+	if stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+	if storage.batches != 2 || !slices.Equal(storage.appIDs, []int{7, 7}) {
+		t.Errorf("batches = %d for apps %v, want 2 for app 7", storage.batches, storage.appIDs)
+	}
+
+	// Each rejected record is reported on its own line with its position.
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("report = %q, want 4 lines", report.String())
+	}
+	for i, prefix := range []string{"record 2: ", "record 3: password hash: ", "record 5: password hash: ", "record 6: password hash: unknown pepper"} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("report line %d = %q, want prefix %q", i+1, lines[i], prefix)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+)
+
+// record is one user as exported by the legacy system.
+type record struct {
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	PasswordHash  string `json:"password_hash"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// checks are the settings of the service that records must agree with.
+type checks struct {
+	emailPolicy validation.EmailPolicy
+	// peppers are those the service runs with. Peppered hashes need theirs.
+	peppers []passhash.Pepper
+}
+
+// toUser validates the record and turns it into a user ready to be stored.
+func (r record) toUser(c checks) (models.User, error) {
+	email, err := validation.NormalizeEmail(r.Email)
+	if err != nil {
+		return models.User{}, fmt.Errorf("email %q: %w", r.Email, err)
+	}
+	if err := validation.ValidateEmail(email); err != nil {
+		return models.User{}, fmt.Errorf("email %q: %w", r.Email, err)
+	}
+	username := validation.NormalizeUsername(r.Username)
+	if username != "" {
+		if err := validation.ValidateUsername(username); err != nil {
+			return models.User{}, fmt.Errorf("username %q: %w", r.Username, err)
+		}
+	}
+	if err := validation.ValidateDisplayName(r.DisplayName); err != nil {
+		return models.User{}, fmt.Errorf("display name: %w", err)
+	}
+	algo := models.PasswordAlgorithm(r.HashAlgorithm)
+	if err := passhash.ValidatePeppered(algo, []byte(r.PasswordHash), c.peppers); err != nil {
+		return models.User{}, fmt.Errorf("password hash: %w", err)
+	}
+	status := models.StatusPendingVerification
+	if r.EmailVerified {
+		status = models.StatusActive
+	}
+	return models.User{
+		Email:          email,
+		EmailCanonical: validation.CanonicalEmail(email, c.emailPolicy),
+		Username:       username,
+		DisplayName:    r.DisplayName,
+		PassHash:       []byte(r.PasswordHash),
+		PassAlgo:       algo,
+		Status:         status,
+		EmailVerified:  r.EmailVerified,
+	}, nil
+}
+
+// recordReader yields records until io.EOF. Problems with a single record
+// are reported as *recordError and reading can go on; any other error is fatal.
+type recordReader interface {
+	Next() (record, error)
+}
+
+// recordError is a record that could not be decoded.
+type recordError struct {
+	err error
+}
+
+func (e *recordError) Error() string { return e.err.Error() }
+
+func (e *recordError) Unwrap() error { return e.err }
+
+func newReader(format string, r io.Reader) (recordReader, error) {
+	switch format {
+	case "csv":
+		return newCSVReader(r)
+	case "jsonl":
+		return &jsonlReader{scanner: bufio.NewScanner(r)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+}
+
+func (j *jsonlReader) Next() (record, error) {
+	for j.scanner.Scan() {
+		if len(j.scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(j.scanner.Bytes(), &rec); err != nil {
+			return record{}, &recordError{err: err}
+		}
+		return rec, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return record{}, err
+	}
+	return record{}, io.EOF
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, required := range []string{"email", "password_hash", "hash_algorithm"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("header lacks the %q column", required)
+		}
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (record, error) {
+	row, err := c.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return record{}, &recordError{err: err}
+		}
+		return record{}, err
+	}
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	rec := record{
+		Email:         field("email"),
+		Username:      field("username"),
+		DisplayName:   field("display_name"),
+		PasswordHash:  field("password_hash"),
+		HashAlgorithm: field("hash_algorithm"),
+	}
+	if verified := field("email_verified"); verified != "" {
+		if rec.EmailVerified, err = strconv.ParseBool(verified); err != nil {
+			return record{}, &recordError{err: fmt.Errorf("email_verified: %w", err)}
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readAll drains r, collecting the records and the per-record errors it
+// reports, until io.EOF or a fatal error.
+func readAll(r recordReader) (records []record, rowErrs int, err error) {
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records, rowErrs, nil
+		}
+		var recErr *recordError
+		if errors.As(err, &recErr) {
+			rowErrs++
+			continue
+		}
+		if err != nil {
+			return records, rowErrs, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	bob := record{
+		Email:         "bob@example.com",
+		Username:      "bob",
+		DisplayName:   "Bob",
+		PasswordHash:  "salt$hash",
+		HashAlgorithm: "sha1-salted",
+		EmailVerified: true,
+	}
+	eve := record{Email: "eve@example.com", PasswordHash: "salt$hash", HashAlgorithm: "sha1-salted"}
+
+	tests := []struct {
+		name       string
+		format     string
+		input      string
+		want       []record
+		rowErrs    int
+		wantNewErr bool
+	}{
+		{
+			name:   "csv",
+			format: "csv",
+			input: "email,username,display_name,password_hash,hash_algorithm,email_verified\n" +
+				"bob@example.com,bob,Bob,salt$hash,sha1-salted,true\n" +
+				"eve@example.com,,,salt$hash,sha1-salted,\n",
+			want: []record{bob, eve},
+		},
+		{
+			name:   "csv columns in any order, optional ones missing",
+			format: "csv",
+			input:  "hash_algorithm,password_hash,email\nsha1-salted,salt$hash,eve@example.com\n",
+			want:   []record{eve},
+		},
+		{
+			name:   "csv row with a bad email_verified is skipped",
+			format: "csv",
+			input: "email,password_hash,hash_algorithm,email_verified\n" +
+				"bob@example.com,salt$hash,sha1-salted,maybe\n" +
+				"eve@example.com,salt$hash,sha1-salted,false\n",
+			want:    []record{eve},
+			rowErrs: 1,
+		},
+		{
+			name:   "csv row with the wrong number of fields is skipped",
+			format: "csv",
+			input: "email,password_hash,hash_algorithm\n" +
+				"bob@example.com,salt$hash\n" +
+				"eve@example.com,salt$hash,sha1-salted\n",
+			want:    []record{eve},
+			rowErrs: 1,
+		},
+		{
+			name:       "csv header without a required column",
+			format:     "csv",
+			input:      "email,password_hash\nbob@example.com,salt$hash\n",
+			wantNewErr: true,
+		},
+		{
+			name:   "jsonl",
+			format: "jsonl",
+			input: `{"email":"bob@example.com","username":"bob","display_name":"Bob","password_hash":"salt$hash","hash_algorithm":"sha1-salted","email_verified":true}` + "\n\n" +
+				`{"email":"eve@example.com","password_hash":"salt$hash","hash_algorithm":"sha1-salted"}`,
+			want: []record{bob, eve},
+		},
+		{
+			name:   "jsonl line that is not JSON is skipped",
+			format: "jsonl",
+			input: "{\"email\":\n" +
+				`{"email":"eve@example.com","password_hash":"salt$hash","hash_algorithm":"sha1-salted"}` + "\n",
+			want:    []record{eve},
+			rowErrs: 1,
+		},
+		{
+			name:       "unknown format",
+			format:     "xml",
+			input:      "<users/>",
+			wantNewErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newReader(tt.format, strings.NewReader(tt.input))
+			if tt.wantNewErr {
+				if err == nil {
+					t.Fatal("newReader() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newReader() error = %v", err)
+			}
+			got, rowErrs, err := readAll(r)
+			if err != nil {
+				t.Fatalf("Next() fatal error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %+v, want %+v", got, tt.want)
+			}
+			if rowErrs != tt.rowErrs {
+				t.Errorf("record errors = %d, want %d", rowErrs, tt.rowErrs)
+			}
+		})
+	}
+}
@@ -24,7 +24,7 @@ func main() {
 		slog.Any("cfg", cfg),
 		slog.Int("port", cfg.GRPC.Port),
 	)
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL, cfg.TokenRef)
+	application := app.New(log, cfg)
 	go application.MustRun()
 
 	stop := make(chan os.Signal, 1)
@@ -4,11 +4,20 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
-	"time"
+	"os"
 
+	"github.com/LockMessage/sso/internal/config"
 	"github.com/LockMessage/sso/internal/deliver/grpc/server"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/breach"
 	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/mailer"
+	"github.com/LockMessage/sso/internal/infrastructure/onetime"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+	"github.com/LockMessage/sso/internal/infrastructure/sealer"
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn"
 	"github.com/LockMessage/sso/internal/repository/postgres"
+	"github.com/LockMessage/sso/internal/usecase/admin"
 	"github.com/LockMessage/sso/internal/usecase/auth"
 	"google.golang.org/grpc"
 )
@@ -17,18 +26,162 @@ type App struct {
 	log        *slog.Logger
 	gRPCServer *grpc.Server
 	port       int
+	purge      *purgeJob
 }
 
-func New(log *slog.Logger, grpcPort int, storagePath string, tokenTTL, refTokenTTL time.Duration) *App {
+func New(log *slog.Logger, cfg *config.Config) *App {
 	gRPCSever := grpc.NewServer()
-	storage, err := postgres.New(storagePath)
-	jwtAdapter := jwt.New(tokenTTL, refTokenTTL)
+	storage, err := postgres.New(cfg.StoragePath)
+	if err != nil {
+		panic(err)
+	}
+	jwtAdapter := jwt.New(cfg.TokenTTL, cfg.TokenRef)
+	mail, err := newMailer(log, cfg.Mailer)
+	if err != nil {
+		panic(err)
+	}
+	peppers, err := loadPeppers(log, cfg.Password.Pepper)
+	if err != nil {
+		panic(err)
+	}
+	argon2Params := passhash.Argon2Params{
+		Memory:      cfg.Password.Argon2.Memory,
+		Time:        cfg.Password.Argon2.Time,
+		Parallelism: cfg.Password.Argon2.Parallelism,
+	}
+	if err := argon2Params.Validate(); err != nil {
+		panic(err)
+	}
+	hasher := passhash.New(argon2Params, peppers)
+	breaches, err := newBreachChecker(log, cfg.Password.Breach)
+	if err != nil {
+		panic(err)
+	}
+	mfaSealer, err := newSealer(log, cfg.MFA)
+	if err != nil {
+		panic(err)
+	}
+	authService, err := auth.New(log, storage, storage, storage, jwtAdapter, hasher, breaches, mfaSealer,
+		storage, storage, storage, storage, storage, storage, onetime.New(cfg.Codes.Secret), mail,
+		auth.Config{
+			VerificationTTL:     cfg.Codes.VerificationTTL,
+			PasswordResetTTL:    cfg.Codes.PasswordResetTTL,
+			EmailChangeTTL:      cfg.Codes.EmailChangeTTL,
+			EmailChangeUndoTTL:  cfg.Codes.EmailChangeUndoTTL,
+			InvitationTTL:       cfg.Codes.InvitationTTL,
+			DeletionGracePeriod: cfg.Deletion.GracePeriod,
+			EmailPolicy:         validation.EmailPolicy{StripPlusTag: cfg.Email.StripPlusTag},
+			PasswordPolicy: validation.PasswordPolicy{
+				MinLength:     cfg.Password.Policy.MinLength,
+				MaxLength:     cfg.Password.Policy.MaxLength,
+				RequireUpper:  cfg.Password.Policy.RequireUpper,
+				RequireLower:  cfg.Password.Policy.RequireLower,
+				RequireDigit:  cfg.Password.Policy.RequireDigit,
+				RequireSymbol: cfg.Password.Policy.RequireSymbol,
+				BannedWords:   cfg.Password.Policy.BannedWords,
+				MinEntropy:    cfg.Password.Policy.MinEntropy,
+			},
+			PasswordMaxAge: auth.PasswordMaxAge{
+				Admin: cfg.Password.MaxAge.Admin,
+				User:  cfg.Password.MaxAge.User,
+			},
+			PasswordChangeTokenTTL:       cfg.Password.ChangeTokenTTL,
+			PasswordHistorySize:          cfg.Password.HistorySize,
+			FlagBreachedPasswords:        cfg.Password.Breach.Action == "flag",
+			ConcealRegistrationConflicts: cfg.Registration.ConcealConflicts,
+			MFAIssuer:                    cfg.MFA.Issuer,
+			MFAChallengeTTL:              cfg.MFA.ChallengeTTL,
+			MFAMaxFailures:               cfg.MFA.MaxFailures,
+			MFALockout:                   cfg.MFA.Lockout,
+			RelyingParty: webauthn.RelyingParty{
+				ID:                      cfg.WebAuthn.RPID,
+				Name:                    cfg.WebAuthn.RPName,
+				Origins:                 cfg.WebAuthn.Origins,
+				RequireUserVerification: cfg.WebAuthn.RequireUserVerification,
+			},
+			PasskeyChallengeTTL: cfg.WebAuthn.ChallengeTTL,
+			SessionTTL:          cfg.TokenRef,
+			PublicURL:           cfg.PublicURL,
+		},
+	)
 	if err != nil {
 		panic(err)
 	}
-	authService := auth.New(log, storage, storage, storage, jwtAdapter)
 	server.Register(gRPCSever, authService)
-	return &App{log: log, gRPCServer: gRPCSever, port: grpcPort}
+	server.RegisterAdmin(gRPCSever, admin.New(log, authService, storage, storage, storage, storage, storage))
+	return &App{
+		log:        log,
+		gRPCServer: gRPCSever,
+		port:       cfg.GRPC.Port,
+		purge:      newPurgeJob(log, authService, cfg.Deletion.PurgeInterval),
+	}
+}
+
+func newMailer(log *slog.Logger, cfg config.MailerConfig) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return mailer.NewLogMailer(log, cfg.From), nil
+	case "file":
+		return mailer.NewFileMailer(cfg.DropDir, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Driver)
+	}
+}
+
+func loadPeppers(log *slog.Logger, cfg config.PepperConfig) ([]passhash.Pepper, error) {
+	defs := cfg.Keys
+	if cfg.File != "" {
+		data, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pepper file: %w", err)
+		}
+		defs += "\n" + string(data)
+	}
+	peppers, err := passhash.ParsePeppers(defs)
+	if err != nil {
+		return nil, err
+	}
+	if len(peppers) == 0 {
+		log.Warn("no password pepper configured")
+	}
+	return peppers, nil
+}
+
+func newSealer(log *slog.Logger, cfg config.MFAConfig) (auth.SecretSealer, error) {
+	raw := cfg.Key
+	if raw == "" && cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mfa key file: %w", err)
+		}
+		raw = string(data)
+	}
+	if raw == "" {
+		log.Warn("no mfa encryption key configured, mfa is unavailable")
+		return sealer.Disabled{}, nil
+	}
+	key, err := sealer.ParseKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return sealer.New(key)
+}
+
+func newBreachChecker(log *slog.Logger, cfg config.BreachConfig) (breach.Checker, error) {
+	switch cfg.Action {
+	case "reject", "flag":
+	default:
+		return nil, fmt.Errorf("unknown breach action %q", cfg.Action)
+	}
+	if cfg.File == "" {
+		return breach.None{}, nil
+	}
+	checker, err := breach.Load(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load breach corpus: %w", err)
+	}
+	log.Info("breach corpus loaded", slog.String("file", cfg.File), slog.String("action", cfg.Action))
+	return checker, nil
 }
 
 func (a *App) MustRun() {
@@ -42,6 +195,7 @@ func (a *App) Run() error {
 	log := a.log.With(slog.String("op", op),
 		slog.Int("port", a.port),
 	)
+	go a.purge.run()
 	log.Info("starting gRPC server")
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
 	if err != nil {
@@ -58,4 +212,5 @@ func (a *App) Stop() {
 	const op = "grpcapp.stop"
 	a.log.With(slog.String("op", op)).Info("stopping gRPC server", slog.Int("port", a.port))
 	a.gRPCServer.GracefulStop()
+	a.purge.shutdown()
 }
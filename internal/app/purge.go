@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type accountPurger interface {
+	PurgeDeletedAccounts(ctx context.Context) (int64, error)
+}
+
+// purgeJob periodically hard-deletes accounts whose deletion grace period
+// has run out.
+type purgeJob struct {
+	log      *slog.Logger
+	purger   accountPurger
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newPurgeJob(log *slog.Logger, purger accountPurger, interval time.Duration) *purgeJob {
+	return &purgeJob{
+		log:      log,
+		purger:   purger,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (j *purgeJob) run() {
+	const op = "purgeJob.run"
+	log := j.log.With(slog.String("op", op))
+	log.Info("starting purge job", slog.Duration("interval", j.interval))
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+		// Errors are logged by the use case; the next tick retries.
+		_, _ = j.purger.PurgeDeletedAccounts(ctx)
+		cancel()
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *purgeJob) shutdown() {
+	close(j.stop)
+	<-j.done
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"flag"
+	"log/slog"
+	"net/url"
 	"os"
 	"time"
 
@@ -9,11 +11,20 @@ import (
 )
 
 type Config struct {
-	Env         string        `yaml:"env" env-default:"local"`
-	StoragePath string        `yaml:"storage_path" env-required:"true"`
-	TokenTTL    time.Duration `yaml:"token_ttl" env-required:"true"`
-	TokenRef    time.Duration `yaml:"token_ref" env-required:"true"`
-	GRPC        GRPCConfig    `yaml:"grpc"`
+	Env          string             `yaml:"env" env-default:"local"`
+	StoragePath  string             `yaml:"storage_path" env-required:"true"`
+	TokenTTL     time.Duration      `yaml:"token_ttl" env-required:"true"`
+	TokenRef     time.Duration      `yaml:"token_ref" env-required:"true"`
+	GRPC         GRPCConfig         `yaml:"grpc"`
+	PublicURL    string             `yaml:"public_url"`
+	Codes        CodesConfig        `yaml:"codes"`
+	Mailer       MailerConfig       `yaml:"mailer"`
+	Deletion     DeletionConfig     `yaml:"deletion"`
+	Email        EmailConfig        `yaml:"email"`
+	Registration RegistrationConfig `yaml:"registration"`
+	Password     PasswordConfig     `yaml:"password"`
+	MFA          MFAConfig          `yaml:"mfa"`
+	WebAuthn     WebAuthnConfig     `yaml:"webauthn"`
 }
 
 type GRPCConfig struct {
@@ -21,6 +32,167 @@ type GRPCConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// CodesConfig configures the single-use codes sent to users by email.
+type CodesConfig struct {
+	Secret             string        `yaml:"secret" env-required:"true"`
+	VerificationTTL    time.Duration `yaml:"verification_ttl" env-default:"24h"`
+	PasswordResetTTL   time.Duration `yaml:"password_reset_ttl" env-default:"30m"`
+	EmailChangeTTL     time.Duration `yaml:"email_change_ttl" env-default:"24h"`
+	EmailChangeUndoTTL time.Duration `yaml:"email_change_undo_ttl" env-default:"168h"`
+	InvitationTTL      time.Duration `yaml:"invitation_ttl" env-default:"168h"`
+}
+
+// MailerConfig selects how outgoing mail is delivered.
+// Driver is either "log" or "file"; the latter drops messages into DropDir.
+type MailerConfig struct {
+	Driver  string `yaml:"driver" env-default:"log"`
+	From    string `yaml:"from" env-default:"no-reply@localhost"`
+	DropDir string `yaml:"drop_dir" env-default:"./mail"`
+}
+
+// DeletionConfig controls how long deleted accounts can be restored
+// and how often expired ones are purged.
+type DeletionConfig struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+}
+
+// EmailConfig is the deployment's policy for comparing email identities.
+type EmailConfig struct {
+	// StripPlusTag treats "bob+tag@x.com" as the same account as "bob@x.com".
+	StripPlusTag bool `yaml:"strip_plus_tag" env-default:"false"`
+}
+
+// RegistrationConfig controls what sign-ups reveal about existing accounts.
+type RegistrationConfig struct {
+	// ConcealConflicts answers registrations of and email changes to taken
+	// emails as if they succeeded and tells the owner of the address by
+	// email instead.
+	ConcealConflicts bool `yaml:"conceal_conflicts" env-default:"false"`
+}
+
+// MFAConfig configures second factors. The key encrypting users' TOTP
+// secrets is a base64 AES-256 key that, like peppers, only comes from a
+// file or the environment. Without one, MFA cannot be enrolled.
+type MFAConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"SSO"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	// MaxFailures wrong codes lock VerifyMFA for Lockout. Zero allows any.
+	MaxFailures int           `yaml:"max_failures" env-default:"5"`
+	Lockout     time.Duration `yaml:"lockout" env-default:"15m"`
+	KeyFile     string        `yaml:"key_file" env:"MFA_ENCRYPTION_KEY_FILE"`
+	Key         string        `yaml:"-" env:"MFA_ENCRYPTION_KEY"`
+}
+
+// WebAuthnConfig is the relying party passkeys are bound to. Passkeys are
+// disabled while RPID is empty.
+type WebAuthnConfig struct {
+	// RPID is the domain passkeys are scoped to, e.g. "example.com".
+	RPID string `yaml:"rp_id" env:"WEBAUTHN_RP_ID"`
+	// RPName is shown by authenticators when creating a passkey.
+	RPName string `yaml:"rp_name" env-default:"SSO"`
+	// Origins are the web origins the apps run ceremonies on; they must be
+	// RPID or its subdomains.
+	Origins []string `yaml:"origins" env:"WEBAUTHN_ORIGINS" env-separator:","`
+	// RequireUserVerification makes a passkey a full login on its own.
+	// Without it, users with a second factor are asked for their code too.
+	RequireUserVerification bool          `yaml:"require_user_verification" env-default:"true"`
+	ChallengeTTL            time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+// PasswordConfig tunes how passwords are hashed and which ones users may choose.
+type PasswordConfig struct {
+	Argon2 Argon2Config         `yaml:"argon2"`
+	Pepper PepperConfig         `yaml:"pepper"`
+	Policy PasswordPolicyConfig `yaml:"policy"`
+	Breach BreachConfig         `yaml:"breach"`
+	MaxAge PasswordMaxAgeConfig `yaml:"max_age"`
+	// ChangeTokenTTL is how long the token issued for an expired password
+	// can be used to change it.
+	ChangeTokenTTL time.Duration `yaml:"change_token_ttl" env-default:"10m"`
+	// HistorySize is how many of a user's last passwords, the current one
+	// included, cannot be chosen again. Zero allows any.
+	HistorySize int `yaml:"history_size" env-default:"0"`
+}
+
+// PepperConfig locates the pepper secrets, one "<version>:<base64 secret>"
+// per line or comma-separated. They only come from a file or the
+// environment, never from the config file or the database.
+type PepperConfig struct {
+	File string `yaml:"file" env:"PASSWORD_PEPPER_FILE"`
+	Keys string `yaml:"-" env:"PASSWORD_PEPPERS"`
+}
+
+// PasswordMaxAgeConfig sets how long passwords stay valid, per role.
+// Zero durations never expire.
+type PasswordMaxAgeConfig struct {
+	Admin time.Duration `yaml:"admin" env-default:"2160h"`
+	User  time.Duration `yaml:"user" env-default:"0"`
+}
+
+// BreachConfig screens new passwords against a local breach corpus.
+type BreachConfig struct {
+	// File is a HIBP-style SHA-1 hash list or a bloom filter built by
+	// cmd/breachfilter. Screening is off when it is empty.
+	File string `yaml:"file"`
+	// Action is "reject" to refuse breached passwords or "flag" to accept
+	// them and flag the user.
+	Action string `yaml:"action" env-default:"reject"`
+}
+
+// PasswordPolicyConfig sets the rules new passwords must follow. Zero
+// lengths and entropy disable the corresponding rule.
+type PasswordPolicyConfig struct {
+	MinLength     int      `yaml:"min_length" env-default:"8"`
+	MaxLength     int      `yaml:"max_length" env-default:"128"`
+	RequireUpper  bool     `yaml:"require_upper" env-default:"false"`
+	RequireLower  bool     `yaml:"require_lower" env-default:"false"`
+	RequireDigit  bool     `yaml:"require_digit" env-default:"false"`
+	RequireSymbol bool     `yaml:"require_symbol" env-default:"false"`
+	BannedWords   []string `yaml:"banned_words"`
+	// MinEntropy is in bits, as estimated by validation.PasswordEntropy.
+	MinEntropy float64 `yaml:"min_entropy" env-default:"0"`
+}
+
+// Argon2Config holds the argon2id cost parameters. Memory is in KiB.
+// Existing hashes made with lower costs are upgraded on login.
+type Argon2Config struct {
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Time        uint32 `yaml:"time" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+}
+
+// redacted replaces secrets in logged configs.
+const redacted = "[REDACTED]"
+
+// LogValue logs the config without its secrets: the database password,
+// the code secret, the password peppers and the MFA key.
+func (c *Config) LogValue() slog.Value {
+	safe := *c
+	safe.StoragePath = redactURL(c.StoragePath)
+	safe.Codes.Secret = redact(c.Codes.Secret)
+	safe.Password.Pepper.Keys = redact(c.Password.Pepper.Keys)
+	safe.MFA.Key = redact(c.MFA.Key)
+	return slog.AnyValue(safe)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURL masks the password of a connection URL, or all of it when it
+// cannot be parsed.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redact(rawURL)
+	}
+	return u.Redacted()
+}
+
 func MustLoad() *Config {
 	path := fetchConfigPath()
 	if path == "" {
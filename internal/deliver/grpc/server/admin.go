@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	ssov1 "github.com/LockMessage/protos/golang/sso"
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Admin interface {
+	ListUsers(ctx context.Context, req models.ListUsersRequest) (models.UserPage, error)
+	GetUser(ctx context.Context, req models.AdminUserRequest) (models.User, error)
+	DisableUser(ctx context.Context, req models.AdminUserRequest) (models.User, error)
+	EnableUser(ctx context.Context, req models.AdminUserRequest) (models.User, error)
+	SetAdmin(ctx context.Context, req models.SetAdminRequest) (models.User, error)
+	GrantMembership(ctx context.Context, req models.MembershipRequest) error
+	RevokeMembership(ctx context.Context, req models.MembershipRequest) error
+	SetRegistrationPolicy(ctx context.Context, req models.SetRegistrationPolicyRequest) error
+}
+
+type adminAPI struct {
+	ssov1.UnimplementedAdminServer
+	admin Admin
+}
+
+func RegisterAdmin(gRPC *grpc.Server, admin Admin) {
+	ssov1.RegisterAdminServer(gRPC, &adminAPI{admin: admin})
+}
+
+func (s *adminAPI) ListUsers(ctx context.Context, req *ssov1.ListUsersRequest) (*ssov1.ListUsersResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	filter := models.UserFilter{
+		EmailPrefix: req.GetEmailPrefix(),
+		Status:      models.UserStatus(req.GetStatus()),
+		IsAdmin:     req.IsAdmin,
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, status.Error(codes.InvalidArgument, "unknown status")
+	}
+	if req.GetCreatedAfter() != nil {
+		createdAfter := req.GetCreatedAfter().AsTime()
+		filter.CreatedAfter = &createdAfter
+	}
+	if req.GetCreatedBefore() != nil {
+		createdBefore := req.GetCreatedBefore().AsTime()
+		filter.CreatedBefore = &createdBefore
+	}
+	domainReq := models.ListUsersRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Filter:      filter,
+		Cursor:      req.GetCursor(),
+		PageSize:    int(req.GetPageSize()),
+	}
+	page, err := s.admin.ListUsers(ctx, domainReq)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	users := make([]*ssov1.User, 0, len(page.Users))
+	for _, user := range page.Users {
+		users = append(users, toProtoUser(user))
+	}
+	return &ssov1.ListUsersResponse{Users: users, NextCursor: page.NextCursor}, nil
+}
+
+func (s *adminAPI) GetUser(ctx context.Context, req *ssov1.AdminGetUserRequest) (*ssov1.AdminGetUserResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.AdminUserRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken(), UserID: req.GetUserId()}
+	user, err := s.admin.GetUser(ctx, domainReq)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.AdminGetUserResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *adminAPI) DisableUser(ctx context.Context, req *ssov1.DisableUserRequest) (*ssov1.DisableUserResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.AdminUserRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken(), UserID: req.GetUserId()}
+	user, err := s.admin.DisableUser(ctx, domainReq)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.DisableUserResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *adminAPI) EnableUser(ctx context.Context, req *ssov1.EnableUserRequest) (*ssov1.EnableUserResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.AdminUserRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken(), UserID: req.GetUserId()}
+	user, err := s.admin.EnableUser(ctx, domainReq)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.EnableUserResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *adminAPI) SetAdmin(ctx context.Context, req *ssov1.SetAdminRequest) (*ssov1.SetAdminResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.SetAdminRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		UserID:      req.GetUserId(),
+		IsAdmin:     req.GetIsAdmin(),
+	}
+	user, err := s.admin.SetAdmin(ctx, domainReq)
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.SetAdminResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *adminAPI) GrantMembership(ctx context.Context, req *ssov1.GrantMembershipRequest) (*ssov1.GrantMembershipResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetTargetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "target_app_id is required")
+	}
+	domainReq := models.MembershipRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		UserID:      req.GetUserId(),
+		TargetAppID: req.GetTargetAppId(),
+	}
+	if err := s.admin.GrantMembership(ctx, domainReq); err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.GrantMembershipResponse{}, nil
+}
+
+func (s *adminAPI) RevokeMembership(ctx context.Context, req *ssov1.RevokeMembershipRequest) (*ssov1.RevokeMembershipResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetTargetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "target_app_id is required")
+	}
+	domainReq := models.MembershipRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		UserID:      req.GetUserId(),
+		TargetAppID: req.GetTargetAppId(),
+	}
+	if err := s.admin.RevokeMembership(ctx, domainReq); err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.RevokeMembershipResponse{}, nil
+}
+
+func (s *adminAPI) SetRegistrationPolicy(ctx context.Context, req *ssov1.SetRegistrationPolicyRequest) (*ssov1.SetRegistrationPolicyResponse, error) {
+	if err := validateAdminCall(req.GetAppId(), req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+	if req.GetTargetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "target_app_id is required")
+	}
+	if req.GetPolicy() == "" {
+		return nil, status.Error(codes.InvalidArgument, "policy is required")
+	}
+	domainReq := models.SetRegistrationPolicyRequest{
+		AppID:          req.GetAppId(),
+		AccessToken:    req.GetAccessToken(),
+		TargetAppID:    req.GetTargetAppId(),
+		Policy:         models.RegistrationPolicy(req.GetPolicy()),
+		AllowedDomains: req.GetAllowedDomains(),
+	}
+	if err := s.admin.SetRegistrationPolicy(ctx, domainReq); err != nil {
+		return nil, adminError(err)
+	}
+	return &ssov1.SetRegistrationPolicyResponse{}, nil
+}
+
+// validateAdminCall checks the credentials every admin request carries.
+func validateAdminCall(appID int32, accessToken string) error {
+	if appID == emptyValue {
+		return status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if accessToken == "" {
+		return status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	return nil
+}
+
+func adminError(err error) error {
+	if st := authError(err); st != nil {
+		return st
+	}
+	switch {
+	case errors.Is(err, domain.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, "admin access required")
+	case errors.Is(err, domain.ErrSelfModification):
+		return status.Error(codes.FailedPrecondition, domain.ErrSelfModification.Error())
+	case errors.Is(err, domain.ErrInvitationPending):
+		return status.Error(codes.FailedPrecondition, "invitation is pending, revoke it instead")
+	case errors.Is(err, domain.ErrInvalidRegistrationPolicy):
+		return status.Error(codes.InvalidArgument, "policy must be open, invite_only, closed, or domain with at least one domain")
+	case errors.Is(err, domain.ErrInvalidEmailDomain):
+		return status.Error(codes.InvalidArgument, domain.ErrInvalidEmailDomain.Error())
+	case errors.Is(err, domain.ErrInvalidCursor):
+		return status.Error(codes.InvalidArgument, "invalid cursor")
+	case errors.Is(err, domain.ErrNotMember):
+		return status.Error(codes.NotFound, "user is not a member of the app")
+	case errors.Is(err, domain.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, domain.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
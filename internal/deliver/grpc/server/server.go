@@ -2,22 +2,56 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"net"
+	"strings"
 
 	ssov1 "github.com/LockMessage/protos/golang/sso"
 	"github.com/LockMessage/sso/internal/domain"
 	"github.com/LockMessage/sso/internal/domain/models"
 	"github.com/LockMessage/sso/internal/usecase/auth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Auth interface {
-	Login(ctx context.Context, req models.LoginRequest) (token string, refToken string, err error)
+	Login(ctx context.Context, req models.LoginRequest) (models.LoginResult, error)
 	RegisterNewUser(ctx context.Context, req models.RegisterRequest) (userID int64, err error)
 	IsAdmin(ctx context.Context, req models.IsAdminRequest) (bool, error)
 	RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (string, error)
+	SendVerification(ctx context.Context, req models.SendVerificationRequest) error
+	ConfirmEmail(ctx context.Context, req models.ConfirmEmailRequest) error
+	RequestPasswordReset(ctx context.Context, req models.RequestPasswordResetRequest) error
+	ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error
+	ChangePassword(ctx context.Context, req models.ChangePasswordRequest) error
+	ChangeEmail(ctx context.Context, req models.ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, req models.ConfirmEmailChangeRequest) error
+	UndoEmailChange(ctx context.Context, req models.UndoEmailChangeRequest) error
+	DeleteAccount(ctx context.Context, req models.DeleteAccountRequest) error
+	CancelDeletion(ctx context.Context, req models.CancelDeletionRequest) error
+	ExportUserData(ctx context.Context, req models.ExportUserDataRequest) (models.DataExport, error)
+	AdminExportUserData(ctx context.Context, req models.AdminExportUserDataRequest) (models.DataExport, error)
+	IntrospectToken(ctx context.Context, req models.IntrospectTokenRequest) (models.Introspection, error)
+	GetMe(ctx context.Context, req models.GetMeRequest) (models.User, error)
+	GetUser(ctx context.Context, req models.GetUserRequest) (models.User, error)
+	UpdateProfile(ctx context.Context, req models.UpdateProfileRequest) (models.User, error)
+	InviteUser(ctx context.Context, req models.InviteUserRequest) (userID int64, err error)
+	RevokeInvitation(ctx context.Context, req models.RevokeInvitationRequest) error
+	AcceptInvitation(ctx context.Context, req models.AcceptInvitationRequest) error
+	GetLoginHistory(ctx context.Context, req models.GetLoginHistoryRequest) (models.LoginHistoryPage, error)
+	EnrollTOTP(ctx context.Context, req models.EnrollTOTPRequest) (models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, req models.ConfirmTOTPRequest) error
+	VerifyMFA(ctx context.Context, req models.VerifyMFARequest) (models.LoginResult, error)
+	BeginPasskeyRegistration(ctx context.Context, req models.BeginPasskeyRegistrationRequest) (models.PasskeyCeremony, error)
+	FinishPasskeyRegistration(ctx context.Context, req models.FinishPasskeyRegistrationRequest) (int64, error)
+	BeginPasskeyLogin(ctx context.Context, req models.BeginPasskeyLoginRequest) (models.PasskeyCeremony, error)
+	FinishPasskeyLogin(ctx context.Context, req models.FinishPasskeyLoginRequest) (models.LoginResult, error)
 }
 
 type serverAPI struct {
@@ -31,6 +65,121 @@ func Register(gRPC *grpc.Server, auth Auth) {
 
 const emptyValue = 0
 
+// maxUserAgentLength bounds the user agent kept in the login history.
+const maxUserAgentLength = 512
+
+// clientInfo describes the caller from the connection's peer address and
+// the user agent its gRPC client sent. Forwarding headers are ignored as
+// any client can set them.
+func clientInfo(ctx context.Context) models.ClientInfo {
+	var info models.ClientInfo
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(info.IP); err == nil {
+			info.IP = host
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			info.UserAgent = ua[0]
+			if len(info.UserAgent) > maxUserAgentLength {
+				info.UserAgent = strings.ToValidUTF8(info.UserAgent[:maxUserAgentLength], "")
+			}
+		}
+	}
+	return info
+}
+
+// isTokenError reports whether err was caused by an unusable access token.
+func isTokenError(err error) bool {
+	return errors.Is(err, domain.ErrInvalidToken) ||
+		errors.Is(err, domain.ErrTokenExpired) ||
+		errors.Is(err, domain.ErrWrongType)
+}
+
+// accountStatusError maps the errors raised for accounts that are not
+// active to their gRPC status, one code per state. It returns nil for
+// any other error.
+func accountStatusError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, "email is not verified")
+	case errors.Is(err, domain.ErrInvitationPending):
+		return status.Error(codes.FailedPrecondition, "invitation is not accepted yet")
+	case errors.Is(err, domain.ErrUserDisabled):
+		return status.Error(codes.PermissionDenied, "account is disabled")
+	case errors.Is(err, domain.ErrUserDeleted):
+		return status.Error(codes.NotFound, "account is deleted")
+	}
+	return nil
+}
+
+// authError maps the errors of authenticated calls: unusable tokens and
+// accounts that are not active. It returns nil for any other error.
+func authError(err error) error {
+	if isTokenError(err) {
+		return status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	return accountStatusError(err)
+}
+
+// mfaError maps the errors of second factor enrollment and verification.
+// It returns nil for any other error.
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		return status.Error(codes.InvalidArgument, "invalid mfa code")
+	case errors.Is(err, domain.ErrMFALocked):
+		return status.Error(codes.ResourceExhausted, "too many invalid mfa codes, try again later")
+	case errors.Is(err, domain.ErrMFANotEnrolled):
+		return status.Error(codes.FailedPrecondition, "mfa is not enrolled")
+	case errors.Is(err, domain.ErrMFAAlreadyEnabled):
+		return status.Error(codes.AlreadyExists, "mfa is already enabled")
+	case errors.Is(err, domain.ErrMFAUnavailable):
+		return status.Error(codes.Unimplemented, "mfa is not available")
+	}
+	return nil
+}
+
+// passkeyError maps the errors of passkey ceremonies.
+// It returns nil for any other error.
+func passkeyError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidPasskey):
+		return status.Error(codes.InvalidArgument, "invalid passkey")
+	case errors.Is(err, domain.ErrInvalidChallenge):
+		return status.Error(codes.InvalidArgument, "invalid or expired challenge")
+	case errors.Is(err, domain.ErrPasskeyExists):
+		return status.Error(codes.AlreadyExists, "passkey already registered")
+	case errors.Is(err, domain.ErrPasskeysUnavailable):
+		return status.Error(codes.Unimplemented, "passkeys are not available")
+	}
+	return nil
+}
+
+// passwordError turns a refused password into InvalidArgument with one
+// BadRequest field violation per broken rule of the policy.
+func passwordError(field string, err error) error {
+	st := status.New(codes.InvalidArgument, domain.ErrWrongPasswordFormat.Error())
+	var policyErr *domain.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return st.Err()
+	}
+	br := &errdetails.BadRequest{}
+	for _, v := range policyErr.Violations {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Description,
+			Reason:      string(v.Rule),
+		})
+	}
+	detailed, detailErr := st.WithDetails(br)
+	if detailErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
 func (s *serverAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshTokenRequest) (*ssov1.RefreshTokenResponse, error) {
 	if req.GetAppId() == emptyValue {
 		return nil, status.Errorf(codes.InvalidArgument, "app_id is required")
@@ -38,7 +187,11 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshTokenReq
 	if req.GetRefreshToken() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "token is required")
 	}
-	domainReq := models.RefreshTokenRequest{AppID: req.GetAppId(), RefreshToken: req.GetRefreshToken()}
+	domainReq := models.RefreshTokenRequest{
+		AppID:        req.GetAppId(),
+		RefreshToken: req.GetRefreshToken(),
+		Client:       clientInfo(ctx),
+	}
 	token, err := s.auth.RefreshToken(ctx, domainReq)
 	if err != nil {
 		if errors.Is(err, domain.ErrInvalidToken) || errors.Is(err, domain.ErrTokenExpired) {
@@ -47,14 +200,25 @@ func (s *serverAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshTokenReq
 		if errors.Is(err, domain.ErrWrongType) {
 			return nil, status.Error(codes.InvalidArgument, "token is not a refresh token")
 		}
+		if st := accountStatusError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not a member of the app")
+		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
 	return &ssov1.RefreshTokenResponse{AccessToken: token}, nil
 }
 
 func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.LoginResponse, error) {
-	if req.GetEmail() == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "email is required")
+	// login takes an email or a username; email is kept for older clients.
+	login := req.GetLogin()
+	if login == "" {
+		login = req.GetEmail()
+	}
+	if login == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "login is required")
 	}
 	if req.GetPassword() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "password is required")
@@ -63,36 +227,311 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 		return nil, status.Errorf(codes.InvalidArgument, "app_id is required")
 	}
 
-	domainReq := models.LoginRequest{AppID: req.GetAppId(), Email: req.GetEmail(), PassHash: req.GetPassword()}
-	token, refToken, err := s.auth.Login(ctx, domainReq)
+	domainReq := models.LoginRequest{
+		AppID:    req.GetAppId(),
+		Login:    login,
+		PassHash: req.GetPassword(),
+		Client:   clientInfo(ctx),
+	}
+	result, err := s.auth.Login(ctx, domainReq)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid login or password")
+		}
+		if st := accountStatusError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not a member of the app")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if result.MFAToken != "" {
+		return &ssov1.LoginResponse{MfaRequired: true, MfaToken: result.MFAToken}, nil
+	}
+	if result.PasswordChangeToken != "" {
+		return &ssov1.LoginResponse{PasswordChangeRequired: true, PasswordChangeToken: result.PasswordChangeToken}, nil
+	}
+	return &ssov1.LoginResponse{Token: result.AccessToken, RefreshToken: result.RefreshToken}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *ssov1.VerifyMFARequest) (*ssov1.VerifyMFAResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetMfaToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "mfa_token is required")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.VerifyMFARequest{
+		AppID:    req.GetAppId(),
+		MFAToken: req.GetMfaToken(),
+		Code:     req.GetCode(),
+		Client:   clientInfo(ctx),
+	}
+	result, err := s.auth.VerifyMFA(ctx, domainReq)
+	if err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if st := mfaError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not a member of the app")
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	if result.PasswordChangeToken != "" {
+		return &ssov1.VerifyMFAResponse{PasswordChangeRequired: true, PasswordChangeToken: result.PasswordChangeToken}, nil
+	}
+	return &ssov1.VerifyMFAResponse{Token: result.AccessToken, RefreshToken: result.RefreshToken}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *ssov1.EnrollTOTPRequest) (*ssov1.EnrollTOTPResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	domainReq := models.EnrollTOTPRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Password:    req.GetPassword(),
+	}
+	enrollment, err := s.auth.EnrollTOTP(ctx, domainReq)
+	if err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid password")
+		}
+		if st := mfaError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.EnrollTOTPResponse{Secret: enrollment.Secret, Uri: enrollment.URI}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *ssov1.ConfirmTOTPRequest) (*ssov1.ConfirmTOTPResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.ConfirmTOTPRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Code:        req.GetCode(),
+	}
+	if err := s.auth.ConfirmTOTP(ctx, domainReq); err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if st := mfaError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ConfirmTOTPResponse{}, nil
+}
+
+func (s *serverAPI) BeginPasskeyRegistration(ctx context.Context, req *ssov1.BeginPasskeyRegistrationRequest) (*ssov1.BeginPasskeyRegistrationResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	domainReq := models.BeginPasskeyRegistrationRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Password:    req.GetPassword(),
+	}
+	ceremony, err := s.auth.BeginPasskeyRegistration(ctx, domainReq)
 	if err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
 		if errors.Is(err, auth.ErrInvalidCredentials) {
-			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
+			return nil, status.Error(codes.InvalidArgument, "invalid password")
+		}
+		if st := passkeyError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
 		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
+	return &ssov1.BeginPasskeyRegistrationResponse{
+		ChallengeId: ceremony.ChallengeID,
+		OptionsJson: string(ceremony.Options),
+	}, nil
+}
 
-	return &ssov1.LoginResponse{Token: token, RefreshToken: refToken}, nil
+func (s *serverAPI) FinishPasskeyRegistration(ctx context.Context, req *ssov1.FinishPasskeyRegistrationRequest) (*ssov1.FinishPasskeyRegistrationResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetChallengeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_id is required")
+	}
+	if req.GetCredentialJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "credential_json is required")
+	}
+	domainReq := models.FinishPasskeyRegistrationRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		ChallengeID: req.GetChallengeId(),
+		Credential:  []byte(req.GetCredentialJson()),
+	}
+	id, err := s.auth.FinishPasskeyRegistration(ctx, domainReq)
+	if err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if st := passkeyError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.FinishPasskeyRegistrationResponse{PasskeyId: id}, nil
+}
+
+func (s *serverAPI) BeginPasskeyLogin(ctx context.Context, req *ssov1.BeginPasskeyLoginRequest) (*ssov1.BeginPasskeyLoginResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	ceremony, err := s.auth.BeginPasskeyLogin(ctx, models.BeginPasskeyLoginRequest{AppID: req.GetAppId()})
+	if err != nil {
+		if st := passkeyError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.BeginPasskeyLoginResponse{
+		ChallengeId: ceremony.ChallengeID,
+		OptionsJson: string(ceremony.Options),
+	}, nil
+}
+
+func (s *serverAPI) FinishPasskeyLogin(ctx context.Context, req *ssov1.FinishPasskeyLoginRequest) (*ssov1.FinishPasskeyLoginResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetChallengeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "challenge_id is required")
+	}
+	if req.GetCredentialJson() == "" {
+		return nil, status.Error(codes.InvalidArgument, "credential_json is required")
+	}
+	domainReq := models.FinishPasskeyLoginRequest{
+		AppID:       req.GetAppId(),
+		ChallengeID: req.GetChallengeId(),
+		Credential:  []byte(req.GetCredentialJson()),
+		Client:      clientInfo(ctx),
+	}
+	result, err := s.auth.FinishPasskeyLogin(ctx, domainReq)
+	if err != nil {
+		if st := passkeyError(err); st != nil {
+			return nil, st
+		}
+		if st := accountStatusError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrNotMember) {
+			return nil, status.Error(codes.PermissionDenied, "user is not a member of the app")
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	if result.MFAToken != "" {
+		return &ssov1.FinishPasskeyLoginResponse{MfaRequired: true, MfaToken: result.MFAToken}, nil
+	}
+	return &ssov1.FinishPasskeyLoginResponse{Token: result.AccessToken, RefreshToken: result.RefreshToken}, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*ssov1.RegisterResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
 	if req.GetEmail() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "email is required")
 	}
 	if req.GetPassword() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "password is required")
 	}
-	domainReq := models.RegisterRequest{Email: req.GetEmail(), Password: req.GetPassword()}
+	domainReq := models.RegisterRequest{
+		AppID:    req.GetAppId(),
+		Email:    req.GetEmail(),
+		Username: req.GetUsername(),
+		Password: req.GetPassword(),
+	}
 	userID, err := s.auth.RegisterNewUser(ctx, domainReq)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, domain.ErrUsernameTaken) {
+			return nil, status.Error(codes.AlreadyExists, "username already taken")
+		}
 		if errors.Is(err, domain.ErrWrongEmailFormat) {
 			return nil, status.Error(codes.InvalidArgument, "wrong email format")
 		}
+		if errors.Is(err, domain.ErrWrongUsernameFormat) || errors.Is(err, domain.ErrUsernameReserved) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		if errors.Is(err, domain.ErrWrongPasswordFormat) {
-			return nil, status.Error(codes.InvalidArgument, domain.ErrWrongPasswordFormat.Error())
+			return nil, passwordError("password", err)
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		if errors.Is(err, domain.ErrRegistrationClosed) {
+			return nil, status.Error(codes.FailedPrecondition, "registration is closed")
+		}
+		if errors.Is(err, domain.ErrRegistrationInviteOnly) {
+			return nil, status.Error(codes.PermissionDenied, "registration is by invitation only")
+		}
+		if errors.Is(err, domain.ErrEmailDomainNotAllowed) {
+			return nil, status.Error(codes.InvalidArgument, "email domain is not allowed")
 		}
 		return nil, status.Error(codes.Internal, "internal error")
 	}
@@ -112,3 +551,520 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest) (*ss
 	}
 	return &ssov1.IsAdminResponse{IsAdmin: isAdmin}, nil
 }
+
+func (s *serverAPI) SendVerification(ctx context.Context, req *ssov1.SendVerificationRequest) (*ssov1.SendVerificationResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	domainReq := models.SendVerificationRequest{Email: req.GetEmail()}
+	if err := s.auth.SendVerification(ctx, domainReq); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.SendVerificationResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmail(ctx context.Context, req *ssov1.ConfirmEmailRequest) (*ssov1.ConfirmEmailResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.ConfirmEmailRequest{Code: req.GetCode()}
+	if err := s.auth.ConfirmEmail(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ConfirmEmailResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *ssov1.RequestPasswordResetRequest) (*ssov1.RequestPasswordResetResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	domainReq := models.RequestPasswordResetRequest{Email: req.GetEmail()}
+	if err := s.auth.RequestPasswordReset(ctx, domainReq); err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(ctx context.Context, req *ssov1.ResetPasswordRequest) (*ssov1.ResetPasswordResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+	domainReq := models.ResetPasswordRequest{Code: req.GetCode(), NewPassword: req.GetNewPassword()}
+	if err := s.auth.ResetPassword(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		if errors.Is(err, domain.ErrWrongPasswordFormat) {
+			return nil, passwordError("new_password", err)
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *ssov1.ChangePasswordRequest) (*ssov1.ChangePasswordResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetCurrentPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "current_password is required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+	domainReq := models.ChangePasswordRequest{
+		AppID:           req.GetAppId(),
+		AccessToken:     req.GetAccessToken(),
+		CurrentPassword: req.GetCurrentPassword(),
+		NewPassword:     req.GetNewPassword(),
+	}
+	if err := s.auth.ChangePassword(ctx, domainReq); err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid current password")
+		}
+		if errors.Is(err, domain.ErrWrongPasswordFormat) {
+			return nil, passwordError("new_password", err)
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ChangePasswordResponse{}, nil
+}
+
+func (s *serverAPI) ChangeEmail(ctx context.Context, req *ssov1.ChangeEmailRequest) (*ssov1.ChangeEmailResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	if req.GetNewEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_email is required")
+	}
+	domainReq := models.ChangeEmailRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Password:    req.GetPassword(),
+		NewEmail:    req.GetNewEmail(),
+	}
+	if err := s.auth.ChangeEmail(ctx, domainReq); err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid password")
+		}
+		if errors.Is(err, domain.ErrWrongEmailFormat) {
+			return nil, status.Error(codes.InvalidArgument, "wrong email format")
+		}
+		if errors.Is(err, domain.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ChangeEmailResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmailChange(ctx context.Context, req *ssov1.ConfirmEmailChangeRequest) (*ssov1.ConfirmEmailChangeResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.ConfirmEmailChangeRequest{Code: req.GetCode()}
+	if err := s.auth.ConfirmEmailChange(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		if errors.Is(err, domain.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ConfirmEmailChangeResponse{}, nil
+}
+
+func (s *serverAPI) UndoEmailChange(ctx context.Context, req *ssov1.UndoEmailChangeRequest) (*ssov1.UndoEmailChangeResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.UndoEmailChangeRequest{Code: req.GetCode()}
+	if err := s.auth.UndoEmailChange(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		if errors.Is(err, domain.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "email is already taken")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.UndoEmailChangeResponse{}, nil
+}
+
+func (s *serverAPI) DeleteAccount(ctx context.Context, req *ssov1.DeleteAccountRequest) (*ssov1.DeleteAccountResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	domainReq := models.DeleteAccountRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Password:    req.GetPassword(),
+	}
+	if err := s.auth.DeleteAccount(ctx, domainReq); err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid password")
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.DeleteAccountResponse{}, nil
+}
+
+func (s *serverAPI) CancelDeletion(ctx context.Context, req *ssov1.CancelDeletionRequest) (*ssov1.CancelDeletionResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	domainReq := models.CancelDeletionRequest{Code: req.GetCode()}
+	if err := s.auth.CancelDeletion(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "account is not scheduled for deletion")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.CancelDeletionResponse{}, nil
+}
+
+func (s *serverAPI) ExportUserData(ctx context.Context, req *ssov1.ExportUserDataRequest) (*ssov1.ExportUserDataResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	domainReq := models.ExportUserDataRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken()}
+	export, err := s.auth.ExportUserData(ctx, domainReq)
+	if err != nil {
+		return nil, exportError(err)
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.ExportUserDataResponse{Data: data}, nil
+}
+
+func (s *serverAPI) AdminExportUserData(ctx context.Context, req *ssov1.AdminExportUserDataRequest) (*ssov1.AdminExportUserDataResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.AdminExportUserDataRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		UserID:      req.GetUserId(),
+	}
+	export, err := s.auth.AdminExportUserData(ctx, domainReq)
+	if err != nil {
+		return nil, exportError(err)
+	}
+	data, err := json.Marshal(export)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.AdminExportUserDataResponse{Data: data}, nil
+}
+
+func exportError(err error) error {
+	if st := authError(err); st != nil {
+		return st
+	}
+	if errors.Is(err, domain.ErrPermissionDenied) {
+		return status.Error(codes.PermissionDenied, "admin access required")
+	}
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, domain.ErrAppNotFound) {
+		return status.Error(codes.NotFound, "app not found")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (s *serverAPI) GetMe(ctx context.Context, req *ssov1.GetMeRequest) (*ssov1.GetMeResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	domainReq := models.GetMeRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken()}
+	user, err := s.auth.GetMe(ctx, domainReq)
+	if err != nil {
+		return nil, profileError(err)
+	}
+	return &ssov1.GetMeResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *serverAPI) GetUser(ctx context.Context, req *ssov1.GetUserRequest) (*ssov1.GetUserResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.GetUserRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken(), UserID: req.GetUserId()}
+	user, err := s.auth.GetUser(ctx, domainReq)
+	if err != nil {
+		return nil, profileError(err)
+	}
+	return &ssov1.GetUserResponse{User: toProtoUser(user)}, nil
+}
+
+func (s *serverAPI) UpdateProfile(ctx context.Context, req *ssov1.UpdateProfileRequest) (*ssov1.UpdateProfileResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	domainReq := models.UpdateProfileRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken()}
+	if req.Username != nil {
+		username := req.GetUsername()
+		domainReq.Update.Username = &username
+	}
+	if req.DisplayName != nil {
+		displayName := req.GetDisplayName()
+		domainReq.Update.DisplayName = &displayName
+	}
+	if req.Locale != nil {
+		locale := req.GetLocale()
+		domainReq.Update.Locale = &locale
+	}
+	if req.AvatarUrl != nil {
+		avatarURL := req.GetAvatarUrl()
+		domainReq.Update.AvatarURL = &avatarURL
+	}
+	user, err := s.auth.UpdateProfile(ctx, domainReq)
+	if err != nil {
+		return nil, profileError(err)
+	}
+	return &ssov1.UpdateProfileResponse{User: toProtoUser(user)}, nil
+}
+
+func profileError(err error) error {
+	if st := authError(err); st != nil {
+		return st
+	}
+	for _, formatErr := range []error{
+		domain.ErrWrongUsernameFormat, domain.ErrUsernameReserved,
+		domain.ErrInvalidDisplayName, domain.ErrInvalidLocale, domain.ErrInvalidAvatarURL,
+	} {
+		if errors.Is(err, formatErr) {
+			return status.Error(codes.InvalidArgument, formatErr.Error())
+		}
+	}
+	if errors.Is(err, domain.ErrUsernameTaken) {
+		return status.Error(codes.AlreadyExists, "username already taken")
+	}
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, domain.ErrAppNotFound) {
+		return status.Error(codes.NotFound, "app not found")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func toProtoUser(user models.User) *ssov1.User {
+	protoUser := &ssov1.User{
+		Id:               user.ID,
+		Email:            user.Email,
+		Username:         user.Username,
+		EmailVerified:    user.EmailVerified,
+		Status:           string(user.Status),
+		IsAdmin:          user.IsAdmin,
+		DisplayName:      user.DisplayName,
+		Locale:           user.Locale,
+		AvatarUrl:        user.AvatarURL,
+		CreatedAt:        timestamppb.New(user.CreatedAt),
+		UpdatedAt:        timestamppb.New(user.UpdatedAt),
+		PasswordBreached: user.PasswordBreached,
+	}
+	if user.LastLoginAt != nil {
+		protoUser.LastLoginAt = timestamppb.New(*user.LastLoginAt)
+	}
+	return protoUser
+}
+
+func (s *serverAPI) IntrospectToken(ctx context.Context, req *ssov1.IntrospectTokenRequest) (*ssov1.IntrospectTokenResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "access_token is required")
+	}
+	domainReq := models.IntrospectTokenRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken()}
+	info, err := s.auth.IntrospectToken(ctx, domainReq)
+	if err != nil {
+		if st := authError(err); st != nil {
+			return nil, st
+		}
+		if errors.Is(err, domain.ErrAppNotFound) {
+			return nil, status.Error(codes.NotFound, "app not found")
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.IntrospectTokenResponse{
+		User:      toProtoUser(info.User),
+		AppId:     int32(info.AppID),
+		SessionId: info.SessionID,
+	}, nil
+}
+
+func (s *serverAPI) InviteUser(ctx context.Context, req *ssov1.InviteUserRequest) (*ssov1.InviteUserResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	domainReq := models.InviteUserRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		Email:       req.GetEmail(),
+		DisplayName: req.GetDisplayName(),
+	}
+	userID, err := s.auth.InviteUser(ctx, domainReq)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		}
+		if errors.Is(err, domain.ErrWrongEmailFormat) {
+			return nil, status.Error(codes.InvalidArgument, "wrong email format")
+		}
+		if errors.Is(err, domain.ErrInvalidDisplayName) {
+			return nil, status.Error(codes.InvalidArgument, domain.ErrInvalidDisplayName.Error())
+		}
+		return nil, adminError(err)
+	}
+	return &ssov1.InviteUserResponse{UserId: userID}, nil
+}
+
+func (s *serverAPI) RevokeInvitation(ctx context.Context, req *ssov1.RevokeInvitationRequest) (*ssov1.RevokeInvitationResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetUserId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	domainReq := models.RevokeInvitationRequest{AppID: req.GetAppId(), AccessToken: req.GetAccessToken(), UserID: req.GetUserId()}
+	if err := s.auth.RevokeInvitation(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "no pending invitation for user")
+		}
+		return nil, adminError(err)
+	}
+	return &ssov1.RevokeInvitationResponse{}, nil
+}
+
+func (s *serverAPI) AcceptInvitation(ctx context.Context, req *ssov1.AcceptInvitationRequest) (*ssov1.AcceptInvitationResponse, error) {
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+	domainReq := models.AcceptInvitationRequest{Code: req.GetCode(), Password: req.GetPassword()}
+	if err := s.auth.AcceptInvitation(ctx, domainReq); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired code")
+		}
+		if errors.Is(err, domain.ErrWrongPasswordFormat) {
+			return nil, passwordError("password", err)
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &ssov1.AcceptInvitationResponse{}, nil
+}
+
+func (s *serverAPI) GetLoginHistory(ctx context.Context, req *ssov1.GetLoginHistoryRequest) (*ssov1.GetLoginHistoryResponse, error) {
+	if req.GetAppId() == emptyValue {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetAccessToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "access_token is required")
+	}
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+	domainReq := models.GetLoginHistoryRequest{
+		AppID:       req.GetAppId(),
+		AccessToken: req.GetAccessToken(),
+		UserID:      req.GetUserId(),
+		BeforeID:    req.GetBeforeId(),
+		PageSize:    int(req.GetPageSize()),
+	}
+	page, err := s.auth.GetLoginHistory(ctx, domainReq)
+	if err != nil {
+		return nil, exportError(err)
+	}
+	events := make([]*ssov1.LoginEvent, 0, len(page.Events))
+	for _, e := range page.Events {
+		events = append(events, &ssov1.LoginEvent{
+			Id:        e.ID,
+			AppId:     e.AppID,
+			Kind:      string(e.Kind),
+			Outcome:   string(e.Outcome),
+			Ip:        e.Client.IP,
+			UserAgent: e.Client.UserAgent,
+			CreatedAt: timestamppb.New(e.CreatedAt),
+		})
+	}
+	return &ssov1.GetLoginHistoryResponse{Events: events, NextBeforeId: page.NextBeforeID}, nil
+}
@@ -23,9 +23,104 @@ var (
 	// This error is returned during user registration when the email is already taken.
 	ErrUserExists = errors.New("user already exists")
 
+	// ErrEmailNotVerified indicates that the user has not confirmed their email
+	// and the requested app does not allow unverified users to log in.
+	ErrEmailNotVerified = errors.New("email not verified")
+
+	// ErrInvitationPending indicates that the user was invited but has not
+	// accepted the invitation yet.
+	ErrInvitationPending = errors.New("invitation not accepted yet")
+
+	// ErrUserDisabled indicates that an admin disabled the account.
+	ErrUserDisabled = errors.New("user is disabled")
+
+	// ErrUserDeleted indicates that the account is scheduled for deletion.
+	ErrUserDeleted = errors.New("user is deleted")
+
+	// ErrInvalidCode indicates that a one-time code is malformed, expired
+	// or has already been used.
+	ErrInvalidCode = errors.New("invalid or expired code")
+
+	// ErrPermissionDenied indicates that the caller is authenticated but not
+	// allowed to perform the operation, e.g. a non-admin calling an admin use case.
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrInvalidCursor indicates that a pagination cursor was not issued by the service.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrSelfModification indicates that an admin tried to disable or demote themselves.
+	ErrSelfModification = errors.New("admins cannot disable or demote themselves")
+
+	// ErrNotMember indicates that the user is not enrolled in the app.
+	ErrNotMember = errors.New("user is not a member of the app")
+
+	// ErrRegistrationClosed indicates that the app does not accept new users.
+	ErrRegistrationClosed = errors.New("registration is closed")
+
+	// ErrRegistrationInviteOnly indicates that the app only accepts invited users.
+	ErrRegistrationInviteOnly = errors.New("registration is by invitation only")
+
+	// ErrEmailDomainNotAllowed indicates that the app only accepts addresses
+	// from other domains.
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed")
+
+	// ErrInvalidRegistrationPolicy indicates an unknown registration policy,
+	// or a domain policy without domains.
+	ErrInvalidRegistrationPolicy = errors.New("invalid registration policy")
+
+	// ErrSessionNotFound indicates that a token refers to a session that does not exist.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrUsernameTaken indicates that another user already registered the username.
+	ErrUsernameTaken = errors.New("username already taken")
+
+	// ErrMFANotEnrolled indicates that the user has no pending or confirmed
+	// second factor.
+	ErrMFANotEnrolled = errors.New("mfa is not enrolled")
+
+	// ErrMFAAlreadyEnabled indicates that the user already confirmed a
+	// second factor, which cannot be replaced by enrolling again.
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+
+	// ErrInvalidMFACode indicates that a one-time password is wrong, expired
+	// or was already used.
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+
+	// ErrMFALocked indicates that too many wrong one-time passwords were
+	// sent and codes are refused for a while.
+	ErrMFALocked = errors.New("too many invalid mfa codes")
+
+	// ErrMFAUnavailable indicates that the deployment has no key to encrypt
+	// second factor secrets with.
+	ErrMFAUnavailable = errors.New("mfa is not available")
+
+	// ErrPasskeysUnavailable indicates that the deployment has no relying
+	// party configured for passkeys.
+	ErrPasskeysUnavailable = errors.New("passkeys are not available")
+
+	// ErrInvalidPasskey indicates that a passkey response does not verify,
+	// names an unknown credential or comes from a cloned authenticator.
+	ErrInvalidPasskey = errors.New("invalid passkey")
+
+	// ErrPasskeyExists indicates that the credential is already registered.
+	ErrPasskeyExists = errors.New("passkey already registered")
+
+	// ErrPasskeyNotFound indicates that no passkey has the credential id.
+	ErrPasskeyNotFound = errors.New("passkey not found")
+
+	// ErrInvalidChallenge indicates that a passkey ceremony is unknown,
+	// expired, already finished or of another kind.
+	ErrInvalidChallenge = errors.New("invalid or expired challenge")
+
 	ErrInvalidCredentials  = errors.New("invalid credentials")
 	ErrWrongType           = errors.New("wrong token type")
 	ErrAppNotFound         = errors.New("app not found")
 	ErrWrongEmailFormat    = errors.New("wrong email format")
-	ErrWrongPasswordFormat = errors.New("password should be more than 8 characters")
+	ErrWrongPasswordFormat = errors.New("password does not meet the policy")
+	ErrWrongUsernameFormat = errors.New("username must be 3 to 32 lowercase letters, digits or underscores and start with a letter")
+	ErrUsernameReserved    = errors.New("username is reserved")
+	ErrInvalidDisplayName  = errors.New("display name must be at most 64 printable characters")
+	ErrInvalidLocale       = errors.New("locale must be a language tag such as en or pt-BR")
+	ErrInvalidAvatarURL    = errors.New("avatar url must be an absolute https url")
+	ErrInvalidEmailDomain  = errors.New("email domain must be a host name such as example.com")
 )
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// UserFilter narrows down the users listed to admins. Zero fields match everything.
+type UserFilter struct {
+	// EmailPrefix matches the beginning of the normalized email.
+	EmailPrefix string
+	// Status restricts the list to one lifecycle state. Deleted users are
+	// only listed when asked for explicitly.
+	Status UserStatus
+	// IsAdmin, when set, keeps only admins or only regular users.
+	IsAdmin       *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// UserPage is one page of a user listing.
+type UserPage struct {
+	Users []User
+	// NextCursor fetches the following page; it is empty on the last one.
+	NextCursor string
+}
+
+type ListUsersRequest struct {
+	AppID       int32
+	AccessToken string
+	Filter      UserFilter
+	Cursor      string
+	PageSize    int
+}
+
+type AdminUserRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+}
+
+// MembershipRequest grants or revokes a user's membership of TargetAppID.
+// AppID is the app the admin's access token was issued for.
+type MembershipRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+	TargetAppID int32
+}
+
+// SetRegistrationPolicyRequest changes the registration policy of TargetAppID.
+type SetRegistrationPolicyRequest struct {
+	AppID          int32
+	AccessToken    string
+	TargetAppID    int32
+	Policy         RegistrationPolicy
+	AllowedDomains []string
+}
+
+type SetAdminRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+	IsAdmin     bool
+}
@@ -1,11 +1,43 @@
 package models
 
+// RegistrationPolicy decides who may sign up through an app.
+type RegistrationPolicy string
+
+const (
+	// RegistrationOpen lets anyone register.
+	RegistrationOpen RegistrationPolicy = "open"
+	// RegistrationInviteOnly only admits users invited by an admin.
+	RegistrationInviteOnly RegistrationPolicy = "invite_only"
+	// RegistrationClosed admits nobody new.
+	RegistrationClosed RegistrationPolicy = "closed"
+	// RegistrationDomain lets anyone with an address in AllowedDomains register.
+	RegistrationDomain RegistrationPolicy = "domain"
+)
+
+// Valid reports whether p is one of the known policies.
+func (p RegistrationPolicy) Valid() bool {
+	switch p {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationClosed, RegistrationDomain:
+		return true
+	}
+	return false
+}
+
 type App struct {
 	ID     int
 	Name   string
 	Secret string
+	// AllowUnverifiedLogin permits users whose email is not yet verified
+	// to obtain tokens for this app.
+	AllowUnverifiedLogin bool
+	// ProfileClaims adds the user's name and locale to the tokens issued for this app.
+	ProfileClaims bool
+	// RegistrationPolicy decides who may register through this app.
+	RegistrationPolicy RegistrationPolicy
+	// AllowedDomains are the normalized email domains accepted by RegistrationDomain.
+	AllowedDomains []string
 }
 
 func NewApp(id int, name, secret string) *App {
-	return &App{ID: id, Name: name, Secret: secret}
+	return &App{ID: id, Name: name, Secret: secret, RegistrationPolicy: RegistrationOpen}
 }
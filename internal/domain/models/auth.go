@@ -3,20 +3,144 @@ package models
 type RefreshTokenRequest struct {
 	AppID        int32
 	RefreshToken string
+	Client       ClientInfo
 }
 
 type LoginRequest struct {
-	AppID    int32
-	Email    string
+	AppID int32
+	// Login is either the user's email or their username, with or without the "@".
+	Login    string
 	PassHash string
+	Client   ClientInfo
+}
+
+// LoginResult is what a login with the right password yields: a token pair,
+// or a restricted token when the user has to take another step first.
+type LoginResult struct {
+	AccessToken  string
+	RefreshToken string
+	// PasswordChangeToken replaces the token pair when the password has
+	// expired. It only allows ChangePassword.
+	PasswordChangeToken string
+	// MFAToken replaces the token pair when the user enrolled a second
+	// factor. It is exchanged for the pair by VerifyMFA.
+	MFAToken string
 }
 
 type RegisterRequest struct {
 	AppID    int32
 	Email    string
+	Username string
 	Password string
 }
 
 type IsAdminRequest struct {
 	UserID int64
 }
+
+type SendVerificationRequest struct {
+	Email string
+}
+
+type ConfirmEmailRequest struct {
+	Code string
+}
+
+type RequestPasswordResetRequest struct {
+	Email string
+}
+
+type ResetPasswordRequest struct {
+	Code        string
+	NewPassword string
+}
+
+type ChangePasswordRequest struct {
+	AppID           int32
+	AccessToken     string
+	CurrentPassword string
+	NewPassword     string
+}
+
+type ChangeEmailRequest struct {
+	AppID       int32
+	AccessToken string
+	Password    string
+	NewEmail    string
+}
+
+type ConfirmEmailChangeRequest struct {
+	Code string
+}
+
+type UndoEmailChangeRequest struct {
+	Code string
+}
+
+type DeleteAccountRequest struct {
+	AppID       int32
+	AccessToken string
+	Password    string
+}
+
+type CancelDeletionRequest struct {
+	Code string
+}
+
+type ExportUserDataRequest struct {
+	AppID       int32
+	AccessToken string
+}
+
+type AdminExportUserDataRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+}
+
+type InviteUserRequest struct {
+	AppID       int32
+	AccessToken string
+	Email       string
+	DisplayName string
+}
+
+type RevokeInvitationRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+}
+
+type AcceptInvitationRequest struct {
+	Code     string
+	Password string
+}
+
+type GetMeRequest struct {
+	AppID       int32
+	AccessToken string
+}
+
+type GetUserRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+}
+
+type UpdateProfileRequest struct {
+	AppID       int32
+	AccessToken string
+	Update      ProfileUpdate
+}
+
+type IntrospectTokenRequest struct {
+	AppID       int32
+	AccessToken string
+}
+
+// Introspection describes a valid access token and the user behind it.
+type Introspection struct {
+	User      User
+	AppID     int
+	SessionID string
+}
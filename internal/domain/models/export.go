@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// DataExport is the personal data held about a user, as handed out on a
+// data-subject access request. It must never carry secrets such as
+// password hashes or one-time codes. Consents are not part of it: the
+// service stores none.
+type DataExport struct {
+	GeneratedAt  time.Time            `json:"generated_at"`
+	Profile      ExportedProfile      `json:"profile"`
+	Sessions     []ExportedSession    `json:"sessions"`
+	Memberships  []ExportedMembership `json:"memberships"`
+	LoginHistory []ExportedLoginEvent `json:"login_history"`
+	// TOTP is the user's authenticator app enrollment, if any. Its secret
+	// is left out.
+	TOTP     *ExportedTOTP     `json:"totp,omitempty"`
+	Passkeys []ExportedPasskey `json:"passkeys"`
+}
+
+type ExportedProfile struct {
+	ID            int64      `json:"id"`
+	Email         string     `json:"email"`
+	Username      string     `json:"username,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	Status        string     `json:"status"`
+	IsAdmin       bool       `json:"is_admin"`
+	DisplayName   string     `json:"display_name"`
+	Locale        string     `json:"locale"`
+	AvatarURL     string     `json:"avatar_url"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
+	// PasswordBreached is set when the password was found in a breach corpus.
+	PasswordBreached bool       `json:"password_breached"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+type ExportedSession struct {
+	ID        string     `json:"id"`
+	AppID     int        `json:"app_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type ExportedMembership struct {
+	AppID    int       `json:"app_id"`
+	AppName  string    `json:"app_name"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type ExportedLoginEvent struct {
+	AppID     int32     `json:"app_id"`
+	Kind      string    `json:"kind"`
+	Outcome   string    `json:"outcome"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportedTOTP struct {
+	CreatedAt      time.Time  `json:"created_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	FailedAttempts int        `json:"failed_attempts"`
+	LastFailureAt  *time.Time `json:"last_failure_at,omitempty"`
+}
+
+type ExportedPasskey struct {
+	ID         int64      `json:"id"`
+	Transports []string   `json:"transports,omitempty"`
+	BackedUp   bool       `json:"backed_up"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// LoginEventKind tells which call produced a login event.
+type LoginEventKind string
+
+const (
+	LoginEventLogin   LoginEventKind = "login"
+	LoginEventRefresh LoginEventKind = "refresh"
+	// LoginEventMFA is the second step of a login with MFA.
+	LoginEventMFA LoginEventKind = "mfa"
+	// LoginEventPasskey is a login with a passkey instead of a password.
+	LoginEventPasskey LoginEventKind = "passkey"
+)
+
+// LoginOutcome is the result of a login or token refresh: success or the
+// reason it was refused.
+type LoginOutcome string
+
+const (
+	OutcomeSuccess            LoginOutcome = "success"
+	OutcomeInvalidCredentials LoginOutcome = "invalid_credentials"
+	OutcomeInvalidToken       LoginOutcome = "invalid_token"
+	OutcomeEmailNotVerified   LoginOutcome = "email_not_verified"
+	OutcomeInvitationPending  LoginOutcome = "invitation_pending"
+	OutcomeUserDisabled       LoginOutcome = "user_disabled"
+	OutcomeUserDeleted        LoginOutcome = "user_deleted"
+	OutcomeNotMember          LoginOutcome = "not_member"
+	OutcomeAppNotFound        LoginOutcome = "app_not_found"
+	// OutcomePasswordExpired is a right password that has to be changed
+	// before tokens are issued.
+	OutcomePasswordExpired LoginOutcome = "password_expired"
+	// OutcomeMFARequired is a right password of a user who still has to
+	// send a one-time password.
+	OutcomeMFARequired LoginOutcome = "mfa_required"
+	// OutcomeInvalidMFACode is a wrong or replayed one-time password.
+	OutcomeInvalidMFACode LoginOutcome = "invalid_mfa_code"
+	// OutcomeMFALocked is a one-time password refused after too many wrong ones.
+	OutcomeMFALocked LoginOutcome = "mfa_locked"
+	// OutcomeInvalidPasskey is a passkey response that did not verify.
+	OutcomeInvalidPasskey LoginOutcome = "invalid_passkey"
+	// OutcomeError is an internal failure unrelated to the caller.
+	OutcomeError LoginOutcome = "error"
+)
+
+// ClientInfo describes where a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// LoginEvent is one entry of the login history.
+type LoginEvent struct {
+	ID int64
+	// UserID is zero when the login did not match any user.
+	UserID    int64
+	AppID     int32
+	Kind      LoginEventKind
+	Outcome   LoginOutcome
+	Client    ClientInfo
+	CreatedAt time.Time
+}
+
+// GetLoginHistoryRequest lists the login history of the caller, or of
+// UserID when the caller is an admin.
+type GetLoginHistoryRequest struct {
+	AppID       int32
+	AccessToken string
+	UserID      int64
+	// BeforeID resumes the listing after the last event of the previous page.
+	BeforeID int64
+	PageSize int
+}
+
+// LoginHistoryPage is one page of login events, newest first.
+type LoginHistoryPage struct {
+	Events []LoginEvent
+	// NextBeforeID fetches the following page; it is zero on the last one.
+	NextBeforeID int64
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Membership enrolls a user in an app. Tokens for an app are only issued
+// to its members.
+type Membership struct {
+	UserID    int64
+	AppID     int
+	AppName   string
+	CreatedAt time.Time
+}
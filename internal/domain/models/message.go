@@ -0,0 +1,8 @@
+package models
+
+// Message is an email delivered to a user through a Mailer.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
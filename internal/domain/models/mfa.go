@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// TOTPCredential is a user's authenticator app enrollment. Secret is
+// encrypted; it only counts as a second factor once confirmed.
+type TOTPCredential struct {
+	UserID int64
+	Secret []byte
+	// LastStep is the time step of the last code accepted, so that no code
+	// is accepted twice.
+	LastStep int64
+	// FailedAttempts counts the wrong codes sent since the last accepted
+	// one, the latest at LastFailureAt.
+	FailedAttempts int
+	LastFailureAt  *time.Time
+	CreatedAt      time.Time
+	ConfirmedAt    *time.Time
+}
+
+// Confirmed reports whether the user proved they set up the authenticator.
+func (c TOTPCredential) Confirmed() bool {
+	return c.ConfirmedAt != nil
+}
+
+// EnrollTOTPRequest starts setting up an authenticator app. The password
+// is asked again, like for other changes that could lock the owner out.
+type EnrollTOTPRequest struct {
+	AppID       int32
+	AccessToken string
+	Password    string
+}
+
+// TOTPEnrollment is what the user needs to set up an authenticator app.
+type TOTPEnrollment struct {
+	// Secret is base32, for manual entry.
+	Secret string
+	// URI is the otpauth:// URI, usually shown as a QR code.
+	URI string
+}
+
+type ConfirmTOTPRequest struct {
+	AppID       int32
+	AccessToken string
+	Code        string
+}
+
+// VerifyMFARequest completes a login that returned an MFA token.
+type VerifyMFARequest struct {
+	AppID    int32
+	MFAToken string
+	Code     string
+	Client   ClientInfo
+}
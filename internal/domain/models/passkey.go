@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential a user registered to log in without a
+// password.
+type Passkey struct {
+	ID     int64
+	UserID int64
+	// CredentialID is the id the authenticator knows the credential by.
+	CredentialID []byte
+	// PublicKey is the credential's COSE_Key.
+	PublicKey []byte
+	// SignCount is the last signature counter seen, used to detect cloned
+	// authenticators. Synced passkeys keep it at zero.
+	SignCount  uint32
+	Transports []string
+	AAGUID     []byte
+	// BackupEligible and BackedUp tell whether the passkey is synced
+	// between devices.
+	BackupEligible bool
+	BackedUp       bool
+	CreatedAt      time.Time
+	LastUsedAt     *time.Time
+}
+
+// WebAuthnCeremony tells what a challenge was issued for.
+type WebAuthnCeremony string
+
+const (
+	CeremonyRegistration   WebAuthnCeremony = "registration"
+	CeremonyAuthentication WebAuthnCeremony = "authentication"
+)
+
+// WebAuthnChallenge is the server side state of a passkey ceremony between
+// its begin and finish calls. It can be used once.
+type WebAuthnChallenge struct {
+	ID string
+	// UserID is the user registering a passkey; zero for logins, where the
+	// passkey tells who the user is.
+	UserID    int64
+	AppID     int
+	Ceremony  WebAuthnCeremony
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+// PasskeyCeremony is what the client needs to run a ceremony.
+type PasskeyCeremony struct {
+	// ChallengeID is sent back with the authenticator's response.
+	ChallengeID string
+	// Options is the JSON form of the options to pass to the browser.
+	Options []byte
+}
+
+// BeginPasskeyRegistrationRequest starts adding a passkey to the account.
+// The password is asked again, like for other changes to how the account
+// logs in.
+type BeginPasskeyRegistrationRequest struct {
+	AppID       int32
+	AccessToken string
+	Password    string
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	AppID       int32
+	AccessToken string
+	ChallengeID string
+	// Credential is the JSON form of the created credential.
+	Credential []byte
+}
+
+type BeginPasskeyLoginRequest struct {
+	AppID int32
+}
+
+type FinishPasskeyLoginRequest struct {
+	AppID       int32
+	ChallengeID string
+	// Credential is the JSON form of the assertion.
+	Credential []byte
+	Client     ClientInfo
+}
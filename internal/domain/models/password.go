@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PreviousPassword is a hash a user's password was replaced from, kept so
+// that it cannot be chosen again too soon.
+type PreviousPassword struct {
+	Hash      []byte
+	Algo      PasswordAlgorithm
+	CreatedAt time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is a login of a user into an app. Every token pair carries the ID
+// of the session it was issued for, so revoking the session stops its
+// refresh token from being renewed.
+type Session struct {
+	ID        string
+	UserID    int64
+	AppID     int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// RevokedAt is nil while the session is active.
+	RevokedAt *time.Time
+}
+
+// Active reports whether the session can still be used at the given moment.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
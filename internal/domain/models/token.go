@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// TokenPurpose scopes a one-time token to the flow that issued it,
+// so a code sent for one purpose can never be redeemed for another.
+type TokenPurpose string
+
+const (
+	PurposeEmailVerification TokenPurpose = "email_verification"
+	PurposePasswordReset     TokenPurpose = "password_reset"
+	PurposeEmailChange       TokenPurpose = "email_change"
+	PurposeEmailChangeUndo   TokenPurpose = "email_change_undo"
+	PurposeAccountRestore    TokenPurpose = "account_restore"
+	PurposeInvitation        TokenPurpose = "invitation"
+	// PurposeMFAChallenge is the token Login issues to users with a second
+	// factor. Its payload is the id of the app the user logs in to, with
+	// ":passkey" appended when the login began with a passkey.
+	PurposeMFAChallenge TokenPurpose = "mfa_challenge"
+)
+
+// OneTimeToken is a single-use token persisted by the repository.
+// Only the hash of the token is stored; the plain value is delivered
+// to the user and never kept at rest.
+type OneTimeToken struct {
+	ID      int64
+	UserID  int64
+	Purpose TokenPurpose
+	Hash    []byte
+	// Payload carries flow specific data, such as the address an email
+	// change switches to.
+	Payload   string
+	ExpiresAt time.Time
+}
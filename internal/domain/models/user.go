@@ -4,6 +4,47 @@ import (
 	"time"
 )
 
+// UserStatus is the lifecycle state of an account.
+type UserStatus string
+
+const (
+	// StatusActive accounts can log in.
+	StatusActive UserStatus = "active"
+	// StatusPendingVerification accounts have not confirmed their email yet.
+	// They can only log in to apps that allow unverified users.
+	StatusPendingVerification UserStatus = "pending_verification"
+	// StatusDisabled accounts were switched off by an admin.
+	StatusDisabled UserStatus = "disabled"
+	// StatusInvited accounts were created by an admin and wait for the
+	// invitee to choose a password.
+	StatusInvited UserStatus = "invited"
+	// StatusDeleted accounts are waiting for the purge job.
+	StatusDeleted UserStatus = "deleted"
+)
+
+// Valid reports whether s is one of the known lifecycle states.
+func (s UserStatus) Valid() bool {
+	switch s {
+	case StatusActive, StatusPendingVerification, StatusInvited, StatusDisabled, StatusDeleted:
+		return true
+	}
+	return false
+}
+
+// PasswordAlgorithm names the scheme a stored password hash was made with.
+type PasswordAlgorithm string
+
+const (
+	// AlgoArgon2id is the native scheme; every other one is upgraded to it on login.
+	AlgoArgon2id PasswordAlgorithm = "argon2id"
+	// AlgoBcrypt hashes were made by earlier versions of the service.
+	AlgoBcrypt PasswordAlgorithm = "bcrypt"
+	// AlgoPBKDF2SHA256 hashes imported from legacy systems.
+	AlgoPBKDF2SHA256 PasswordAlgorithm = "pbkdf2-sha256"
+	// AlgoSaltedSHA1 hashes imported from legacy systems.
+	AlgoSaltedSHA1 PasswordAlgorithm = "sha1-salted"
+)
+
 // User represents a user entity in the SSO system.
 // A User contains authentication credentials and profile information
 // required for the single sign-on process.
@@ -18,16 +59,68 @@ type User struct {
 	// This field is required and must be unique across the system.
 	Email string
 
-	// PassHash contains the bcrypt hash of the user's password.
+	// EmailCanonical is the identity key derived from Email by the deployment's
+	// email policy. Two accounts can never share it.
+	EmailCanonical string
+
+	// Username is the user's optional handle, stored lowercased without the "@".
+	// It can be used instead of Email to log in. Empty when not set.
+	Username string
+
+	// PassHash contains the hash of the user's password.
 	// The original password is never stored in plain text.
 	PassHash []byte
 
+	// PassAlgo is the scheme PassHash was made with. Imported users may
+	// carry a legacy scheme until their first successful login.
+	PassAlgo PasswordAlgorithm
+
 	// IsAdmin indicates whether the user has administrative privileges.
 	// Admin users can access restricted endpoints and perform system operations.
 	IsAdmin bool
+
+	// Status is the lifecycle state of the account; it gates Login, token
+	// refresh and every authenticated call.
+	Status UserStatus
+
+	// EmailVerified reports whether the user has confirmed ownership
+	// of Email through a verification code.
+	EmailVerified bool
+
+	// DisplayName is the name shown to other users. It may be empty.
+	DisplayName string
+
+	// Locale is the user's preferred language tag, e.g. "en" or "pt-BR".
+	Locale string
+
+	// AvatarURL points to the user's picture. It may be empty.
+	AvatarURL string
+
 	// CreatedAt is the timestamp when the user account was created.
 	CreatedAt time.Time
 
 	// UpdatedAt is the timestamp of the last user profile update.
 	UpdatedAt time.Time
+
+	// LastLoginAt is the time of the user's last successful login, if any.
+	LastLoginAt *time.Time
+
+	// PasswordChangedAt is when the user last chose a password.
+	PasswordChangedAt time.Time
+
+	// PasswordBreached is set when the user's current password was found
+	// in a breach corpus and accepted anyway.
+	PasswordBreached bool
+
+	// DeletedAt is set once the user asked to delete their account.
+	// The account is purged when the grace period after it runs out.
+	DeletedAt *time.Time
+}
+
+// ProfileUpdate lists the profile fields to change; nil fields are left as is.
+type ProfileUpdate struct {
+	Username    *string
+	DisplayName *string
+	Locale      *string
+	AvatarURL   *string
 }
@@ -0,0 +1,46 @@
+package domain
+
+import "strings"
+
+// PasswordRule names a rule of the password policy.
+type PasswordRule string
+
+const (
+	PasswordRuleMinLength  PasswordRule = "min_length"
+	PasswordRuleMaxLength  PasswordRule = "max_length"
+	PasswordRuleUpper      PasswordRule = "require_upper"
+	PasswordRuleLower      PasswordRule = "require_lower"
+	PasswordRuleDigit      PasswordRule = "require_digit"
+	PasswordRuleSymbol     PasswordRule = "require_symbol"
+	PasswordRuleBannedWord PasswordRule = "banned_word"
+	PasswordRuleEmailLocal PasswordRule = "contains_email"
+	PasswordRuleEntropy    PasswordRule = "min_entropy"
+	PasswordRuleBreached   PasswordRule = "breached"
+	PasswordRuleReused     PasswordRule = "reused"
+)
+
+// PasswordViolation is one rule a password breaks, with a message that can
+// be shown to the user.
+type PasswordViolation struct {
+	Rule        PasswordRule
+	Description string
+}
+
+// PasswordPolicyError lists every rule a password breaks. It wraps
+// ErrWrongPasswordFormat, so callers that only need to know the password
+// was refused can keep using errors.Is.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	descriptions := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		descriptions = append(descriptions, v.Description)
+	}
+	return ErrWrongPasswordFormat.Error() + ": " + strings.Join(descriptions, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWrongPasswordFormat
+}
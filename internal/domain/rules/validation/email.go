@@ -6,16 +6,11 @@ import (
 )
 
 func ValidateEmail(email string) error {
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+	// Internationalized top-level domains only pass once converted to punycode
+	// by NormalizeEmail.
+	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.([a-zA-Z]{2,}|xn--[a-zA-Z0-9-]+)$`)
 	if !emailRegex.MatchString(email) {
 		return errors.New("invalid email format")
 	}
 	return nil
 }
-
-func ValidatePassword(password string) error {
-	if len(password) < 8 {
-		return errors.New("password must be at least 8 characters")
-	}
-	return nil
-}
@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"golang.org/x/net/idna"
+)
+
+// EmailPolicy tunes how emails are canonicalized for identity comparisons.
+type EmailPolicy struct {
+	// StripPlusTag drops the "+tag" suffix of the local part, so that
+	// "bob+news@x.com" and "bob@x.com" are the same identity.
+	StripPlusTag bool
+}
+
+// NormalizeEmail returns the stored form of an address: trimmed, lowercased,
+// and with an internationalized domain converted to ASCII (punycode).
+// It returns domain.ErrWrongEmailFormat if the domain is not a valid IDN.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", domain.ErrWrongEmailFormat
+	}
+	host, err := idna.Lookup.ToASCII(email[at+1:])
+	if err != nil {
+		return "", domain.ErrWrongEmailFormat
+	}
+	return strings.ToLower(email[:at]) + "@" + host, nil
+}
+
+// NormalizeDomain returns the stored form of an email domain such as
+// "@OurCorp.com": without the leading "@", lowercased and in ASCII.
+// It returns domain.ErrInvalidEmailDomain for anything that is not a
+// dotted host name.
+func NormalizeDomain(emailDomain string) (string, error) {
+	emailDomain = strings.TrimPrefix(strings.TrimSpace(emailDomain), "@")
+	host, err := idna.Lookup.ToASCII(emailDomain)
+	if err != nil || !strings.Contains(host, ".") || strings.ContainsAny(host, "@ ") {
+		return "", domain.ErrInvalidEmailDomain
+	}
+	return host, nil
+}
+
+// EmailDomain returns the domain of a normalized address.
+func EmailDomain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
+
+// CanonicalEmail returns the identity key of a normalized address. Two
+// addresses with the same key cannot belong to different accounts.
+func CanonicalEmail(email string, policy EmailPolicy) string {
+	if !policy.StripPlusTag {
+		return email
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, _, _ := strings.Cut(email[:at], "+")
+	if local == "" {
+		return email
+	}
+	return local + email[at:]
+}
@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: "bob@x.com", want: "bob@x.com"},
+		{name: "  Bob@X.com ", want: "bob@x.com"},
+		{name: "user@Bücher.example", want: "user@xn--bcher-kva.example"},
+		{name: "user@пример.рф", want: "user@xn--e1afmkfd.xn--p1ai"},
+		{name: "no-at-sign", wantErr: domain.ErrWrongEmailFormat},
+		{name: "@x.com", wantErr: domain.ErrWrongEmailFormat},
+		{name: "bob@", wantErr: domain.ErrWrongEmailFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeEmail() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		email  string
+		policy EmailPolicy
+		want   string
+	}{
+		{email: "bob+news@x.com", policy: EmailPolicy{}, want: "bob+news@x.com"},
+		{email: "bob+news@x.com", policy: EmailPolicy{StripPlusTag: true}, want: "bob@x.com"},
+		{email: "bob+a+b@x.com", policy: EmailPolicy{StripPlusTag: true}, want: "bob@x.com"},
+		{email: "bob@x.com", policy: EmailPolicy{StripPlusTag: true}, want: "bob@x.com"},
+		{email: "+tag@x.com", policy: EmailPolicy{StripPlusTag: true}, want: "+tag@x.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if got := CanonicalEmail(tt.email, tt.policy); got != tt.want {
+				t.Errorf("CanonicalEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: "ourcorp.com", want: "ourcorp.com"},
+		{name: " @OurCorp.com", want: "ourcorp.com"},
+		{name: "Bücher.example", want: "xn--bcher-kva.example"},
+		{name: "localhost", wantErr: domain.ErrInvalidEmailDomain},
+		{name: "bob@ourcorp.com", wantErr: domain.ErrInvalidEmailDomain},
+		{name: "", wantErr: domain.ErrInvalidEmailDomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeDomain(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeDomain() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
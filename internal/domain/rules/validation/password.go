@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+// minEmailLocalLen is the shortest email local part that is banned from
+// passwords; shorter ones would reject too many unrelated passwords.
+const minEmailLocalLen = 3
+
+// PasswordPolicy decides which passwords users may choose. Lengths are in
+// characters; zero values disable a rule.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// BannedWords may not appear anywhere in a password, whatever the case.
+	BannedWords []string
+	// MinEntropy is the lowest PasswordEntropy score accepted, in bits.
+	MinEntropy float64
+}
+
+// DefaultPasswordPolicy only asks for 8 to 128 characters.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinLength: 8, MaxLength: 128}
+}
+
+// Validate checks password against every rule of the policy and against the
+// local part of the owner's email, when known. It returns a
+// *domain.PasswordPolicyError listing all the rules the password breaks.
+func (p PasswordPolicy) Validate(password, email string) error {
+	var violations []domain.PasswordViolation
+	add := func(rule domain.PasswordRule, format string, args ...any) {
+		violations = append(violations, domain.PasswordViolation{Rule: rule, Description: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(domain.PasswordRuleMinLength, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(domain.PasswordRuleMaxLength, "password must be at most %d characters", p.MaxLength)
+	}
+
+	classes := passwordClasses(password)
+	if p.RequireUpper && !classes.upper {
+		add(domain.PasswordRuleUpper, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !classes.lower {
+		add(domain.PasswordRuleLower, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !classes.digit {
+		add(domain.PasswordRuleDigit, "password must contain a digit")
+	}
+	if p.RequireSymbol && !classes.symbol {
+		add(domain.PasswordRuleSymbol, "password must contain a symbol")
+	}
+
+	lower := strings.ToLower(password)
+	for _, word := range p.BannedWords {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(lower, word) {
+			add(domain.PasswordRuleBannedWord, "password must not contain %q", word)
+		}
+	}
+	if local := emailLocalPart(email); utf8.RuneCountInString(local) >= minEmailLocalLen && strings.Contains(lower, local) {
+		add(domain.PasswordRuleEmailLocal, "password must not contain your email address")
+	}
+
+	if p.MinEntropy > 0 && PasswordEntropy(password) < p.MinEntropy {
+		add(domain.PasswordRuleEntropy, "password is too easy to guess")
+	}
+
+	if len(violations) > 0 {
+		return &domain.PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// PasswordEntropy estimates the strength of a password in bits as the
+// number of characters times log2 of the alphabet they are drawn from.
+// Characters repeating or continuing a run of the previous one ("aaa",
+// "abc", "321") are not counted, so padding does not inflate the score.
+func PasswordEntropy(password string) float64 {
+	classes := passwordClasses(password)
+	pool := 0
+	if classes.lower {
+		pool += 26
+	}
+	if classes.upper {
+		pool += 26
+	}
+	if classes.digit {
+		pool += 10
+	}
+	if classes.symbol {
+		pool += 33
+	}
+	if classes.other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	effective := 0
+	prev := rune(-10)
+	for _, r := range password {
+		if d := r - prev; d < -1 || d > 1 {
+			effective++
+		}
+		prev = r
+	}
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+type charClasses struct {
+	upper, lower, digit, symbol, other bool
+}
+
+func passwordClasses(password string) charClasses {
+	var c charClasses
+	for _, r := range password {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			c.symbol = true
+		case unicode.IsUpper(r):
+			c.upper, c.other = true, true
+		case unicode.IsLower(r):
+			c.lower, c.other = true, true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// emailLocalPart returns the lowercased local part of an address without
+// its "+tag", or "" for an empty email.
+func emailLocalPart(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return ""
+	}
+	local, _, _ := strings.Cut(email[:at], "+")
+	return strings.ToLower(local)
+}
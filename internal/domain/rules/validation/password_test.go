@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	t.Parallel()
+	strict := PasswordPolicy{
+		MinLength:     10,
+		MaxLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		BannedWords:   []string{"Acme"},
+	}
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		email    string
+		want     []domain.PasswordRule
+	}{
+		{name: "default accepts 8 characters", policy: DefaultPasswordPolicy(), password: "abcdefgh"},
+		{name: "default rejects 7 characters", policy: DefaultPasswordPolicy(), password: "abcdefg", want: []domain.PasswordRule{domain.PasswordRuleMinLength}},
+		{name: "length counts characters", policy: PasswordPolicy{MinLength: 4}, password: "пароль"},
+		{name: "strict accepts", policy: strict, password: "Tr0ub4dor&3x"},
+		{name: "too long", policy: strict, password: "Tr0ub4dor&3xTr0ub4dor&3x", want: []domain.PasswordRule{domain.PasswordRuleMaxLength}},
+		{
+			name: "every class missing", policy: strict, password: "          ",
+			want: []domain.PasswordRule{domain.PasswordRuleUpper, domain.PasswordRuleLower, domain.PasswordRuleDigit},
+		},
+		{name: "banned word ignores case", policy: strict, password: "aCME-Rocket9", want: []domain.PasswordRule{domain.PasswordRuleBannedWord}},
+		{name: "email local part", policy: DefaultPasswordPolicy(), password: "xxBobby2024", email: "bobby+news@x.com", want: []domain.PasswordRule{domain.PasswordRuleEmailLocal}},
+		{name: "short local part is ignored", policy: DefaultPasswordPolicy(), password: "jo-jo-jo-jo", email: "jo@x.com"},
+		{name: "low entropy", policy: PasswordPolicy{MinEntropy: 40}, password: "aaaaaaaaaaaaaaaa", want: []domain.PasswordRule{domain.PasswordRuleEntropy}},
+		{name: "enough entropy", policy: PasswordPolicy{MinEntropy: 40}, password: "kq7#Vm2!pZ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password, tt.email)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, domain.ErrWrongPasswordFormat) {
+				t.Fatalf("Validate() error = %v, want %v", err, domain.ErrWrongPasswordFormat)
+			}
+			var policyErr *domain.PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("Validate() error = %T, want *domain.PasswordPolicyError", err)
+			}
+			var got []domain.PasswordRule
+			for _, v := range policyErr.Violations {
+				got = append(got, v.Rule)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		password string
+		min, max float64
+	}{
+		{password: "", min: 0, max: 0},
+		{password: "aaaaaaaaaaaa", min: 4, max: 5},
+		{password: "abcdefghijkl", min: 4, max: 5},
+		{password: "kq7#Vm2!pZ", min: 60, max: 70},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			if got := PasswordEntropy(tt.password); got < tt.min || got > tt.max {
+				t.Errorf("PasswordEntropy() = %.1f, want between %.0f and %.0f", got, tt.min, tt.max)
+			}
+		})
+	}
+}
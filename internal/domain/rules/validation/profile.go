@@ -0,0 +1,48 @@
+package validation
+
+import (
+	"net/url"
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+const maxDisplayNameLen = 64
+
+var localeRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z][a-z]{3})?(-([A-Z]{2}|[0-9]{3}))?$`)
+
+// ValidateDisplayName accepts empty names and up to 64 printable characters.
+func ValidateDisplayName(name string) error {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxDisplayNameLen {
+		return domain.ErrInvalidDisplayName
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return domain.ErrInvalidDisplayName
+		}
+	}
+	return nil
+}
+
+// ValidateLocale accepts an empty locale or a language tag made of a language,
+// an optional script and an optional region, e.g. "en", "zh-Hant" or "pt-BR".
+func ValidateLocale(locale string) error {
+	if locale != "" && !localeRegex.MatchString(locale) {
+		return domain.ErrInvalidLocale
+	}
+	return nil
+}
+
+// ValidateAvatarURL accepts an empty URL or an absolute https URL.
+func ValidateAvatarURL(avatarURL string) error {
+	if avatarURL == "" {
+		return nil
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return domain.ErrInvalidAvatarURL
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+func TestValidateDisplayName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "", want: nil},
+		{name: "Ada Lovelace", want: nil},
+		{name: "Лев Толстой", want: nil},
+		{name: strings.Repeat("a", 64), want: nil},
+		{name: strings.Repeat("a", 65), want: domain.ErrInvalidDisplayName},
+		{name: "tab\tname", want: domain.ErrInvalidDisplayName},
+		{name: "\xff", want: domain.ErrInvalidDisplayName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateDisplayName(tt.name); !errors.Is(got, tt.want) {
+				t.Errorf("ValidateDisplayName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "", want: nil},
+		{name: "en", want: nil},
+		{name: "pt-BR", want: nil},
+		{name: "zh-Hant-TW", want: nil},
+		{name: "es-419", want: nil},
+		{name: "EN", want: domain.ErrInvalidLocale},
+		{name: "en_US", want: domain.ErrInvalidLocale},
+		{name: "english", want: domain.ErrInvalidLocale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateLocale(tt.name); !errors.Is(got, tt.want) {
+				t.Errorf("ValidateLocale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAvatarURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "", want: nil},
+		{name: "https://cdn.example.com/a.png", want: nil},
+		{name: "http://cdn.example.com/a.png", want: domain.ErrInvalidAvatarURL},
+		{name: "javascript:alert(1)", want: domain.ErrInvalidAvatarURL},
+		{name: "/relative.png", want: domain.ErrInvalidAvatarURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateAvatarURL(tt.name); !errors.Is(got, tt.want) {
+				t.Errorf("ValidateAvatarURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+var usernameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{2,31}$`)
+
+// reservedUsernames cannot be registered because they could be mistaken
+// for the service or its staff.
+var reservedUsernames = map[string]struct{}{
+	"admin": {}, "administrator": {}, "root": {}, "system": {}, "support": {},
+	"help": {}, "security": {}, "staff": {}, "moderator": {}, "official": {},
+	"sso": {}, "auth": {}, "api": {}, "www": {}, "mail": {}, "noreply": {},
+	"no_reply": {}, "postmaster": {}, "abuse": {}, "null": {}, "undefined": {},
+	"me": {}, "everyone": {}, "here": {}, "all": {},
+}
+
+// NormalizeUsername returns the canonical form of a handle:
+// without the leading "@" and lowercased.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(username, "@"))
+}
+
+// ValidateUsername checks a normalized username: 3 to 32 characters of
+// lowercase latin letters, digits and underscores, starting with a letter,
+// and not a reserved word.
+func ValidateUsername(username string) error {
+	if !usernameRegex.MatchString(username) {
+		return domain.ErrWrongUsernameFormat
+	}
+	if _, ok := reservedUsernames[username]; ok {
+		return domain.ErrUsernameReserved
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+)
+
+func TestValidateUsername(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want error
+	}{
+		{name: "nick", want: nil},
+		{name: "nick_42", want: nil},
+		{name: "abc", want: nil},
+		{name: "ab", want: domain.ErrWrongUsernameFormat},
+		{name: "42nick", want: domain.ErrWrongUsernameFormat},
+		{name: "Nick", want: domain.ErrWrongUsernameFormat},
+		{name: "nick.name", want: domain.ErrWrongUsernameFormat},
+		{name: "nick@example.com", want: domain.ErrWrongUsernameFormat},
+		{name: "abcdefghijklmnopqrstuvwxyz0123456", want: domain.ErrWrongUsernameFormat},
+		{name: "admin", want: domain.ErrUsernameReserved},
+		{name: "support", want: domain.ErrUsernameReserved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateUsername(tt.name); !errors.Is(got, tt.want) {
+				t.Errorf("ValidateUsername() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	t.Parallel()
+	if got := NormalizeUsername("@Nick_42"); got != "nick_42" {
+		t.Errorf("NormalizeUsername() = %q, want %q", got, "nick_42")
+	}
+}
@@ -20,6 +20,7 @@ func TestValidEmails(t *testing.T) {
 		{name: "test@io-epam.com", want: nil},
 		{name: "test-io@epam-usa.com", want: nil},
 		{name: "123456789testio@epam2.com", want: nil},
+		{name: "user@xn--e1afmkfd.xn--p1ai", want: nil},
 	}
 	for _, tt := range validEmails {
 		t.Run(tt.name, func(t *testing.T) {
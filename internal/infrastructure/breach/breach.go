@@ -0,0 +1,101 @@
+// Package breach tells whether a password appears in a known breach corpus,
+// without calling any external API.
+//
+// Corpora are loaded from one of two local files:
+//
+//   - a HIBP-style hash list: one upper- or lowercase hex SHA-1 per line,
+//     optionally followed by ":<count>", as in the "ordered by hash"
+//     Pwned Passwords download. Every hash is kept in memory.
+//   - a bloom filter built from such a list by cmd/breachfilter, for corpora
+//     too large to hold in memory. It has no false negatives and a false
+//     positive rate chosen when it is built.
+package breach
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var ErrMalformedList = errors.New("malformed hash list")
+
+// Checker reports whether a password is known to be breached.
+type Checker interface {
+	Breached(password string) bool
+}
+
+// None is the Checker used when no corpus is configured; it knows of no
+// breached password.
+type None struct{}
+
+func (None) Breached(string) bool { return false }
+
+// Load reads the corpus at path, telling a bloom filter from a hash list by
+// its header.
+func Load(path string) (Checker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, err := r.Peek(len(filterMagic))
+	if err == nil && bytes.Equal(header, []byte(filterMagic)) {
+		return ReadFilter(r)
+	}
+	return ReadList(r)
+}
+
+// List is an in-memory set of SHA-1 hashes.
+type List struct {
+	hashes [][sha1.Size]byte
+}
+
+// ReadList parses a HIBP-style hash list. Blank lines are skipped.
+func ReadList(r io.Reader) (*List, error) {
+	l := &List{}
+	err := ScanHashes(r, func(hash [sha1.Size]byte) {
+		l.hashes = append(l.hashes, hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(l.hashes, func(a, b [sha1.Size]byte) int { return bytes.Compare(a[:], b[:]) })
+	return l, nil
+}
+
+func (l *List) Breached(password string) bool {
+	_, found := slices.BinarySearchFunc(l.hashes, sha1.Sum([]byte(password)), func(a, b [sha1.Size]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	return found
+}
+
+// ScanHashes calls fn with every hash of a HIBP-style hash list.
+func ScanHashes(r io.Reader, fn func(hash [sha1.Size]byte)) error {
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		text, _, _ = strings.Cut(text, ":")
+		var hash [sha1.Size]byte
+		if len(text) != hex.EncodedLen(sha1.Size) {
+			return fmt.Errorf("line %d: %w", line, ErrMalformedList)
+		}
+		if _, err := hex.Decode(hash[:], []byte(text)); err != nil {
+			return fmt.Errorf("line %d: %w", line, ErrMalformedList)
+		}
+		fn(hash)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,110 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func hashLine(password string, count int) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:])) + fmt.Sprintf(":%d", count)
+}
+
+func TestReadList(t *testing.T) {
+	list := strings.Join([]string{hashLine("password", 9545824), "", hashLine("123456", 37359195)}, "\n")
+	l, err := ReadList(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for password, want := range map[string]bool{"password": true, "123456": true, "correct horse": false} {
+		if got := l.Breached(password); got != want {
+			t.Errorf("Breached(%q) = %v, want %v", password, got, want)
+		}
+	}
+
+	_, err = ReadList(strings.NewReader("not-a-hash:1\n"))
+	if !errors.Is(err, ErrMalformedList) {
+		t.Errorf("ReadList() error = %v, want %v", err, ErrMalformedList)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(1000, 0.001)
+	for i := range 1000 {
+		f.Add(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))))
+	}
+	for i := range 1000 {
+		if !f.Breached(fmt.Sprintf("breached-%d", i)) {
+			t.Fatalf("Breached(breached-%d) = false, want true", i)
+		}
+	}
+	falsePositives := 0
+	for i := range 10000 {
+		if f.Breached(fmt.Sprintf("fresh-%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("%d false positives out of 10000, want about 10", falsePositives)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadFilter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.Breached("breached-42") {
+		t.Error("Breached() after ReadFilter = false, want true")
+	}
+
+	if _, err := ReadFilter(strings.NewReader("SSOBLM1\n\x00")); !errors.Is(err, ErrMalformedFilter) {
+		t.Errorf("ReadFilter() error = %v, want %v", err, ErrMalformedFilter)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "pwned.txt")
+	if err := os.WriteFile(listPath, []byte(hashLine("password", 1)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFilter(1, 0.01)
+	f.Add(sha1.Sum([]byte("letmein")))
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	filterPath := filepath.Join(dir, "pwned.bloom")
+	if err := os.WriteFile(filterPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		password string
+	}{
+		{path: listPath, password: "password"},
+		{path: filterPath, password: "letmein"},
+	}
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			c, err := Load(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.Breached(tt.password) {
+				t.Errorf("Breached(%q) = false, want true", tt.password)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// filterMagic starts every serialized Filter, followed by the number of
+// hash functions and the number of bits as big-endian uint32 and uint64,
+// then the bits themselves.
+const filterMagic = "SSOBLM1\n"
+
+// chunkSize is the buffer used to stream filter bits, a multiple of 8.
+const chunkSize = 64 << 10
+
+// maxFilterBits caps the size of a filter read from disk at 8 GiB.
+const maxFilterBits = 1 << 36
+
+var ErrMalformedFilter = errors.New("malformed bloom filter")
+
+// Filter is a bloom filter over SHA-1 hashes. Since the hashes are already
+// uniformly distributed, its k probes are derived from the hash itself by
+// double hashing instead of hashing again.
+type Filter struct {
+	k    uint32
+	bits []uint64
+	m    uint64
+}
+
+// NewFilter sizes a filter for n hashes with false positive rate p.
+func NewFilter(n uint64, p float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return newFilter(k, m)
+}
+
+func newFilter(k uint32, m uint64) *Filter {
+	m = (m + 63) / 64 * 64
+	return &Filter{k: k, m: m, bits: make([]uint64, m/64)}
+}
+
+// Add inserts a SHA-1 hash.
+func (f *Filter) Add(hash [sha1.Size]byte) {
+	h1, h2 := probes(hash)
+	for i := range uint64(f.k) {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether the hash may have been added.
+func (f *Filter) Contains(hash [sha1.Size]byte) bool {
+	h1, h2 := probes(hash)
+	for i := range uint64(f.k) {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) Breached(password string) bool {
+	return f.Contains(sha1.Sum([]byte(password)))
+}
+
+func probes(hash [sha1.Size]byte) (h1, h2 uint64) {
+	h1 = binary.BigEndian.Uint64(hash[0:8])
+	// An odd step never cycles back early, whatever the filter size.
+	h2 = binary.BigEndian.Uint64(hash[8:16]) | 1
+	return h1, h2
+}
+
+// WriteTo serializes the filter for ReadFilter.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 0, len(filterMagic)+12)
+	header = append(header, filterMagic...)
+	header = binary.BigEndian.AppendUint32(header, f.k)
+	header = binary.BigEndian.AppendUint64(header, f.m)
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	written := int64(n)
+	buf := make([]byte, 0, chunkSize)
+	for i, word := range f.bits {
+		buf = binary.BigEndian.AppendUint64(buf, word)
+		if len(buf) == cap(buf) || i == len(f.bits)-1 {
+			n, err := w.Write(buf)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			buf = buf[:0]
+		}
+	}
+	return written, nil
+}
+
+// ReadFilter deserializes a filter written by WriteTo.
+func ReadFilter(r io.Reader) (*Filter, error) {
+	header := make([]byte, len(filterMagic)+12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrMalformedFilter
+	}
+	if string(header[:len(filterMagic)]) != filterMagic {
+		return nil, ErrMalformedFilter
+	}
+	k := binary.BigEndian.Uint32(header[len(filterMagic):])
+	m := binary.BigEndian.Uint64(header[len(filterMagic)+4:])
+	if k == 0 || m == 0 || m%64 != 0 || m > maxFilterBits {
+		return nil, ErrMalformedFilter
+	}
+	f := newFilter(k, m)
+	// Words are decoded chunk by chunk so that a large filter is never
+	// held twice in memory.
+	buf := make([]byte, chunkSize)
+	for i := 0; i < len(f.bits); {
+		chunk := buf[:min(len(buf), (len(f.bits)-i)*8)]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, ErrMalformedFilter
+		}
+		for off := 0; off < len(chunk); off += 8 {
+			f.bits[i] = binary.BigEndian.Uint64(chunk[off:])
+			i++
+		}
+	}
+	return f, nil
+}
@@ -13,8 +13,12 @@ import (
 type CustomClaims struct {
 	UID       int64  `json:"uid"`
 	Email     string `json:"email"`
-	TokenType string `json:"type"` // "access" or "refresh"
+	TokenType string `json:"type"` // "access", "refresh" or the scope of a scoped token
 	AppID     int    `json:"app_id"`
+	SessionID string `json:"sid"`
+	// Name and Locale are only set for apps that opted in to profile claims.
+	Name   string `json:"name,omitempty"`
+	Locale string `json:"locale,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -55,7 +59,7 @@ func (a *Adapter) RenewAccessToken(oldRefresh string, user models.User, app mode
 		return "", domain.ErrTokenExpired
 	}
 
-	refresh, err := generateToken("access", user, app, a.TokenTTL)
+	refresh, err := generateToken("access", user, app, claims.SessionID, a.TokenTTL)
 	if err != nil {
 		return "", err
 	}
@@ -63,14 +67,15 @@ func (a *Adapter) RenewAccessToken(oldRefresh string, user models.User, app mode
 	return refresh, nil
 }
 
-func (a *Adapter) GenerateTokenPair(user models.User, app models.App) (access, refresh string, err error) {
+// GenerateTokenPair issues an access and a refresh token bound to sessionID.
+func (a *Adapter) GenerateTokenPair(user models.User, app models.App, sessionID string) (access, refresh string, err error) {
 
-	access, err = generateToken("access", user, app, a.TokenTTL)
+	access, err = generateToken("access", user, app, sessionID, a.TokenTTL)
 
 	if err != nil {
 		return "", "", err
 	}
-	refresh, err = generateToken("refresh", user, app, a.RefTokenTTL)
+	refresh, err = generateToken("refresh", user, app, sessionID, a.RefTokenTTL)
 	if err != nil {
 		return "", "", err
 	}
@@ -78,12 +83,19 @@ func (a *Adapter) GenerateTokenPair(user models.User, app models.App) (access, r
 	return access, refresh, nil
 }
 
-func generateToken(tokenType string, user models.User, app models.App, tokenTTL time.Duration) (string, error) {
+// GenerateScopedToken issues a token of type scope, bound to no session,
+// that only the use cases of that scope accept.
+func (a *Adapter) GenerateScopedToken(scope string, user models.User, app models.App, ttl time.Duration) (string, error) {
+	return generateToken(scope, user, app, "", ttl)
+}
+
+func generateToken(tokenType string, user models.User, app models.App, sessionID string, tokenTTL time.Duration) (string, error) {
 	claims := CustomClaims{
 		UID:       user.ID,
 		Email:     user.Email,
 		TokenType: tokenType,
 		AppID:     app.ID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(tokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
@@ -91,6 +103,10 @@ func generateToken(tokenType string, user models.User, app models.App, tokenTTL
 		},
 	}
 	claims.ExpiresAt = jwt.NewNumericDate(time.Now().UTC().Add(tokenTTL))
+	if app.ProfileClaims {
+		claims.Name = user.DisplayName
+		claims.Locale = user.Locale
+	}
 	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(app.Secret))
 	if err != nil {
 		return "", err
@@ -16,7 +16,7 @@ func TestGenerateTokenPair(t *testing.T) {
 	app := models.App{ID: 7, Secret: "supersecretkey"}
 	a := New(15*time.Minute, 24*time.Hour)
 
-	access, refresh, err := a.GenerateTokenPair(user, app)
+	access, refresh, err := a.GenerateTokenPair(user, app, "session-1")
 	require.NoError(t, err)
 	require.NotEmpty(t, access)
 	require.NotEmpty(t, refresh)
@@ -31,6 +31,7 @@ func TestGenerateTokenPair(t *testing.T) {
 	require.Equal(t, int64(42), claimsA.UID)
 	require.Equal(t, "access", claimsA.TokenType)
 	require.Equal(t, 7, claimsA.AppID)
+	require.Equal(t, "session-1", claimsA.SessionID)
 	require.True(t, parsedA.Valid)
 
 	// Parse and verify refresh token claims
@@ -41,9 +42,30 @@ func TestGenerateTokenPair(t *testing.T) {
 	claimsR, ok := parsedR.Claims.(*CustomClaims)
 	require.True(t, ok)
 	require.Equal(t, "refresh", claimsR.TokenType)
+	require.Equal(t, "session-1", claimsR.SessionID)
 	require.True(t, parsedR.Valid)
 }
 
+func TestGenerateTokenPair_ProfileClaims(t *testing.T) {
+	user := models.User{ID: 42, Email: "user@example.com", DisplayName: "Ada", Locale: "en"}
+	a := New(15*time.Minute, 24*time.Hour)
+
+	for _, profileClaims := range []bool{false, true} {
+		app := models.App{ID: 7, Secret: "supersecretkey", ProfileClaims: profileClaims}
+		access, _, err := a.GenerateTokenPair(user, app, "session-1")
+		require.NoError(t, err)
+		claims, err := a.DecodeTokenWithVerification(access, app.Secret)
+		require.NoError(t, err)
+		if profileClaims {
+			require.Equal(t, "Ada", claims["name"])
+			require.Equal(t, "en", claims["locale"])
+		} else {
+			require.NotContains(t, claims, "name")
+			require.NotContains(t, claims, "locale")
+		}
+	}
+}
+
 func TestDecodeTokenWithVerification_Success(t *testing.T) {
 	// Create a simple MapClaims token
 	a := New(0, 0)
@@ -61,7 +83,7 @@ func TestDecodeTokenWithVerification_Expired(t *testing.T) {
 	a := New(1*time.Nanosecond, 1*time.Nanosecond)
 	user := models.User{ID: 42, Email: "user@example.com"}
 	app := models.App{ID: 7, Secret: "supersecretkey"}
-	token, refresh, err := a.GenerateTokenPair(user, app)
+	token, refresh, err := a.GenerateTokenPair(user, app, "session-1")
 	require.NoError(t, err)
 	_, err = a.DecodeTokenWithVerification(token, app.Secret)
 	assertEqualError(t, domain.ErrTokenExpired, err)
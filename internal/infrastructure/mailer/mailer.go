@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/google/uuid"
+)
+
+// Mailer delivers messages to users.
+type Mailer interface {
+	Send(ctx context.Context, msg models.Message) error
+}
+
+// LogMailer writes every message to the logger instead of delivering it.
+// It is meant for local development.
+type LogMailer struct {
+	log  *slog.Logger
+	from string
+}
+
+func NewLogMailer(log *slog.Logger, from string) *LogMailer {
+	return &LogMailer{log: log, from: from}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg models.Message) error {
+	m.log.Info("mail sent",
+		slog.String("from", m.from),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
+
+// FileMailer drops every message into a directory as an .eml file,
+// so tests and developers can pick up the codes it contains.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	const op = "mailer.NewFileMailer"
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(_ context.Context, msg models.Message) error {
+	const op = "mailer.FileMailer.Send"
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UTC().UnixNano(), uuid.NewString())
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package onetime
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+func TestIssueVerify(t *testing.T) {
+	i := New("secret")
+	code, hash, err := i.Issue(models.PurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	got, err := i.Verify(models.PurposeEmailVerification, code)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !bytes.Equal(got, hash) {
+		t.Errorf("Verify() hash = %x, want %x", got, hash)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	i := New("secret")
+	code, _, err := i.Issue(models.PurposeEmailVerification)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	tampered := "A" + code[1:]
+	if tampered == code {
+		tampered = "B" + code[1:]
+	}
+	tests := []struct {
+		name    string
+		issuer  *Issuer
+		purpose models.TokenPurpose
+		code    string
+	}{
+		{name: "other secret", issuer: New("other"), purpose: models.PurposeEmailVerification, code: code},
+		{name: "other purpose", issuer: i, purpose: "other", code: code},
+		{name: "tampered", issuer: i, purpose: models.PurposeEmailVerification, code: tampered},
+		{name: "no signature", issuer: i, purpose: models.PurposeEmailVerification, code: "abc"},
+		{name: "empty", issuer: i, purpose: models.PurposeEmailVerification, code: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.issuer.Verify(tt.purpose, tt.code); !errors.Is(err, domain.ErrInvalidCode) {
+				t.Errorf("Verify() error = %v, want %v", err, domain.ErrInvalidCode)
+			}
+		})
+	}
+}
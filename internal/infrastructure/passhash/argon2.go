@@ -0,0 +1,173 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// The maxArgon2 limits bound the work a stored argon2id hash can demand on
+// each login, so that an imported hash cannot tie up the server. They are
+// well above the costs OWASP recommends.
+const (
+	maxArgon2Memory      = 1 << 20 // KiB, 1 GiB
+	maxArgon2Time        = 16
+	maxArgon2Parallelism = 16
+)
+
+// Argon2Params are the cost parameters of new argon2id hashes.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Time        uint32
+	Parallelism uint8
+}
+
+// Hasher hashes new passwords with argon2id, peppered with the highest
+// pepper version when any is configured, and verifies hashes of every
+// supported scheme.
+type Hasher struct {
+	params  Argon2Params
+	peppers map[int]Pepper
+	current int
+}
+
+// Validate checks that the parameters are within the limits Verify accepts.
+func (p Argon2Params) Validate() error {
+	if p.Memory == 0 || p.Memory > maxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be between 1 and %d KiB, got %d", maxArgon2Memory, p.Memory)
+	}
+	if p.Time == 0 || p.Time > maxArgon2Time {
+		return fmt.Errorf("argon2 time must be between 1 and %d, got %d", maxArgon2Time, p.Time)
+	}
+	if p.Parallelism == 0 || p.Parallelism > maxArgon2Parallelism {
+		return fmt.Errorf("argon2 parallelism must be between 1 and %d, got %d", maxArgon2Parallelism, p.Parallelism)
+	}
+	return nil
+}
+
+func New(params Argon2Params, peppers []Pepper) *Hasher {
+	h := &Hasher{params: params, peppers: make(map[int]Pepper, len(peppers))}
+	for _, p := range peppers {
+		h.peppers[p.Version] = p
+		h.current = max(h.current, p.Version)
+	}
+	return h
+}
+
+// Hash returns the argon2id hash of password in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<parallelism>[,keyid=<pepper>]$<salt>$<key>.
+func (h *Hasher) Hash(password string) ([]byte, models.PasswordAlgorithm, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, "", err
+	}
+	input := []byte(password)
+	if h.current != 0 {
+		input = h.peppers[h.current].apply(password)
+	}
+	key := argon2.IDKey(input, salt, h.params.Time, h.params.Memory, h.params.Parallelism, argon2KeyLength)
+	return []byte(encodeArgon2(h.params, h.current, salt, key)), models.AlgoArgon2id, nil
+}
+
+// Verify checks password against hash produced by algo. It returns
+// ErrMismatch for a wrong password and ErrUnknownPepper if the hash was
+// peppered with a version that is not configured.
+func (h *Hasher) Verify(algo models.PasswordAlgorithm, hash []byte, password string) error {
+	if algo == models.AlgoArgon2id {
+		return verifyArgon2(hash, password, h.peppers)
+	}
+	return Verify(algo, hash, password)
+}
+
+// NeedsRehash reports whether a stored hash was made with another scheme,
+// weaker parameters or another pepper than Hash currently uses.
+func (h *Hasher) NeedsRehash(algo models.PasswordAlgorithm, hash []byte) bool {
+	if algo != models.AlgoArgon2id {
+		return true
+	}
+	params, pepper, _, _, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+	return pepper != h.current ||
+		params.Memory < h.params.Memory || params.Time < h.params.Time || params.Parallelism < h.params.Parallelism
+}
+
+// encodeArgon2 keeps the pepper version in the keyid parameter the PHC
+// format reserves for it; unpeppered hashes have none.
+func encodeArgon2(params Argon2Params, pepper int, salt, key []byte) string {
+	keyID := ""
+	if pepper != 0 {
+		keyID = fmt.Sprintf(",keyid=%d", pepper)
+	}
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d%s$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Parallelism, keyID,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func parseArgon2(hash []byte) (params Argon2Params, pepper int, salt, key []byte, err error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+	}
+	var keyID string
+	if p, k, ok := strings.Cut(parts[3], ",keyid="); ok {
+		parts[3], keyID = p, k
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+	}
+	if err := params.Validate(); err != nil {
+		return Argon2Params{}, 0, nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	if keyID != "" {
+		if pepper, err = strconv.Atoi(keyID); err != nil || pepper < 1 {
+			return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+		}
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) == 0 {
+		return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, 0, nil, nil, ErrMalformedHash
+	}
+	return params, pepper, salt, key, nil
+}
+
+func verifyArgon2(hash []byte, password string, peppers map[int]Pepper) error {
+	params, version, salt, want, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+	input := []byte(password)
+	if version != 0 {
+		pepper, ok := peppers[version]
+		if !ok {
+			return ErrUnknownPepper
+		}
+		input = pepper.apply(password)
+	}
+	got := argon2.IDKey(input, salt, params.Time, params.Memory, params.Parallelism, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
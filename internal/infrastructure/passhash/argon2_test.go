@@ -0,0 +1,93 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+var testParams = Argon2Params{Memory: 1024, Time: 1, Parallelism: 1}
+
+func TestHasher_HashVerify(t *testing.T) {
+	h := New(testParams, nil)
+	hash, algo, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algo != models.AlgoArgon2id {
+		t.Fatalf("Hash() algo = %q, want %q", algo, models.AlgoArgon2id)
+	}
+	if !strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want PHC string with the configured params", hash)
+	}
+	if err := h.Verify(algo, hash, password); err != nil {
+		t.Errorf("Verify() error = %v, want nil", err)
+	}
+	if err := h.Verify(algo, hash, "wrong"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrMismatch)
+	}
+	if err := Validate(algo, hash); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	h := New(testParams, nil)
+	current, _, err := h.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weaker, _, err := New(Argon2Params{Memory: 512, Time: 1, Parallelism: 1}, nil).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stronger, _, err := New(Argon2Params{Memory: 2048, Time: 2, Parallelism: 1}, nil).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		algo models.PasswordAlgorithm
+		hash []byte
+		want bool
+	}{
+		{name: "current params", algo: models.AlgoArgon2id, hash: current, want: false},
+		{name: "stronger params", algo: models.AlgoArgon2id, hash: stronger, want: false},
+		{name: "weaker params", algo: models.AlgoArgon2id, hash: weaker, want: true},
+		{name: "malformed", algo: models.AlgoArgon2id, hash: []byte("$argon2id$v=19$m=x"), want: true},
+		{name: "bcrypt", algo: models.AlgoBcrypt, hash: []byte("$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"), want: true},
+		{name: "legacy", algo: models.AlgoSaltedSHA1, hash: []byte("s4lt$0d4435dd2dade9a76a31964437d4b8f0681e2ca8"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.NeedsRehash(tt.algo, tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_Argon2(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "wrong variant", hash: "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		{name: "wrong version", hash: "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		{name: "zero memory", hash: "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5"},
+		{name: "too much memory", hash: "$argon2id$v=19$m=4194304,t=1,p=1$c2FsdA$a2V5"},
+		{name: "too many passes", hash: "$argon2id$v=19$m=1024,t=1000,p=1$c2FsdA$a2V5"},
+		{name: "too many lanes", hash: "$argon2id$v=19$m=1024,t=1,p=255$c2FsdA$a2V5"},
+		{name: "bad salt", hash: "$argon2id$v=19$m=1024,t=1,p=1$!!$a2V5"},
+		{name: "missing key", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(models.AlgoArgon2id, []byte(tt.hash)); !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("Validate() error = %v, want %v", err, ErrMalformedHash)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package passhash hashes passwords with argon2id and verifies the hashes
+// of every scheme users may carry, including the ones they were imported
+// with from legacy systems.
+//
+// Supported encodings:
+//
+//	argon2id       $argon2id$v=19$m=...,t=...,p=...[,keyid=<pepper>]$<salt>$<key>  (PHC string)
+//	bcrypt         $2a$10$...                        (standard modular crypt string)
+//	pbkdf2-sha256  pbkdf2_sha256$<iterations>$<salt>$<base64 hash>
+//	sha1-salted    <salt>$<hex sha1(salt + password)>
+//
+// Only argon2id hashes are peppered: the password goes through HMAC-SHA256
+// keyed with the pepper before argon2id, and keyid records the pepper version.
+package passhash
+
+import (
+	"bytes"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPBKDF2Iterations bounds the work an imported PBKDF2 hash can demand
+// on each login. It is well above what Django, the usual source of these
+// hashes, has ever defaulted to.
+const maxPBKDF2Iterations = 2_000_000
+
+var (
+	// ErrMismatch is returned when the password does not match the hash.
+	ErrMismatch = errors.New("password does not match hash")
+	// ErrUnknownAlgorithm is returned for algorithms this package cannot verify.
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	// ErrMalformedHash is returned when a hash is not in its algorithm's encoding.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Verify checks password against hash produced by algo. It returns
+// ErrMismatch for a wrong password. Peppered argon2id hashes can only be
+// verified by a Hasher holding their pepper; Verify returns
+// ErrUnknownPepper for them.
+func Verify(algo models.PasswordAlgorithm, hash []byte, password string) error {
+	switch algo {
+	case models.AlgoArgon2id:
+		return verifyArgon2(hash, password, nil)
+	case models.AlgoBcrypt:
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrMismatch
+			}
+			return fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+		return nil
+	case models.AlgoPBKDF2SHA256:
+		iterations, salt, want, err := parsePBKDF2(hash)
+		if err != nil {
+			return err
+		}
+		got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+		return compare(got, want)
+	case models.AlgoSaltedSHA1:
+		salt, want, err := parseSaltedSHA1(hash)
+		if err != nil {
+			return err
+		}
+		// salt aliases hash, so it must not be appended to.
+		h := sha1.New()
+		h.Write(salt)
+		h.Write([]byte(password))
+		return compare(h.Sum(nil), want)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+	}
+}
+
+// Validate checks that hash is well-formed for algo without verifying any
+// password, so importers can reject bad records up front.
+func Validate(algo models.PasswordAlgorithm, hash []byte) error {
+	switch algo {
+	case models.AlgoArgon2id:
+		_, _, _, _, err := parseArgon2(hash)
+		return err
+	case models.AlgoBcrypt:
+		if _, err := bcrypt.Cost(hash); err != nil {
+			return fmt.Errorf("%w: %v", ErrMalformedHash, err)
+		}
+		return nil
+	case models.AlgoPBKDF2SHA256:
+		_, _, _, err := parsePBKDF2(hash)
+		return err
+	case models.AlgoSaltedSHA1:
+		_, _, err := parseSaltedSHA1(hash)
+		return err
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+	}
+}
+
+func parsePBKDF2(hash []byte) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" || parts[2] == "" {
+		return 0, nil, nil, ErrMalformedHash
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 || iterations > maxPBKDF2Iterations {
+		return 0, nil, nil, ErrMalformedHash
+	}
+	key, err = base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, ErrMalformedHash
+	}
+	return iterations, []byte(parts[2]), key, nil
+}
+
+func parseSaltedSHA1(hash []byte) (salt, digest []byte, err error) {
+	salt, hexDigest, ok := bytes.Cut(hash, []byte("$"))
+	if !ok {
+		return nil, nil, ErrMalformedHash
+	}
+	digest = make([]byte, hex.DecodedLen(len(hexDigest)))
+	if _, err := hex.Decode(digest, hexDigest); err != nil || len(digest) != sha1.Size {
+		return nil, nil, ErrMalformedHash
+	}
+	return salt, digest, nil
+}
+
+func compare(got, want []byte) error {
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package passhash
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const password = "correct horse"
+
+func TestVerify(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		algo     models.PasswordAlgorithm
+		hash     string
+		password string
+		wantErr  error
+	}{
+		{name: "bcrypt", algo: models.AlgoBcrypt, hash: string(bcryptHash), password: password},
+		{name: "bcrypt wrong password", algo: models.AlgoBcrypt, hash: string(bcryptHash), password: "wrong", wantErr: ErrMismatch},
+		{name: "pbkdf2", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$1000$NaCl1234$CWSNiMVTuHI9yCPRXhcWPTEQpddbBAOBo1V3g+mOgu8=", password: password},
+		{name: "pbkdf2 wrong password", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$1000$NaCl1234$CWSNiMVTuHI9yCPRXhcWPTEQpddbBAOBo1V3g+mOgu8=", password: "wrong", wantErr: ErrMismatch},
+		{name: "pbkdf2 bad iterations", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$x$NaCl1234$CWSN", password: password, wantErr: ErrMalformedHash},
+		{name: "pbkdf2 too many iterations", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$2000001$NaCl1234$CWSNiMVTuHI9yCPRXhcWPTEQpddbBAOBo1V3g+mOgu8=", password: password, wantErr: ErrMalformedHash},
+		{name: "salted sha1", algo: models.AlgoSaltedSHA1, hash: "s4lt$0d4435dd2dade9a76a31964437d4b8f0681e2ca8", password: password},
+		{name: "salted sha1 wrong password", algo: models.AlgoSaltedSHA1, hash: "s4lt$0d4435dd2dade9a76a31964437d4b8f0681e2ca8", password: "wrong", wantErr: ErrMismatch},
+		{name: "salted sha1 short digest", algo: models.AlgoSaltedSHA1, hash: "s4lt$0d44", password: password, wantErr: ErrMalformedHash},
+		{name: "unknown algorithm", algo: "md5", hash: "x", password: password, wantErr: ErrUnknownAlgorithm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.algo, []byte(tt.hash), tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify_LeavesHashIntact(t *testing.T) {
+	hash := []byte("s4lt$0d4435dd2dade9a76a31964437d4b8f0681e2ca8")
+	want := string(hash)
+	if err := Verify(models.AlgoSaltedSHA1, hash, "pw"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Verify() error = %v, want ErrMismatch", err)
+	}
+	if string(hash) != want {
+		t.Errorf("Verify() changed the hash to %q", hash)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		algo    models.PasswordAlgorithm
+		hash    string
+		wantErr error
+	}{
+		{name: "bcrypt", algo: models.AlgoBcrypt, hash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{name: "bcrypt garbage", algo: models.AlgoBcrypt, hash: "nope", wantErr: ErrMalformedHash},
+		{name: "pbkdf2 at the iteration limit", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$2000000$salt$CWSN"},
+		{name: "pbkdf2 over the iteration limit", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha256$2000001$salt$CWSN", wantErr: ErrMalformedHash},
+		{name: "pbkdf2 wrong prefix", algo: models.AlgoPBKDF2SHA256, hash: "pbkdf2_sha1$1000$salt$CWSN", wantErr: ErrMalformedHash},
+		{name: "salted sha1 without salt separator", algo: models.AlgoSaltedSHA1, hash: "0d4435dd2dade9a76a31964437d4b8f0681e2ca8", wantErr: ErrMalformedHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.algo, []byte(tt.hash)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package passhash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+// minPepperLength is the shortest pepper accepted, in bytes.
+const minPepperLength = 16
+
+var (
+	// ErrUnknownPepper is returned for hashes peppered with a version that
+	// is not configured, e.g. one retired too early.
+	ErrUnknownPepper = errors.New("unknown pepper version")
+	// ErrInvalidPepper is returned for malformed pepper definitions.
+	ErrInvalidPepper = errors.New("invalid pepper")
+)
+
+// Pepper is a server-side secret mixed into passwords with HMAC-SHA256
+// before they are hashed, so that a database dump alone is not enough to
+// brute-force them. Versions start at 1; hashes record the version they
+// were peppered with.
+type Pepper struct {
+	Version int
+	Key     []byte
+}
+
+// ParsePeppers reads pepper definitions separated by commas or newlines,
+// each "<version>:<base64 secret>". Blank lines and lines starting with
+// "#" are skipped.
+func ParsePeppers(s string) ([]Pepper, error) {
+	var peppers []Pepper
+	seen := make(map[int]bool)
+	for _, def := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		def = strings.TrimSpace(def)
+		if def == "" || strings.HasPrefix(def, "#") {
+			continue
+		}
+		version, secret, ok := strings.Cut(def, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: want <version>:<base64 secret>", ErrInvalidPepper)
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(version))
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("%w: version %q is not a positive integer", ErrInvalidPepper, version)
+		}
+		if seen[v] {
+			return nil, fmt.Errorf("%w: version %d is defined twice", ErrInvalidPepper, v)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, fmt.Errorf("%w: version %d is not base64", ErrInvalidPepper, v)
+		}
+		if len(key) < minPepperLength {
+			return nil, fmt.Errorf("%w: version %d is shorter than %d bytes", ErrInvalidPepper, v, minPepperLength)
+		}
+		seen[v] = true
+		peppers = append(peppers, Pepper{Version: v, Key: key})
+	}
+	return peppers, nil
+}
+
+// ValidatePeppered is Validate that also rejects argon2id hashes peppered
+// with a version missing from peppers, which could never be verified.
+func ValidatePeppered(algo models.PasswordAlgorithm, hash []byte, peppers []Pepper) error {
+	if err := Validate(algo, hash); err != nil {
+		return err
+	}
+	if algo != models.AlgoArgon2id {
+		return nil
+	}
+	_, version, _, _, _ := parseArgon2(hash)
+	if version == 0 {
+		return nil
+	}
+	for _, p := range peppers {
+		if p.Version == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: keyid=%d", ErrUnknownPepper, version)
+}
+
+func (p Pepper) apply(password string) []byte {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,118 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+var (
+	pepperV1 = Pepper{Version: 1, Key: []byte("first-pepper-0123456789")}
+	pepperV2 = Pepper{Version: 2, Key: []byte("second-pepper-012345678")}
+)
+
+func TestHasher_Pepper(t *testing.T) {
+	old := New(testParams, []Pepper{pepperV1})
+	current := New(testParams, []Pepper{pepperV1, pepperV2})
+
+	hash, algo, err := old.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(hash), ",keyid=1$") {
+		t.Fatalf("Hash() = %q, want the pepper version in keyid", hash)
+	}
+	if err := current.Verify(algo, hash, password); err != nil {
+		t.Errorf("Verify() with a retained pepper error = %v, want nil", err)
+	}
+	if err := current.Verify(algo, hash, "wrong"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrMismatch)
+	}
+	if !current.NeedsRehash(algo, hash) {
+		t.Error("NeedsRehash() = false for an older pepper, want true")
+	}
+	if err := New(testParams, []Pepper{pepperV2}).Verify(algo, hash, password); !errors.Is(err, ErrUnknownPepper) {
+		t.Errorf("Verify() without the pepper error = %v, want %v", err, ErrUnknownPepper)
+	}
+	if err := Verify(algo, hash, password); !errors.Is(err, ErrUnknownPepper) {
+		t.Errorf("package Verify() error = %v, want %v", err, ErrUnknownPepper)
+	}
+	if err := Validate(algo, hash); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+
+	rehashed, _, err := current.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.NeedsRehash(models.AlgoArgon2id, rehashed) {
+		t.Error("NeedsRehash() = true for the current pepper, want false")
+	}
+
+	plain, _, err := New(testParams, nil).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.NeedsRehash(models.AlgoArgon2id, plain) {
+		t.Error("NeedsRehash() = false for an unpeppered hash, want true")
+	}
+	if err := current.Verify(models.AlgoArgon2id, plain, password); err != nil {
+		t.Errorf("Verify() of an unpeppered hash error = %v, want nil", err)
+	}
+}
+
+func TestValidatePeppered(t *testing.T) {
+	peppered, _, err := New(testParams, []Pepper{pepperV2}).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _, err := New(testParams, nil).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hash    []byte
+		peppers []Pepper
+		want    error
+	}{
+		{name: "known pepper", hash: peppered, peppers: []Pepper{pepperV1, pepperV2}},
+		{name: "unknown pepper", hash: peppered, peppers: []Pepper{pepperV1}, want: ErrUnknownPepper},
+		{name: "no pepper configured", hash: peppered, want: ErrUnknownPepper},
+		{name: "unpeppered hash", hash: plain},
+		{name: "malformed hash", hash: []byte("$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5"), peppers: []Pepper{pepperV2}, want: ErrMalformedHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidatePeppered(models.AlgoArgon2id, tt.hash, tt.peppers); !errors.Is(err, tt.want) {
+				t.Errorf("ValidatePeppered() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePeppers(t *testing.T) {
+	t.Parallel()
+	peppers, err := ParsePeppers("# retired once every user logged in\n1:Zmlyc3QtcGVwcGVyLTAxMjM0NTY3ODk=\n\n2:c2Vjb25kLXBlcHBlci0wMTIzNDU2Nzg=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peppers) != 2 || peppers[0].Version != 1 || string(peppers[1].Key) != "second-pepper-012345678" {
+		t.Errorf("ParsePeppers() = %+v", peppers)
+	}
+
+	for _, s := range []string{
+		"Zmlyc3QtcGVwcGVyLTAxMjM0NTY3ODk=",
+		"0:Zmlyc3QtcGVwcGVyLTAxMjM0NTY3ODk=",
+		"1:not base64!",
+		"1:c2hvcnQ=",
+		"1:Zmlyc3QtcGVwcGVyLTAxMjM0NTY3ODk=,1:c2Vjb25kLXBlcHBlci0wMTIzNDU2Nzg=",
+	} {
+		if _, err := ParsePeppers(s); !errors.Is(err, ErrInvalidPepper) {
+			t.Errorf("ParsePeppers(%q) error = %v, want %v", s, err, ErrInvalidPepper)
+		}
+	}
+}
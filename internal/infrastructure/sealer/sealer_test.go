@@ -0,0 +1,102 @@
+package sealer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newSealer(t *testing.T, fill byte) *Sealer {
+	t.Helper()
+	s, err := New(bytes.Repeat([]byte{fill}, KeySize))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+func TestSealOpen(t *testing.T) {
+	s := newSealer(t, 1)
+	sealed, err := s.Seal([]byte("JBSWY3DPEHPK3PXP"), []byte("user:1"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	if bytes.Contains(sealed, []byte("JBSWY3DPEHPK3PXP")) {
+		t.Fatal("Seal() output contains the plaintext")
+	}
+	got, err := s.Open(sealed, []byte("user:1"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if string(got) != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Open() = %q", got)
+	}
+	again, _ := s.Seal([]byte("JBSWY3DPEHPK3PXP"), []byte("user:1"))
+	if bytes.Equal(sealed, again) {
+		t.Error("Seal() is deterministic, want a fresh nonce per call")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	s := newSealer(t, 1)
+	sealed, err := s.Seal([]byte("secret"), []byte("user:1"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	tests := []struct {
+		name       string
+		sealer     *Sealer
+		sealed     []byte
+		additional string
+	}{
+		{"other additional data", s, sealed, "user:2"},
+		{"other key", newSealer(t, 2), sealed, "user:1"},
+		{"tampered", s, tampered, "user:1"},
+		{"truncated", s, sealed[:10], "user:1"},
+		{"unknown version", s, append([]byte{9}, sealed[1:]...), "user:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.sealer.Open(tt.sealed, []byte(tt.additional)); !errors.Is(err, ErrMalformed) {
+				t.Errorf("Open() error = %v, want ErrMalformed", err)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, KeySize))
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"surrounding whitespace", " " + valid + "\n", false},
+		{"not base64", "!!!", true},
+		{"too short", base64.StdEncoding.EncodeToString([]byte("short")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("ParseKey() error = %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	if _, err := (Disabled{}).Seal([]byte("secret"), nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Seal() error = %v, want ErrNoKey", err)
+	}
+	if _, err := (Disabled{}).Open([]byte("secret"), nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Open() error = %v, want ErrNoKey", err)
+	}
+}
@@ -0,0 +1,103 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit ones are their last digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code() error = nil, want ErrInvalidSecret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+	previous, _ := Code(rfcSecret, current-1)
+	stale, _ := Code(rfcSecret, current-2)
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", "005924", 0, current, true},
+		{"previous step within skew", previous, 1, current - 1, true},
+		{"previous step without skew", previous, 0, 0, false},
+		{"outside skew", stale, 1, 0, false},
+		{"wrong code", "123456", 1, 0, false},
+		{"wrong length", "05924", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	other, _ := GenerateSecret()
+	if secret == other {
+		t.Error("GenerateSecret() returned the same secret twice")
+	}
+	code, err := Code(secret, 1)
+	if err != nil || len(code) != digits {
+		t.Errorf("Code() = %q, %v, want a %d-digit code", code, err, digits)
+	}
+}
+
+func TestURI(t *testing.T) {
+	raw := URI("Example SSO", "bob@example.com", "JBSWY3DPEHPK3PXP")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("URI() = %q is not a URL: %v", raw, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("URI() = %q, want otpauth://totp/...", raw)
+	}
+	if u.Path != "/Example SSO:bob@example.com" {
+		t.Errorf("URI() label = %q", u.Path)
+	}
+	q := u.Query()
+	if q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Example SSO" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("URI() query = %v", q)
+	}
+}
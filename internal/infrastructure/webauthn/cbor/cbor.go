@@ -0,0 +1,284 @@
+// Package cbor implements the subset of CBOR (RFC 8949) that WebAuthn uses:
+// integers, byte and text strings, arrays, maps and simple values. Floats,
+// indefinite lengths and tags other than pass-through are not supported.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	majorUint = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// maxDepth bounds nesting, so that hostile input cannot exhaust the stack.
+const maxDepth = 16
+
+var (
+	// ErrMalformed is returned for input that is not well-formed CBOR.
+	ErrMalformed = errors.New("malformed cbor")
+	// ErrUnsupported is returned for valid CBOR outside the supported subset.
+	ErrUnsupported = errors.New("unsupported cbor")
+)
+
+// Decode decodes the first item of data and returns the bytes after it.
+// Integers decode to int64, byte strings to []byte, text to string, arrays
+// to []any and maps to map[any]any, keyed by int64 or string.
+func Decode(data []byte) (item any, rest []byte, err error) {
+	d := decoder{data: data}
+	item, err = d.item(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, d.data[d.off:], nil
+}
+
+// DecodeAll is Decode for input that holds exactly one item.
+func DecodeAll(data []byte) (any, error) {
+	item, rest, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformed, len(rest))
+	}
+	return item, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) head() (major byte, arg uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, fmt.Errorf("%w: unexpected end of input", ErrMalformed)
+	}
+	b := d.data[d.off]
+	d.off++
+	major, info := b>>5, b&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, fmt.Errorf("%w: indefinite length", ErrUnsupported)
+	default:
+		return 0, 0, fmt.Errorf("%w: reserved additional information %d", ErrMalformed, info)
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, fmt.Errorf("%w: unexpected end of input", ErrMalformed)
+	}
+	buf := d.data[d.off : d.off+size]
+	d.off += size
+	switch size {
+	case 1:
+		arg = uint64(buf[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(buf))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(buf))
+	default:
+		arg = binary.BigEndian.Uint64(buf)
+	}
+	return major, arg, nil
+}
+
+func (d *decoder) item(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", ErrUnsupported)
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflows int64", ErrUnsupported)
+		}
+		return int64(arg), nil
+	case majorNegInt:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflows int64", ErrUnsupported)
+		}
+		return -1 - int64(arg), nil
+	case majorBytes, majorText:
+		if arg > uint64(len(d.data)-d.off) {
+			return nil, fmt.Errorf("%w: string longer than input", ErrMalformed)
+		}
+		s := d.data[d.off : d.off+int(arg)]
+		d.off += int(arg)
+		if major == majorText {
+			return string(s), nil
+		}
+		return bytes.Clone(s), nil
+	case majorArray:
+		// Every element takes at least a byte.
+		if arg > uint64(len(d.data)-d.off) {
+			return nil, fmt.Errorf("%w: array longer than input", ErrMalformed)
+		}
+		arr := make([]any, 0, arg)
+		for range arg {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.off)/2 {
+			return nil, fmt.Errorf("%w: map longer than input", ErrMalformed)
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: map key of type %T", ErrUnsupported, k)
+			}
+			if _, dup := m[k]; dup {
+				return nil, fmt.Errorf("%w: duplicate map key %v", ErrMalformed, k)
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case majorTag:
+		// Tags only annotate the item that follows; WebAuthn never needs them.
+		return d.item(depth + 1)
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: simple value or float %d", ErrUnsupported, arg)
+	}
+}
+
+// Marshal encodes v in the core deterministic encoding: shortest heads and
+// map keys sorted by their encoding. It accepts the types Decode returns,
+// plus int, uint32 and map[string]any.
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majorSimple<<5 | 20)
+		}
+	case int:
+		return encode(buf, int64(v))
+	case uint32:
+		writeHead(buf, majorUint, uint64(v))
+	case int64:
+		if v >= 0 {
+			writeHead(buf, majorUint, uint64(v))
+		} else {
+			writeHead(buf, majorNegInt, uint64(-1-v))
+		}
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		m := make(map[any]any, len(v))
+		for k, e := range v {
+			m[k] = e
+		}
+		return encode(buf, m)
+	case map[any]any:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, len(v))
+		for k, e := range v {
+			key, err := Marshal(k)
+			if err != nil {
+				return err
+			}
+			value, err := Marshal(e)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{key, value})
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return bytes.Compare(a.key, b.key) })
+		writeHead(buf, majorMap, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			buf.Write(e.value)
+		}
+	default:
+		return fmt.Errorf("%w: cannot encode %T", ErrUnsupported, v)
+	}
+	return nil
+}
+
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
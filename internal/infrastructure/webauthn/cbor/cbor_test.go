@@ -0,0 +1,149 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	// Examples from RFC 8949, appendix A.
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"c11a514b67b0", int64(1363896240)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.hex)
+			got, err := DecodeAll(data)
+			if err != nil {
+				t.Fatalf("DecodeAll() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeAll() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRest(t *testing.T) {
+	data, _ := hex.DecodeString("0102")
+	item, rest, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if item != int64(1) || len(rest) != 1 || rest[0] != 2 {
+		t.Errorf("Decode() = %v, %x", item, rest)
+	}
+	if _, err := DecodeAll(data); !errors.Is(err, ErrMalformed) {
+		t.Errorf("DecodeAll() error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want error
+	}{
+		{"empty", "", ErrMalformed},
+		{"truncated head", "19 03", ErrMalformed},
+		{"string past end", "44 0102", ErrMalformed},
+		{"huge array", "9b ffffffffffffffff", ErrMalformed},
+		{"duplicate key", "a2 01 02 01 03", ErrMalformed},
+		{"reserved info", "1c", ErrMalformed},
+		{"indefinite length", "5f", ErrUnsupported},
+		{"float", "f93c00", ErrUnsupported},
+		{"array key", "a1 80 01", ErrUnsupported},
+		{"uint64 overflow", "1b ffffffffffffffff", ErrUnsupported},
+		{"too deep", "818181818181818181818181818181818181 00", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := hex.DecodeString(stripSpaces(tt.hex))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := DecodeAll(data); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeAll() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{int64(1000), "1903e8"},
+		{-7, "26"},
+		{-257, "390100"},
+		{uint32(1 << 20), "1a00100000"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2}, "420102"},
+		{[]any{1, "a"}, "82016161"},
+		// Keys sort by their encoding: 1, 3, -1, -2, then text.
+		{map[any]any{-2: 0, "fmt": 0, 3: 0, -1: 0, 1: 0}, "a5010003002000210063666d7400"},
+		{map[string]any{"b": true, "a": nil}, "a26161f66162f5"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%v) error = %v", tt.in, err)
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Marshal(%v) = %x, want %s", tt.in, got, tt.want)
+		}
+	}
+	if _, err := Marshal(1.5); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Marshal(1.5) error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := map[any]any{
+		int64(1):  int64(2),
+		int64(-1): []byte("key"),
+		"list":    []any{"x", int64(-300), true},
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	out, err := DecodeAll(data)
+	if err != nil {
+		t.Fatalf("DecodeAll() error = %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip = %#v, want %#v", out, in)
+	}
+}
+
+func stripSpaces(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != ' ' {
+			out = append(out, s[i])
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,143 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/cbor"
+)
+
+// COSE algorithm identifiers (RFC 9053) of the supported signatures.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// supportedAlgs is the preference order offered to authenticators.
+var supportedAlgs = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters and values used by the supported key types.
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// minRSABits refuses RSA keys too short to be trusted.
+const minRSABits = 2048
+
+// publicKey is a credential public key decoded from its COSE_Key form.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and checks it is a valid key of one of
+// the supported algorithms.
+func parsePublicKey(raw []byte) (publicKey, error) {
+	item, err := cbor.DecodeAll(raw)
+	if err != nil {
+		return publicKey{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	m, ok := item.(map[any]any)
+	if !ok {
+		return publicKey{}, fmt.Errorf("%w: public key is not a map", ErrInvalidResponse)
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, fmt.Errorf("%w: invalid P-256 key", ErrInvalidResponse)
+		}
+		point := append(append([]byte{4}, x...), y...)
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return publicKey{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		return publicKey{alg: AlgES256, key: key}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, fmt.Errorf("%w: invalid Ed25519 key", ErrInvalidResponse)
+		}
+		return publicKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		exp := new(big.Int).SetBytes(e)
+		if len(n)*8 < minRSABits || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64()%2 == 0 || exp.Int64() > 1<<31-1 {
+			return publicKey{}, fmt.Errorf("%w: invalid RSA key", ErrInvalidResponse)
+		}
+		return publicKey{alg: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return publicKey{}, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupportedAlgorithm, kty, alg)
+}
+
+// x5cLeaf returns the key of the first certificate of an attestation
+// chain, with the algorithm its type implies.
+func x5cLeaf(x5c []any) (publicKey, error) {
+	if len(x5c) == 0 {
+		return publicKey{}, fmt.Errorf("%w: empty certificate chain", ErrInvalidResponse)
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return publicKey{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return publicKey{alg: AlgES256, key: key}, nil
+		}
+	case ed25519.PublicKey:
+		return publicKey{alg: AlgEdDSA, key: key}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() >= minRSABits {
+			return publicKey{alg: AlgRS256, key: key}, nil
+		}
+	}
+	return publicKey{}, fmt.Errorf("%w: attestation certificate key", ErrUnsupportedAlgorithm)
+}
+
+// verify checks sig over data with the key's algorithm.
+func (k publicKey) verify(data, sig []byte) error {
+	ok := false
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
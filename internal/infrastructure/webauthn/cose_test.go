@@ -0,0 +1,84 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/cbor"
+)
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := cbor.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return data
+}
+
+func TestPublicKeyEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parsePublicKey(mustMarshal(t, map[any]any{1: ktyOKP, 3: AlgEdDSA, -1: crvEd25519, -2: []byte(pub)}))
+	if err != nil {
+		t.Fatalf("parsePublicKey() error = %v", err)
+	}
+	data := []byte("signed data")
+	if err := key.verify(data, ed25519.Sign(priv, data)); err != nil {
+		t.Errorf("verify() error = %v", err)
+	}
+	if err := key.verify([]byte("other data"), ed25519.Sign(priv, data)); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("verify() error = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestPublicKeyRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := big.NewInt(int64(priv.E)).Bytes()
+	key, err := parsePublicKey(mustMarshal(t, map[any]any{1: ktyRSA, 3: AlgRS256, -1: priv.N.Bytes(), -2: e}))
+	if err != nil {
+		t.Fatalf("parsePublicKey() error = %v", err)
+	}
+	data := []byte("signed data")
+	digest := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.verify(data, sig); err != nil {
+		t.Errorf("verify() error = %v", err)
+	}
+}
+
+func TestParsePublicKeyRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		key  any
+		want error
+	}{
+		{"not a map", []any{1}, ErrInvalidResponse},
+		{"unknown algorithm", map[any]any{1: ktyEC2, 3: -35}, ErrUnsupportedAlgorithm},
+		{"algorithm of another key type", map[any]any{1: ktyOKP, 3: AlgES256}, ErrUnsupportedAlgorithm},
+		{"P-256 point off the curve", map[any]any{1: ktyEC2, 3: AlgES256, -1: crvP256, -2: make([]byte, 32), -3: make([]byte, 32)}, ErrInvalidResponse},
+		{"other curve", map[any]any{1: ktyEC2, 3: AlgES256, -1: 2, -2: make([]byte, 48), -3: make([]byte, 48)}, ErrInvalidResponse},
+		{"short RSA key", map[any]any{1: ktyRSA, 3: AlgRS256, -1: make([]byte, 128), -2: []byte{1, 0, 1}}, ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePublicKey(mustMarshal(t, tt.key)); !errors.Is(err, tt.want) {
+				t.Errorf("parsePublicKey() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+// Package webauthn runs the relying party side of WebAuthn registration and
+// authentication ceremonies: it builds the options passed to
+// navigator.credentials.create() and .get(), and verifies what the
+// authenticator returns. Options and responses use the JSON forms of
+// WebAuthn Level 3 (parseCreationOptionsFromJSON and toJSON), so browsers
+// can pass them through unchanged.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/cbor"
+)
+
+// challengeSize is the number of random bytes in a challenge.
+const challengeSize = 32
+
+// maxCredentialIDLength is the longest credential id the spec allows.
+const maxCredentialIDLength = 1023
+
+// Authenticator data flags.
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensions     = 0x80
+)
+
+var (
+	// ErrInvalidResponse is returned for responses that cannot be decoded.
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+	// ErrChallengeMismatch is returned when the response signs another challenge.
+	ErrChallengeMismatch = errors.New("challenge mismatch")
+	// ErrOriginMismatch is returned for responses made on an unknown origin.
+	ErrOriginMismatch = errors.New("origin not allowed")
+	// ErrRPIDMismatch is returned for credentials scoped to another relying party.
+	ErrRPIDMismatch = errors.New("relying party id mismatch")
+	// ErrUserNotPresent is returned when the authenticator did not test for
+	// user presence.
+	ErrUserNotPresent = errors.New("user not present")
+	// ErrUserNotVerified is returned when user verification is required but
+	// the authenticator did not perform it.
+	ErrUserNotVerified = errors.New("user not verified")
+	// ErrBadSignature is returned for assertions or attestations whose
+	// signature does not verify.
+	ErrBadSignature = errors.New("bad signature")
+	// ErrUnsupportedAlgorithm is returned for credential keys of other algorithms.
+	ErrUnsupportedAlgorithm = errors.New("unsupported public key algorithm")
+	// ErrUnsupportedAttestation is returned for attestation formats other
+	// than none and packed.
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	// ErrSignCount is returned when the signature counter did not increase,
+	// a sign that the authenticator was cloned.
+	ErrSignCount = errors.New("signature counter did not increase")
+)
+
+var encoding = base64.RawURLEncoding
+
+// RelyingParty is the service credentials are scoped to.
+type RelyingParty struct {
+	// ID is the domain credentials are bound to, e.g. "example.com".
+	ID string
+	// Name is shown by authenticators when creating a credential.
+	Name string
+	// Origins are the web origins ceremonies may run on, e.g.
+	// "https://app.example.com". They must be ID or its subdomains.
+	Origins []string
+	// RequireUserVerification demands a PIN or biometric check in addition
+	// to presence, which makes a passkey enough to log in on its own.
+	RequireUserVerification bool
+}
+
+// User is the account a credential is created for.
+type User struct {
+	// Handle identifies the user to the authenticator. It must not contain
+	// personal information and comes back with every assertion.
+	Handle      []byte
+	Name        string
+	DisplayName string
+}
+
+// Credential is a public key credential registered by a user.
+type Credential struct {
+	ID []byte
+	// PublicKey is the credential's COSE_Key.
+	PublicKey []byte
+	SignCount uint32
+	// Transports hint how clients can reach the authenticator.
+	Transports []string
+	AAGUID     []byte
+	// BackupEligible and BackedUp tell whether the credential is a synced
+	// passkey rather than bound to one device.
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// NewChallenge returns a random challenge for one ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+type credentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type creationOptions struct {
+	RP struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey        string `json:"residentKey"`
+		RequireResidentKey bool   `json:"requireResidentKey"`
+		UserVerification   string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+func (rp RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+// CreationOptions builds the options of a registration ceremony for user.
+// Passkeys are requested: the credential must be discoverable so that it
+// can log in without a username. Authenticators already holding one of
+// exclude refuse to register again.
+func (rp RelyingParty) CreationOptions(user User, challenge []byte, exclude []Credential, timeout time.Duration) ([]byte, error) {
+	var o creationOptions
+	o.RP.ID = rp.ID
+	o.RP.Name = rp.Name
+	o.User.ID = encoding.EncodeToString(user.Handle)
+	o.User.Name = user.Name
+	o.User.DisplayName = user.DisplayName
+	o.Challenge = encoding.EncodeToString(challenge)
+	for _, alg := range supportedAlgs {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, credentialParameter{Type: "public-key", Alg: alg})
+	}
+	o.Timeout = timeout.Milliseconds()
+	o.ExcludeCredentials = descriptors(exclude)
+	o.AuthenticatorSelection.ResidentKey = "required"
+	o.AuthenticatorSelection.RequireResidentKey = true
+	o.AuthenticatorSelection.UserVerification = rp.userVerification()
+	o.Attestation = "none"
+	return json.Marshal(o)
+}
+
+// RequestOptions builds the options of an authentication ceremony. With no
+// allowed credentials, the user picks any passkey they hold for the party.
+func (rp RelyingParty) RequestOptions(challenge []byte, allow []Credential, timeout time.Duration) ([]byte, error) {
+	return json.Marshal(requestOptions{
+		Challenge:        encoding.EncodeToString(challenge),
+		Timeout:          timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: rp.userVerification(),
+	})
+}
+
+func descriptors(creds []Credential) []credentialDescriptor {
+	out := make([]credentialDescriptor, 0, len(creds))
+	for _, c := range creds {
+		out = append(out, credentialDescriptor{Type: "public-key", ID: encoding.EncodeToString(c.ID), Transports: c.Transports})
+	}
+	return out
+}
+
+type registrationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// VerifyRegistration checks the response of a registration ceremony run
+// with challenge and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge, response []byte) (Credential, error) {
+	var resp registrationResponse
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if resp.Type != "public-key" {
+		return Credential{}, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	rawID, err1 := decode(resp.RawID)
+	clientDataJSON, err2 := decode(resp.Response.ClientDataJSON)
+	attObject, err3 := decode(resp.Response.AttestationObject)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return Credential{}, err
+	}
+
+	item, err := cbor.DecodeAll(attObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	att, ok := item.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+	format, _ := att["fmt"].(string)
+	stmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+	if stmt == nil || rawAuthData == nil {
+		return Credential{}, fmt.Errorf("%w: incomplete attestation object", ErrInvalidResponse)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return Credential{}, err
+	}
+	if authData.credentialID == nil {
+		return Credential{}, fmt.Errorf("%w: no attested credential", ErrInvalidResponse)
+	}
+	if !bytes.Equal(authData.credentialID, rawID) {
+		return Credential{}, fmt.Errorf("%w: credential id does not match rawId", ErrInvalidResponse)
+	}
+	key, err := parsePublicKey(authData.credentialKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifyAttestation(format, stmt, key, append(bytes.Clone(rawAuthData), clientDataHash[:]...)); err != nil {
+		return Credential{}, err
+	}
+	return Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.credentialKey,
+		SignCount:      authData.signCount,
+		Transports:     resp.Response.Transports,
+		AAGUID:         authData.aaguid,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// verifyAttestation checks the attestation statement. The service asks for
+// no attestation, so only none and packed are expected; packed statements
+// are checked for a valid signature but their certificates are not trusted
+// or required to chain anywhere.
+func verifyAttestation(format string, stmt map[any]any, credKey publicKey, signed []byte) error {
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return fmt.Errorf("%w: none attestation with a statement", ErrInvalidResponse)
+		}
+		return nil
+	case "packed":
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		if sig == nil {
+			return fmt.Errorf("%w: packed attestation without signature", ErrInvalidResponse)
+		}
+		key := credKey
+		if x5c, ok := stmt["x5c"].([]any); ok {
+			leaf, err := x5cLeaf(x5c)
+			if err != nil {
+				return err
+			}
+			key = leaf
+		}
+		if int(alg) != key.alg {
+			return fmt.Errorf("%w: attestation algorithm %d does not match its key", ErrInvalidResponse, alg)
+		}
+		return key.verify(signed, sig)
+	}
+	return fmt.Errorf("%w: %q", ErrUnsupportedAttestation, format)
+}
+
+// Assertion is the response of an authentication ceremony, decoded but not
+// verified yet. CredentialID tells which credential has to verify it.
+type Assertion struct {
+	CredentialID []byte
+	// UserHandle is the handle the credential was created with; passkeys
+	// always return it.
+	UserHandle        []byte
+	clientDataJSON    []byte
+	authenticatorData []byte
+	signature         []byte
+}
+
+type assertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// ParseAssertion decodes the response of an authentication ceremony.
+func ParseAssertion(response []byte) (Assertion, error) {
+	var resp assertionResponse
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return Assertion{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if resp.Type != "public-key" {
+		return Assertion{}, fmt.Errorf("%w: credential type %q", ErrInvalidResponse, resp.Type)
+	}
+	var a Assertion
+	var errs [5]error
+	a.CredentialID, errs[0] = decode(resp.RawID)
+	a.UserHandle, errs[1] = decode(resp.Response.UserHandle)
+	a.clientDataJSON, errs[2] = decode(resp.Response.ClientDataJSON)
+	a.authenticatorData, errs[3] = decode(resp.Response.AuthenticatorData)
+	a.signature, errs[4] = decode(resp.Response.Signature)
+	if err := errors.Join(errs[:]...); err != nil {
+		return Assertion{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if len(a.CredentialID) == 0 || len(a.CredentialID) > maxCredentialIDLength {
+		return Assertion{}, fmt.Errorf("%w: credential id of %d bytes", ErrInvalidResponse, len(a.CredentialID))
+	}
+	return a, nil
+}
+
+// VerifyAssertion checks an assertion made with cred for challenge and
+// returns cred with its new signature counter and backup state.
+func (rp RelyingParty) VerifyAssertion(a Assertion, challenge []byte, cred Credential) (Credential, error) {
+	if !bytes.Equal(a.CredentialID, cred.ID) {
+		return Credential{}, fmt.Errorf("%w: assertion made with another credential", ErrInvalidResponse)
+	}
+	if err := rp.verifyClientData(a.clientDataJSON, "webauthn.get", challenge); err != nil {
+		return Credential{}, err
+	}
+	authData, err := parseAuthenticatorData(a.authenticatorData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return Credential{}, err
+	}
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+	clientDataHash := sha256.Sum256(a.clientDataJSON)
+	if err := key.verify(append(bytes.Clone(a.authenticatorData), clientDataHash[:]...), a.signature); err != nil {
+		return Credential{}, err
+	}
+	// Authenticators without a counter always report zero.
+	if (authData.signCount != 0 || cred.SignCount != 0) && authData.signCount <= cred.SignCount {
+		return Credential{}, fmt.Errorf("%w: got %d, stored %d", ErrSignCount, authData.signCount, cred.SignCount)
+	}
+	cred.SignCount = authData.signCount
+	cred.BackedUp = authData.flags&flagBackedUp != 0
+	return cred, nil
+}
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: client data of type %q", ErrInvalidResponse, cd.Type)
+	}
+	got, err := decode(cd.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.CrossOrigin || !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: %q", ErrOriginMismatch, cd.Origin)
+	}
+	return nil
+}
+
+func (rp RelyingParty) verifyAuthenticatorData(d authenticatorData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(d.rpIDHash, want[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if d.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if rp.RequireUserVerification && d.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// The attested credential, only present during registration.
+	aaguid        []byte
+	credentialID  []byte
+	credentialKey []byte
+}
+
+func parseAuthenticatorData(raw []byte) (authenticatorData, error) {
+	const fixed = 32 + 1 + 4
+	if len(raw) < fixed {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	d := authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[fixed:]
+	if d.flags&flagAttestedData != 0 {
+		if len(rest) < 16+2 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		d.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLength || len(rest) < idLen {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id length %d", ErrInvalidResponse, idLen)
+		}
+		d.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+		_, after, err := cbor.Decode(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		d.credentialKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if d.flags&flagExtensions != 0 {
+		_, after, err := cbor.Decode(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: %d trailing bytes in authenticator data", ErrInvalidResponse, len(rest))
+	}
+	return d, nil
+}
+
+// decode reads base64url, with or without padding, as browsers send it.
+func decode(s string) ([]byte, error) {
+	return encoding.DecodeString(strings.TrimRight(s, "="))
+}
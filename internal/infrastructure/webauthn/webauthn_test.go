@@ -0,0 +1,286 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/webauthntest"
+)
+
+const origin = "https://app.example.com"
+
+var testRP = RelyingParty{
+	ID:                      "example.com",
+	Name:                    "Example",
+	Origins:                 []string{origin},
+	RequireUserVerification: true,
+}
+
+var testUser = User{Handle: []byte{0, 0, 0, 0, 0, 0, 0, 42}, Name: "bob@example.com", DisplayName: "Bob"}
+
+// register runs a registration ceremony between rp and auth.
+func register(t *testing.T, rp RelyingParty, auth *webauthntest.Authenticator) Credential {
+	t.Helper()
+	challenge := newChallenge(t)
+	options, err := rp.CreationOptions(testUser, challenge, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("CreationOptions() error = %v", err)
+	}
+	response, err := auth.Create(options, origin)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	cred, err := rp.VerifyRegistration(challenge, response)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	return cred
+}
+
+// login runs an authentication ceremony and verifies it against cred.
+func login(t *testing.T, rp RelyingParty, auth *webauthntest.Authenticator, cred Credential) (Credential, error) {
+	t.Helper()
+	challenge := newChallenge(t)
+	options, err := rp.RequestOptions(challenge, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("RequestOptions() error = %v", err)
+	}
+	response, err := auth.Get(options, origin)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	assertion, err := ParseAssertion(response)
+	if err != nil {
+		t.Fatalf("ParseAssertion() error = %v", err)
+	}
+	return rp.VerifyAssertion(assertion, challenge, cred)
+}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatalf("NewChallenge() error = %v", err)
+	}
+	return challenge
+}
+
+func TestCeremonies(t *testing.T) {
+	for _, attestation := range []string{"none", "packed"} {
+		t.Run(attestation, func(t *testing.T) {
+			auth := webauthntest.New()
+			auth.Attestation = attestation
+			cred := register(t, testRP, auth)
+			if len(cred.ID) == 0 || len(cred.PublicKey) == 0 || cred.SignCount != 0 {
+				t.Fatalf("VerifyRegistration() = %+v", cred)
+			}
+			if len(cred.Transports) != 1 || cred.Transports[0] != "internal" {
+				t.Errorf("Transports = %v, want [internal]", cred.Transports)
+			}
+			for want := uint32(1); want <= 3; want++ {
+				// Keep the counter as the service would store it.
+				var err error
+				cred, err = login(t, testRP, auth, cred)
+				if err != nil {
+					t.Fatalf("VerifyAssertion() error = %v", err)
+				}
+				if cred.SignCount != want {
+					t.Errorf("SignCount = %d, want %d", cred.SignCount, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssertionUserHandle(t *testing.T) {
+	auth := webauthntest.New()
+	register(t, testRP, auth)
+	options, _ := testRP.RequestOptions(newChallenge(t), nil, time.Minute)
+	response, err := auth.Get(options, origin)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	assertion, err := ParseAssertion(response)
+	if err != nil {
+		t.Fatalf("ParseAssertion() error = %v", err)
+	}
+	if !bytes.Equal(assertion.UserHandle, testUser.Handle) {
+		t.Errorf("UserHandle = %x, want %x", assertion.UserHandle, testUser.Handle)
+	}
+}
+
+func TestSignCount(t *testing.T) {
+	auth := webauthntest.New()
+	cred := register(t, testRP, auth)
+	clone := auth.Clone()
+	cred, err := login(t, testRP, auth, cred)
+	if err != nil {
+		t.Fatalf("VerifyAssertion() error = %v", err)
+	}
+	// The clone still counts from where it was copied.
+	if _, err := login(t, testRP, clone, cred); !errors.Is(err, ErrSignCount) {
+		t.Errorf("VerifyAssertion() error = %v, want ErrSignCount", err)
+	}
+
+	synced := webauthntest.New()
+	synced.Counterless = true
+	cred = register(t, testRP, synced)
+	if !cred.BackupEligible || !cred.BackedUp {
+		t.Errorf("synced passkey = %+v, want backup eligible and backed up", cred)
+	}
+	for range 2 {
+		if _, err := login(t, testRP, synced, cred); err != nil {
+			t.Errorf("VerifyAssertion() of a counterless passkey error = %v", err)
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	otherRP := testRP
+	otherRP.ID = "evil.com"
+	tests := []struct {
+		name   string
+		rp     RelyingParty
+		origin string
+		mutate func(auth *webauthntest.Authenticator, challenge []byte) []byte
+		want   error
+	}{
+		{name: "wrong origin", rp: testRP, origin: "https://evil.com", want: ErrOriginMismatch},
+		{name: "wrong rp id", rp: otherRP, origin: origin, want: ErrRPIDMismatch},
+		{
+			name: "no user verification", rp: testRP, origin: origin, want: ErrUserNotVerified,
+			mutate: func(auth *webauthntest.Authenticator, challenge []byte) []byte {
+				auth.SkipUserVerification = true
+				return challenge
+			},
+		},
+		{
+			name: "other challenge", rp: testRP, origin: origin, want: ErrChallengeMismatch,
+			mutate: func(_ *webauthntest.Authenticator, challenge []byte) []byte {
+				return bytes.Repeat([]byte{1}, len(challenge))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := webauthntest.New()
+			challenge := newChallenge(t)
+			signed := challenge
+			if tt.mutate != nil {
+				signed = tt.mutate(auth, challenge)
+			}
+			options, err := tt.rp.CreationOptions(testUser, signed, nil, time.Minute)
+			if err != nil {
+				t.Fatalf("CreationOptions() error = %v", err)
+			}
+			response, err := auth.Create(options, tt.origin)
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if _, err := testRP.VerifyRegistration(challenge, response); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyRegistration() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	lax := testRP
+	lax.RequireUserVerification = false
+	auth := webauthntest.New()
+	auth.SkipUserVerification = true
+	register(t, lax, auth)
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	auth := webauthntest.New()
+	cred := register(t, testRP, auth)
+
+	challenge := newChallenge(t)
+	options, _ := testRP.RequestOptions(challenge, nil, time.Minute)
+	response, err := auth.Get(options, origin)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	assertion, err := ParseAssertion(response)
+	if err != nil {
+		t.Fatalf("ParseAssertion() error = %v", err)
+	}
+
+	other := register(t, testRP, webauthntest.New())
+	other.ID = cred.ID
+	tampered := assertion
+	tampered.signature = bytes.Clone(assertion.signature)
+	tampered.signature[len(tampered.signature)-1] ^= 1
+
+	tests := []struct {
+		name      string
+		assertion Assertion
+		challenge []byte
+		cred      Credential
+		want      error
+	}{
+		{"other challenge", assertion, newChallenge(t), cred, ErrChallengeMismatch},
+		{"other key", assertion, challenge, other, ErrBadSignature},
+		{"tampered signature", tampered, challenge, cred, ErrBadSignature},
+		{"other credential", assertion, challenge, Credential{ID: []byte("x")}, ErrInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testRP.VerifyAssertion(tt.assertion, tt.challenge, tt.cred); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyAssertion() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAssertionRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"not json", "{"},
+		{"wrong type", `{"type":"password","rawId":"AA"}`},
+		{"no credential id", `{"type":"public-key"}`},
+		{"bad base64", `{"type":"public-key","rawId":"!!"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseAssertion([]byte(tt.response)); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("ParseAssertion() error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestCreationOptions(t *testing.T) {
+	exclude := []Credential{{ID: []byte{1, 2, 3}, Transports: []string{"usb"}}}
+	raw, err := testRP.CreationOptions(testUser, []byte{9, 9}, exclude, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("CreationOptions() error = %v", err)
+	}
+	var o map[string]any
+	if err := json.Unmarshal(raw, &o); err != nil {
+		t.Fatalf("CreationOptions() is not JSON: %v", err)
+	}
+	sel := o["authenticatorSelection"].(map[string]any)
+	if sel["residentKey"] != "required" || sel["userVerification"] != "required" {
+		t.Errorf("authenticatorSelection = %v", sel)
+	}
+	if o["challenge"] != "CQk" || o["timeout"] != float64(120000) || o["attestation"] != "none" {
+		t.Errorf("options = %v", o)
+	}
+	excluded := o["excludeCredentials"].([]any)
+	if len(excluded) != 1 || excluded[0].(map[string]any)["id"] != "AQID" {
+		t.Errorf("excludeCredentials = %v", excluded)
+	}
+
+	// Authenticators refuse to register twice.
+	auth := webauthntest.New()
+	cred := register(t, testRP, auth)
+	raw, _ = testRP.CreationOptions(testUser, newChallenge(t), []Credential{cred}, time.Minute)
+	if _, err := auth.Create(raw, origin); !errors.Is(err, webauthntest.ErrExcluded) {
+		t.Errorf("Create() error = %v, want ErrExcluded", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Package webauthntest provides a software authenticator that plays the
+// browser and authenticator side of WebAuthn ceremonies, so that relying
+// party code can be tested end to end without hardware.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/cbor"
+)
+
+var encoding = base64.RawURLEncoding
+
+var (
+	// ErrExcluded is returned by Create when the authenticator already holds
+	// one of the excluded credentials.
+	ErrExcluded = errors.New("authenticator holds an excluded credential")
+	// ErrNoCredential is returned by Get when no credential matches.
+	ErrNoCredential = errors.New("no matching credential")
+)
+
+// Authenticator is a platform authenticator holding ES256 passkeys in memory.
+type Authenticator struct {
+	// AAGUID identifies the authenticator model.
+	AAGUID [16]byte
+	// Attestation is "none", the default, or "packed" for self attestation.
+	Attestation string
+	// SkipUserVerification leaves the UV flag unset, like a security key
+	// used without its PIN.
+	SkipUserVerification bool
+	// Counterless keeps the signature counter at zero, like synced passkeys.
+	Counterless bool
+
+	creds []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+func New() *Authenticator {
+	return &Authenticator{}
+}
+
+// Clone copies the authenticator with its keys and counters, as an attacker
+// extracting them would.
+func (a *Authenticator) Clone() *Authenticator {
+	c := *a
+	c.creds = make([]*credential, len(a.creds))
+	for i, cred := range a.creds {
+		copied := *cred
+		c.creds[i] = &copied
+	}
+	return &c
+}
+
+type descriptor struct {
+	ID string `json:"id"`
+}
+
+type credentialParameter struct {
+	Alg int `json:"alg"`
+}
+
+type creationOptions struct {
+	RP struct {
+		ID string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Challenge          string                `json:"challenge"`
+	PubKeyCredParams   []credentialParameter `json:"pubKeyCredParams"`
+	ExcludeCredentials []descriptor          `json:"excludeCredentials"`
+}
+
+// Create runs navigator.credentials.create() on origin with the JSON
+// creation options and returns the credential's JSON form.
+func (a *Authenticator) Create(options []byte, origin string) ([]byte, error) {
+	var o creationOptions
+	if err := json.Unmarshal(options, &o); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(o.PubKeyCredParams, credentialParameter{Alg: -7}) {
+		return nil, errors.New("ES256 not offered")
+	}
+	for _, d := range o.ExcludeCredentials {
+		if a.find(o.RP.ID, []descriptor{d}) != nil {
+			return nil, ErrExcluded
+		}
+	}
+	userHandle, err := encoding.DecodeString(o.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	cred := &credential{id: make([]byte, 16), rpID: o.RP.ID, userHandle: userHandle, key: key}
+	if _, err := rand.Read(cred.id); err != nil {
+		return nil, err
+	}
+
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	coseKey, err := cbor.Marshal(map[any]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: point[1:33],
+		-3: point[33:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authenticatorData(cred, 0x40)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, coseKey...)
+
+	clientData, err := clientDataJSON("webauthn.create", o.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	stmt := map[any]any{}
+	format := "none"
+	if a.Attestation == "packed" {
+		format = "packed"
+		sig, err := sign(cred.key, authData, clientData)
+		if err != nil {
+			return nil, err
+		}
+		stmt = map[any]any{"alg": -7, "sig": sig}
+	}
+	attObject, err := cbor.Marshal(map[any]any{"fmt": format, "attStmt": stmt, "authData": authData})
+	if err != nil {
+		return nil, err
+	}
+	a.creds = append(a.creds, cred)
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(cred.id),
+		"rawId": encoding.EncodeToString(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(clientData),
+			"attestationObject": encoding.EncodeToString(attObject),
+			"transports":        []string{"internal"},
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+type requestOptions struct {
+	Challenge        string       `json:"challenge"`
+	RPID             string       `json:"rpId"`
+	AllowCredentials []descriptor `json:"allowCredentials"`
+}
+
+// Get runs navigator.credentials.get() on origin with the JSON request
+// options and returns the assertion's JSON form. The newest matching
+// credential is used.
+func (a *Authenticator) Get(options []byte, origin string) ([]byte, error) {
+	var o requestOptions
+	if err := json.Unmarshal(options, &o); err != nil {
+		return nil, err
+	}
+	cred := a.find(o.RPID, o.AllowCredentials)
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+	if !a.Counterless {
+		cred.signCount++
+	}
+	authData := a.authenticatorData(cred, 0)
+	clientData, err := clientDataJSON("webauthn.get", o.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(cred.key, authData, clientData)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]any{
+		"id":    encoding.EncodeToString(cred.id),
+		"rawId": encoding.EncodeToString(cred.id),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    encoding.EncodeToString(clientData),
+			"authenticatorData": encoding.EncodeToString(authData),
+			"signature":         encoding.EncodeToString(sig),
+			"userHandle":        encoding.EncodeToString(cred.userHandle),
+		},
+		"authenticatorAttachment": "platform",
+		"clientExtensionResults":  map[string]any{},
+	})
+}
+
+func (a *Authenticator) find(rpID string, allow []descriptor) *credential {
+	for _, cred := range slices.Backward(a.creds) {
+		if cred.rpID != rpID {
+			continue
+		}
+		if len(allow) == 0 || slices.ContainsFunc(allow, func(d descriptor) bool {
+			id, err := encoding.DecodeString(d.ID)
+			return err == nil && bytes.Equal(id, cred.id)
+		}) {
+			return cred
+		}
+	}
+	return nil
+}
+
+// authenticatorData builds the fixed part of the authenticator data with
+// the presence, verification and backup flags plus extra.
+func (a *Authenticator) authenticatorData(cred *credential, extra byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	flags := byte(0x01) | extra
+	if !a.SkipUserVerification {
+		flags |= 0x04
+	}
+	if a.Counterless {
+		// Synced passkeys are backup eligible and backed up.
+		flags |= 0x08 | 0x10
+	}
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, cred.signCount)
+}
+
+func clientDataJSON(typ, challenge, origin string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      origin,
+		"crossOrigin": false,
+	})
+}
+
+func sign(key *ecdsa.PrivateKey, authData, clientData []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, key, digest[:])
+}
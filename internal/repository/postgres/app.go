@@ -15,7 +15,9 @@ func (s *Storage) App(ctx context.Context, id int32) (models.App, error) {
 
 	var app models.App
 
-	err := s.db.QueryRow(ctx, "SELECT id, name, secret FROM apps WHERE id = $1", id).Scan(&app.ID, &app.Name, &app.Secret)
+	err := s.db.QueryRow(ctx,
+		"SELECT id, name, secret, allow_unverified_login, profile_claims, registration_policy, allowed_email_domains FROM apps WHERE id = $1", id,
+	).Scan(&app.ID, &app.Name, &app.Secret, &app.AllowUnverifiedLogin, &app.ProfileClaims, &app.RegistrationPolicy, &app.AllowedDomains)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.App{}, fmt.Errorf("%s: %w", op, domain.ErrAppNotFound)
@@ -25,3 +27,24 @@ func (s *Storage) App(ctx context.Context, id int32) (models.App, error) {
 
 	return app, nil
 }
+
+// SetRegistrationPolicy replaces the registration policy of the app and the
+// email domains it admits.
+func (s *Storage) SetRegistrationPolicy(ctx context.Context, appID int, policy models.RegistrationPolicy, domains []string) error {
+	const op = "repository.postgres.SetRegistrationPolicy"
+
+	if domains == nil {
+		domains = []string{}
+	}
+	tag, err := s.db.Exec(ctx,
+		"UPDATE apps SET registration_policy = $2, allowed_email_domains = $3 WHERE id = $1", appID, policy, domains,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrAppNotFound)
+	}
+
+	return nil
+}
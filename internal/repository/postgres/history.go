@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveLoginEvent appends the event to the login history. A successful login,
+// MFA step completing one, or passkey login also becomes the user's
+// last_login_at.
+func (s *Storage) SaveLoginEvent(ctx context.Context, event models.LoginEvent) error {
+	const op = "repository.postgres.SaveLoginEvent"
+	_, err := s.db.Exec(ctx, `
+		WITH saved AS (
+			INSERT INTO login_history(user_id, app_id, kind, outcome, ip, user_agent)
+			VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6)
+			RETURNING user_id, created_at
+		)
+		UPDATE users SET last_login_at = saved.created_at
+		FROM saved
+		WHERE users.id = saved.user_id AND $3 IN ('login', 'mfa', 'passkey') AND $4 = 'success'`,
+		event.UserID, event.AppID, event.Kind, event.Outcome, event.Client.IP, event.Client.UserAgent,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// LoginEvents lists the user's events with an id below beforeID, newest
+// first. A zero beforeID starts from the newest event and a non-positive
+// limit lists them all.
+func (s *Storage) LoginEvents(ctx context.Context, userID, beforeID int64, limit int) ([]models.LoginEvent, error) {
+	const op = "repository.postgres.LoginEvents"
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, app_id, kind, outcome, ip, user_agent, created_at
+		FROM login_history
+		WHERE user_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)`,
+		userID, beforeID, max(limit, 0),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.LoginEvent, error) {
+		var e models.LoginEvent
+		err := row.Scan(&e.ID, &e.UserID, &e.AppID, &e.Kind, &e.Outcome, &e.Client.IP, &e.Client.UserAgent, &e.CreatedAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
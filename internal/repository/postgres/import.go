@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportUsers inserts a batch of users carrying possibly foreign password
+// hashes in one round trip, enrolling them in appID unless it is zero.
+// Users whose email or username is already taken are skipped; the number
+// of users actually inserted is returned.
+func (s *Storage) ImportUsers(ctx context.Context, users []models.User, appID int) (int64, error) {
+	const op = "repository.postgres.ImportUsers"
+
+	batch := &pgx.Batch{}
+	for _, user := range users {
+		batch.Queue(`
+			WITH saved AS (
+				INSERT INTO users(email, email_canonical, username, pass_hash, pass_algo, status, email_verified, display_name)
+				VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+				ON CONFLICT DO NOTHING
+				RETURNING id
+			), enrolled AS (
+				INSERT INTO app_memberships(user_id, app_id) SELECT id, $9 FROM saved WHERE $9 <> 0
+			)
+			SELECT COUNT(*) FROM saved`,
+			user.Email, user.EmailCanonical, user.Username, user.PassHash, user.PassAlgo,
+			user.Status, user.EmailVerified, user.DisplayName, appID,
+		)
+	}
+	results := s.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var inserted int64
+	for range users {
+		var n int64
+		if err := results.QueryRow().Scan(&n); err != nil {
+			return inserted, fmt.Errorf("%s: %w", op, err)
+		}
+		inserted += n
+	}
+	if err := results.Close(); err != nil {
+		return inserted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inserted, nil
+}
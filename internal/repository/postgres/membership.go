@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// foreignKeyViolation is the PostgreSQL error code raised when a referenced row is missing.
+const foreignKeyViolation = "23503"
+
+const membershipAppFK = "app_memberships_app_id_fkey"
+
+func (s *Storage) IsMember(ctx context.Context, userID int64, appID int) (bool, error) {
+	const op = "repository.postgres.IsMember"
+	var isMember bool
+	err := s.db.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM app_memberships WHERE user_id = $1 AND app_id = $2)", userID, appID,
+	).Scan(&isMember)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return isMember, nil
+}
+
+// GrantMembership enrolls the user in the app; granting twice is a no-op.
+// It returns domain.ErrUserNotFound or domain.ErrAppNotFound for unknown ids.
+func (s *Storage) GrantMembership(ctx context.Context, userID int64, appID int) error {
+	const op = "repository.postgres.GrantMembership"
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO app_memberships(user_id, app_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, appID,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			if pgErr.ConstraintName == membershipAppFK {
+				return fmt.Errorf("%s: %w", op, domain.ErrAppNotFound)
+			}
+			return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// RevokeMembership removes the user from the app.
+// It returns domain.ErrNotMember if the user was not enrolled.
+func (s *Storage) RevokeMembership(ctx context.Context, userID int64, appID int) error {
+	const op = "repository.postgres.RevokeMembership"
+	tag, err := s.db.Exec(ctx, "DELETE FROM app_memberships WHERE user_id = $1 AND app_id = $2", userID, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrNotMember)
+	}
+	return nil
+}
+
+func (s *Storage) UserMemberships(ctx context.Context, userID int64) ([]models.Membership, error) {
+	const op = "repository.postgres.UserMemberships"
+	rows, err := s.db.Query(ctx, `
+		SELECT m.user_id, m.app_id, a.name, m.created_at
+		FROM app_memberships m JOIN apps a ON a.id = m.app_id
+		WHERE m.user_id = $1 ORDER BY m.created_at`, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	memberships, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Membership, error) {
+		var m models.Membership
+		err := row.Scan(&m.UserID, &m.AppID, &m.AppName, &m.CreatedAt)
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return memberships, nil
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const passkeyColumns = `id, user_id, credential_id, public_key, sign_count, transports, aaguid,
+	backup_eligible, backed_up, created_at, last_used_at`
+
+func scanPasskey(row pgx.Row) (models.Passkey, error) {
+	var p models.Passkey
+	err := row.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &p.SignCount, &p.Transports, &p.AAGUID,
+		&p.BackupEligible, &p.BackedUp, &p.CreatedAt, &p.LastUsedAt)
+	return p, err
+}
+
+// SavePasskey stores a newly registered passkey and returns its id.
+// It returns domain.ErrPasskeyExists if the credential id is taken.
+func (s *Storage) SavePasskey(ctx context.Context, passkey models.Passkey) (int64, error) {
+	const op = "repository.postgres.SavePasskey"
+
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO webauthn_credentials(user_id, credential_id, public_key, sign_count, transports, aaguid,
+			backup_eligible, backed_up)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		passkey.UserID, passkey.CredentialID, passkey.PublicKey, passkey.SignCount, passkey.Transports, passkey.AAGUID,
+		passkey.BackupEligible, passkey.BackedUp,
+	).Scan(&id)
+	if err != nil {
+		if violatedConstraint(err) != "" {
+			return 0, fmt.Errorf("%s: %w", op, domain.ErrPasskeyExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// UserPasskeys lists the user's passkeys, oldest first.
+func (s *Storage) UserPasskeys(ctx context.Context, userID int64) ([]models.Passkey, error) {
+	const op = "repository.postgres.UserPasskeys"
+
+	rows, err := s.db.Query(ctx,
+		"SELECT "+passkeyColumns+" FROM webauthn_credentials WHERE user_id = $1 ORDER BY id", userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	passkeys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Passkey, error) {
+		return scanPasskey(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return passkeys, nil
+}
+
+// PasskeyByCredentialID retrieves the passkey an authenticator knows by
+// credentialID.
+// It returns domain.ErrPasskeyNotFound if no passkey has the id.
+func (s *Storage) PasskeyByCredentialID(ctx context.Context, credentialID []byte) (models.Passkey, error) {
+	const op = "repository.postgres.PasskeyByCredentialID"
+
+	passkey, err := scanPasskey(s.db.QueryRow(ctx,
+		"SELECT "+passkeyColumns+" FROM webauthn_credentials WHERE credential_id = $1", credentialID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Passkey{}, fmt.Errorf("%s: %w", op, domain.ErrPasskeyNotFound)
+		}
+		return models.Passkey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return passkey, nil
+}
+
+// UpdatePasskeyUsage records a login with the passkey. The counter has to
+// grow unless it stays at zero, so that two concurrent logins with the same
+// counter cannot both succeed.
+// It returns domain.ErrInvalidPasskey if the stored counter moved past signCount.
+func (s *Storage) UpdatePasskeyUsage(ctx context.Context, id int64, signCount uint32, backedUp bool) error {
+	const op = "repository.postgres.UpdatePasskeyUsage"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE webauthn_credentials SET sign_count = $2, backed_up = $3, last_used_at = NOW()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))`,
+		id, signCount, backedUp,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrInvalidPasskey)
+	}
+
+	return nil
+}
+
+// SaveWebAuthnChallenge stores the state of a ceremony until it finishes.
+// Expired challenges of abandoned ceremonies are swept on the way.
+func (s *Storage) SaveWebAuthnChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error {
+	const op = "repository.postgres.SaveWebAuthnChallenge"
+
+	_, err := s.db.Exec(ctx, `
+		WITH swept AS (
+			DELETE FROM webauthn_challenges WHERE expires_at <= NOW()
+		)
+		INSERT INTO webauthn_challenges(id, user_id, app_id, ceremony, challenge, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6)`,
+		challenge.ID, challenge.UserID, challenge.AppID, challenge.Ceremony, challenge.Challenge, challenge.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnChallenge deletes the unexpired challenge of ceremony and
+// returns it, so that each ceremony finishes once.
+// It returns domain.ErrInvalidChallenge if there is no such challenge.
+func (s *Storage) ConsumeWebAuthnChallenge(ctx context.Context, id string, ceremony models.WebAuthnCeremony) (models.WebAuthnChallenge, error) {
+	const op = "repository.postgres.ConsumeWebAuthnChallenge"
+
+	var c models.WebAuthnChallenge
+	err := s.db.QueryRow(ctx, `
+		DELETE FROM webauthn_challenges
+		WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+		RETURNING id::text, COALESCE(user_id, 0), app_id, ceremony, challenge, expires_at`,
+		id, ceremony,
+	).Scan(&c.ID, &c.UserID, &c.AppID, &c.Ceremony, &c.Challenge, &c.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.WebAuthnChallenge{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidChallenge)
+		}
+		return models.WebAuthnChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// PreviousPasswords lists the last limit hashes the user's password was
+// replaced from, newest first.
+func (s *Storage) PreviousPasswords(ctx context.Context, userID int64, limit int) ([]models.PreviousPassword, error) {
+	const op = "repository.postgres.PreviousPasswords"
+	rows, err := s.db.Query(ctx,
+		"SELECT pass_hash, pass_algo, created_at FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	previous, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.PreviousPassword, error) {
+		var p models.PreviousPassword
+		err := row.Scan(&p.Hash, &p.Algo, &p.CreatedAt)
+		return p, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return previous, nil
+}
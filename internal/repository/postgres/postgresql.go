@@ -2,11 +2,16 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// uniqueViolation is the PostgreSQL error code raised on unique constraint conflicts.
+const uniqueViolation = "23505"
+
 type Storage struct {
 	db *pgxpool.Pool
 }
@@ -19,3 +24,18 @@ func New(storagePath string) (*Storage, error) {
 	}
 	return &Storage{db: db}, nil
 }
+
+// violatedConstraint returns the name of the unique constraint err was raised
+// for, or an empty string if err is not a unique violation.
+func violatedConstraint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return pgErr.ConstraintName
+	}
+	return ""
+}
+
+// Close releases the connection pool.
+func (s *Storage) Close() {
+	s.db.Close()
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) SaveSession(ctx context.Context, session models.Session) error {
+	const op = "repository.postgres.SaveSession"
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO sessions(id, user_id, app_id, expires_at) VALUES ($1, $2, $3, $4)",
+		session.ID, session.UserID, session.AppID, session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) Session(ctx context.Context, id string) (models.Session, error) {
+	const op = "repository.postgres.Session"
+	var session models.Session
+	err := s.db.QueryRow(ctx,
+		"SELECT id::text, user_id, app_id, created_at, expires_at, revoked_at FROM sessions WHERE id = $1::uuid", id,
+	).Scan(&session.ID, &session.UserID, &session.AppID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return models.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return session, nil
+}
+
+// RevokeSessions revokes every active session of the user except the one
+// with exceptID. An empty exceptID revokes all of them.
+func (s *Storage) RevokeSessions(ctx context.Context, userID int64, exceptID string) error {
+	const op = "repository.postgres.RevokeSessions"
+	_, err := s.db.Exec(ctx, `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL AND ($2 = '' OR id::text <> $2)`,
+		userID, exceptID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Storage) UserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "repository.postgres.UserSessions"
+	rows, err := s.db.Query(ctx,
+		"SELECT id::text, user_id, app_id, created_at, expires_at, revoked_at FROM sessions WHERE user_id = $1 ORDER BY created_at DESC", userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Session, error) {
+		var session models.Session
+		err := row.Scan(&session.ID, &session.UserID, &session.AppID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+		return session, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return sessions, nil
+}
+
+// RevokeAppSessions revokes every active session of the user in the app.
+func (s *Storage) RevokeAppSessions(ctx context.Context, userID int64, appID int) error {
+	const op = "repository.postgres.RevokeAppSessions"
+	_, err := s.db.Exec(ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND app_id = $2 AND revoked_at IS NULL",
+		userID, appID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
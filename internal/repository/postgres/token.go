@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) SaveToken(ctx context.Context, token models.OneTimeToken) (int64, error) {
+	const op = "repository.postgres.SaveToken"
+	var id int64
+	err := s.db.QueryRow(ctx,
+		"INSERT INTO one_time_tokens(user_id, purpose, token_hash, payload, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		token.UserID, token.Purpose, token.Hash, token.Payload, token.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+// FindToken returns an unused, unexpired token without marking it as used.
+func (s *Storage) FindToken(ctx context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	const op = "repository.postgres.FindToken"
+	var token models.OneTimeToken
+	err := s.db.QueryRow(ctx, `
+		SELECT id, user_id, purpose, token_hash, payload, expires_at FROM one_time_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()`,
+		hash, purpose,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Hash, &token.Payload, &token.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.OneTimeToken{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidCode)
+		}
+		return models.OneTimeToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return token, nil
+}
+
+// ConsumeToken atomically marks an unused, unexpired token as used and returns it.
+// Concurrent callers racing for the same token will see domain.ErrInvalidCode
+// in all but one of them.
+func (s *Storage) ConsumeToken(ctx context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	const op = "repository.postgres.ConsumeToken"
+	var token models.OneTimeToken
+	err := s.db.QueryRow(ctx, `
+		UPDATE one_time_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, purpose, token_hash, payload, expires_at`,
+		hash, purpose,
+	).Scan(&token.ID, &token.UserID, &token.Purpose, &token.Hash, &token.Payload, &token.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.OneTimeToken{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidCode)
+		}
+		return models.OneTimeToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return token, nil
+}
+
+// RevokeTokens invalidates every unused token of the user issued for purpose.
+func (s *Storage) RevokeTokens(ctx context.Context, userID int64, purpose models.TokenPurpose) error {
+	const op = "repository.postgres.RevokeTokens"
+	_, err := s.db.Exec(ctx,
+		"UPDATE one_time_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL",
+		userID, purpose,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
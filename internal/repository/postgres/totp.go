@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveTOTP stores a pending enrollment, replacing any earlier unconfirmed one.
+// It returns domain.ErrMFAAlreadyEnabled if the user confirmed one already.
+func (s *Storage) SaveTOTP(ctx context.Context, userID int64, secret []byte) error {
+	const op = "repository.postgres.SaveTOTP"
+
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO user_totp(user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+			SET secret = EXCLUDED.secret, last_step = 0, failed_attempts = 0, last_failure_at = NULL, created_at = NOW()
+			WHERE user_totp.confirmed_at IS NULL`,
+		userID, secret,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrMFAAlreadyEnabled)
+	}
+
+	return nil
+}
+
+// TOTP retrieves the user's enrollment, confirmed or not.
+// It returns domain.ErrMFANotEnrolled if the user has none.
+func (s *Storage) TOTP(ctx context.Context, userID int64) (models.TOTPCredential, error) {
+	const op = "repository.postgres.TOTP"
+
+	c := models.TOTPCredential{UserID: userID}
+	err := s.db.QueryRow(ctx,
+		"SELECT secret, last_step, failed_attempts, last_failure_at, created_at, confirmed_at FROM user_totp WHERE user_id = $1", userID,
+	).Scan(&c.Secret, &c.LastStep, &c.FailedAttempts, &c.LastFailureAt, &c.CreatedAt, &c.ConfirmedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.TOTPCredential{}, fmt.Errorf("%s: %w", op, domain.ErrMFANotEnrolled)
+		}
+		return models.TOTPCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return c, nil
+}
+
+// ConfirmTOTP turns the pending enrollment into a second factor, recording
+// step as used.
+// It returns domain.ErrMFANotEnrolled if no enrollment is pending.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID, step int64) error {
+	const op = "repository.postgres.ConfirmTOTP"
+
+	tag, err := s.db.Exec(ctx,
+		"UPDATE user_totp SET confirmed_at = NOW(), last_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL",
+		userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrMFANotEnrolled)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that a code of step was accepted and clears the count
+// of wrong codes. Steps at or before the last one recorded are refused, so
+// each code works once.
+// It returns domain.ErrInvalidMFACode for such replays.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	const op = "repository.postgres.UseTOTPStep"
+
+	tag, err := s.db.Exec(ctx,
+		"UPDATE user_totp SET last_step = $2, failed_attempts = 0 WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2",
+		userID, step,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrInvalidMFACode)
+	}
+
+	return nil
+}
+
+// RecordTOTPFailure counts a wrong code and returns how many were sent since
+// the last accepted one. A failure more than window after the previous one
+// starts the count again, so a lockout does not outlive its window.
+// It returns domain.ErrMFANotEnrolled if the user has no second factor.
+func (s *Storage) RecordTOTPFailure(ctx context.Context, userID int64, window time.Duration) (int, error) {
+	const op = "repository.postgres.RecordTOTPFailure"
+
+	var failures int
+	err := s.db.QueryRow(ctx, `
+		UPDATE user_totp SET
+			failed_attempts = CASE
+				WHEN last_failure_at IS NULL OR last_failure_at <= NOW() - make_interval(secs => $2) THEN 1
+				ELSE failed_attempts + 1
+			END,
+			last_failure_at = NOW()
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL
+		RETURNING failed_attempts`,
+		userID, window.Seconds(),
+	).Scan(&failures)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, domain.ErrMFANotEnrolled)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures, nil
+}
@@ -4,27 +4,121 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/LockMessage/sso/internal/domain"
 	"github.com/LockMessage/sso/internal/domain/models"
 	"github.com/jackc/pgx/v5"
 )
 
-func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (int64, error) {
+// userColumns lists the columns scanned by scanUser, in order.
+const userColumns = "id, email, COALESCE(email_canonical, ''), COALESCE(username, ''), pass_hash, pass_algo, is_admin, status, email_verified, display_name, locale, avatar_url, created_at, updated_at, last_login_at, password_changed_at, password_breached, deleted_at"
+
+func scanUser(row pgx.Row) (models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.Email, &user.EmailCanonical, &user.Username, &user.PassHash, &user.PassAlgo, &user.IsAdmin, &user.Status, &user.EmailVerified,
+		&user.DisplayName, &user.Locale, &user.AvatarURL,
+		&user.CreatedAt, &user.UpdatedAt, &user.LastLoginAt, &user.PasswordChangedAt, &user.PasswordBreached, &user.DeletedAt,
+	)
+	return user, err
+}
+
+// usernameIndex is the unique index guarding users.username.
+const usernameIndex = "idx_users_username"
+
+// userConflict maps a unique violation on users to the matching domain error.
+func userConflict(err error) error {
+	switch violatedConstraint(err) {
+	case "":
+		return err
+	case usernameIndex:
+		return domain.ErrUsernameTaken
+	default:
+		return domain.ErrUserExists
+	}
+}
+
+// SaveUser stores a new user from its email and its canonical form,
+// optional username, password hash, breach flag and initial status. A non-zero appID
+// enrolls the user in that app in the same statement.
+func (s *Storage) SaveUser(ctx context.Context, user models.User, appID int) (int64, error) {
 	const op = "repository.postgres.SaveUser"
 	var id int64
-	err := s.db.QueryRow(ctx, "INSERT INTO users(email, pass_hash) VALUES ($1, $2) RETURNING id", email, passHash).Scan(&id)
+	err := s.db.QueryRow(ctx, `
+		WITH saved AS (
+			INSERT INTO users(email, email_canonical, username, pass_hash, pass_algo, password_breached, status)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7) RETURNING id
+		), enrolled AS (
+			INSERT INTO app_memberships(user_id, app_id) SELECT id, $8 FROM saved WHERE $8 <> 0
+		)
+		SELECT id FROM saved`,
+		user.Email, user.EmailCanonical, user.Username, user.PassHash, user.PassAlgo, user.PasswordBreached, user.Status, appID,
+	).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		return 0, fmt.Errorf("%s: %w", op, userConflict(err))
 	}
 	return id, nil
 
 }
 
-func (s *Storage) FindByEmail(ctx context.Context, email string) (models.User, error) {
+// emailMatch matches users by canonical email. Accounts listed in
+// email_collisions have no canonical email yet and are matched by their
+// lowercased address instead, oldest first, until an operator resolves them.
+// That fallback misses internationalized domains, which the canonical form
+// holds in punycode.
+const emailMatch = "(email_canonical = $1 OR (email_canonical IS NULL AND LOWER(email) = $1))"
+
+// FindByEmail retrieves a user by their canonical email.
+func (s *Storage) FindByEmail(ctx context.Context, canonical string) (models.User, error) {
 	const op = "repository.postgres.FindByEmail"
-	var user models.User
-	err := s.db.QueryRow(ctx, "SELECT id, email, pass_hash FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.PassHash)
+	user, err := scanUser(s.db.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE "+emailMatch+" AND deleted_at IS NULL ORDER BY id LIMIT 1", canonical,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// FindByLogin retrieves a user by either their canonical email or their
+// username. Usernames cannot contain "@", so the two never collide.
+func (s *Storage) FindByLogin(ctx context.Context, login string) (models.User, error) {
+	const op = "repository.postgres.FindByLogin"
+	user, err := scanUser(s.db.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE ("+emailMatch+" OR username = $1) AND deleted_at IS NULL ORDER BY id LIMIT 1", login,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) FindByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "repository.postgres.FindByID"
+	user, err := scanUser(s.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 AND deleted_at IS NULL", userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *Storage) FindByIDIncludingDeleted(ctx context.Context, userID int64) (models.User, error) {
+	const op = "repository.postgres.FindByIDIncludingDeleted"
+	user, err := scanUser(s.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", userID))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
@@ -40,7 +134,7 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 
 	var isAdmin bool
 
-	err := s.db.QueryRow(ctx, "SELECT is_admin FROM users WHERE id = $1", userID).Scan(&isAdmin)
+	err := s.db.QueryRow(ctx, "SELECT is_admin FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&isAdmin)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return false, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
@@ -50,3 +144,300 @@ func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 
 	return isAdmin, nil
 }
+
+func (s *Storage) SetEmailVerified(ctx context.Context, userID int64) error {
+	const op = "repository.postgres.SetEmailVerified"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET
+			email_verified = TRUE,
+			status = CASE WHEN status = 'pending_verification' THEN 'active' ELSE status END
+		WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the user's password with a new one. Unless keep is
+// zero, the replaced hash joins the user's password history, which is pruned
+// to its keep newest entries.
+func (s *Storage) UpdatePassword(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm, keep int) error {
+	const op = "repository.postgres.UpdatePassword"
+
+	// Every CTE sees the rows as they were before the statement: old still
+	// holds the replaced hash and pruned does not see the one kept below,
+	// hence keep - 1.
+	var id int64
+	err := s.db.QueryRow(ctx, `
+		WITH old AS (
+			SELECT pass_hash, pass_algo FROM users WHERE id = $1 FOR UPDATE
+		), updated AS (
+			UPDATE users SET pass_hash = $2, pass_algo = $3, password_changed_at = NOW() WHERE id = $1 RETURNING id
+		), kept AS (
+			INSERT INTO password_history(user_id, pass_hash, pass_algo)
+			SELECT $1, pass_hash, pass_algo FROM old WHERE $4 > 0
+		), pruned AS (
+			DELETE FROM password_history
+			WHERE $4 > 0 AND user_id = $1 AND id NOT IN (
+				SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $4 - 1
+			)
+		)
+		SELECT id FROM updated`,
+		userID, passHash, algo, keep,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RehashPassword replaces the hash of the user's password with one of the
+// same password made with another scheme. The password history and age
+// are left alone.
+func (s *Storage) RehashPassword(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm) error {
+	const op = "repository.postgres.RehashPassword"
+
+	tag, err := s.db.Exec(ctx, "UPDATE users SET pass_hash = $2, pass_algo = $3 WHERE id = $1", userID, passHash, algo)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// SetPasswordBreached records whether the user's current password was found
+// in a breach corpus.
+func (s *Storage) SetPasswordBreached(ctx context.Context, userID int64, breached bool) error {
+	const op = "repository.postgres.SetPasswordBreached"
+
+	tag, err := s.db.Exec(ctx, "UPDATE users SET password_breached = $2 WHERE id = $1", userID, breached)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// UpdateEmail switches the user to a new, already verified email address.
+// Like SetEmailVerified, it activates users pending verification.
+// It returns domain.ErrUserExists if the address is taken by another user.
+func (s *Storage) UpdateEmail(ctx context.Context, userID int64, email, canonical string) error {
+	const op = "repository.postgres.UpdateEmail"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET
+			email = $2,
+			email_canonical = $3,
+			email_verified = TRUE,
+			status = CASE WHEN status = 'pending_verification' THEN 'active' ELSE status END
+		WHERE id = $1`,
+		userID, email, canonical,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, userConflict(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// SoftDeleteUser marks the user as deleted. Lookups ignore the user from now on.
+func (s *Storage) SoftDeleteUser(ctx context.Context, userID int64) error {
+	const op = "repository.postgres.SoftDeleteUser"
+
+	tag, err := s.db.Exec(ctx, "UPDATE users SET deleted_at = NOW(), status = 'deleted' WHERE id = $1 AND deleted_at IS NULL", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// RestoreUser reverts SoftDeleteUser for a user that has not been purged yet.
+func (s *Storage) RestoreUser(ctx context.Context, userID int64) error {
+	const op = "repository.postgres.RestoreUser"
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET
+			deleted_at = NULL,
+			status = CASE WHEN email_verified THEN 'active' ELSE 'pending_verification' END
+		WHERE id = $1 AND deleted_at IS NOT NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers hard-deletes users soft-deleted before the given moment,
+// along with every row that references them.
+func (s *Storage) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const op = "repository.postgres.PurgeDeletedUsers"
+
+	tag, err := s.db.Exec(ctx, "DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1", deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// UpdateProfile changes the profile fields set in update and returns the updated user.
+func (s *Storage) UpdateProfile(ctx context.Context, userID int64, update models.ProfileUpdate) (models.User, error) {
+	const op = "repository.postgres.UpdateProfile"
+
+	user, err := scanUser(s.db.QueryRow(ctx, `
+		UPDATE users SET
+			username = COALESCE(NULLIF($2, ''), username),
+			display_name = COALESCE($3, display_name),
+			locale = COALESCE($4, locale),
+			avatar_url = COALESCE($5, avatar_url)
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+userColumns,
+		userID, update.Username, update.DisplayName, update.Locale, update.AvatarURL,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, userConflict(err))
+	}
+
+	return user, nil
+}
+
+// ListUsers returns up to limit users matching filter with an id greater than
+// afterID, in ascending id order.
+func (s *Storage) ListUsers(ctx context.Context, filter models.UserFilter, afterID int64, limit int) ([]models.User, error) {
+	const op = "repository.postgres.ListUsers"
+
+	query := "SELECT " + userColumns + " FROM users WHERE id > $1"
+	args := []any{afterID}
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if filter.EmailPrefix != "" {
+		where(`email LIKE $%d || '%%' ESCAPE '\'`, escapeLike(filter.EmailPrefix))
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	} else {
+		query += " AND deleted_at IS NULL"
+	}
+	if filter.IsAdmin != nil {
+		where("is_admin = $%d", *filter.IsAdmin)
+	}
+	if filter.CreatedAfter != nil {
+		where("created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where("created_at < $%d", *filter.CreatedBefore)
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	users, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.User, error) {
+		return scanUser(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *Storage) SetStatus(ctx context.Context, userID int64, status models.UserStatus) error {
+	const op = "repository.postgres.SetStatus"
+
+	tag, err := s.db.Exec(ctx, "UPDATE users SET status = $2 WHERE id = $1 AND deleted_at IS NULL", userID, status)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const op = "repository.postgres.SetAdmin"
+
+	tag, err := s.db.Exec(ctx, "UPDATE users SET is_admin = $2 WHERE id = $1 AND deleted_at IS NULL", userID, isAdmin)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ActivateInvitedUser sets the password of an invited user and activates them
+// with a verified email.
+func (s *Storage) ActivateInvitedUser(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm) error {
+	const op = "repository.postgres.ActivateInvitedUser"
+
+	tag, err := s.db.Exec(ctx,
+		`UPDATE users SET pass_hash = $2, pass_algo = $3, password_changed_at = NOW(), status = $4, email_verified = TRUE
+		WHERE id = $1 AND status = $5`,
+		userID, passHash, algo, models.StatusActive, models.StatusInvited,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// DeleteInvitedUser hard-deletes a user whose invitation was never accepted.
+func (s *Storage) DeleteInvitedUser(ctx context.Context, userID int64) error {
+	const op = "repository.postgres.DeleteInvitedUser"
+
+	tag, err := s.db.Exec(ctx, "DELETE FROM users WHERE id = $1 AND status = $2", userID, models.StatusInvited)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserNotFound)
+	}
+
+	return nil
+}
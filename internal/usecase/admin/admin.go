@@ -0,0 +1,360 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Admin implements the user management use cases reserved to admins.
+type Admin struct {
+	logger      *slog.Logger
+	auth        Authenticator
+	usrProvider UserProvider
+	usrManager  UserManager
+	memberships MembershipManager
+	apps        AppManager
+	sessions    SessionRevoker
+}
+
+// Authenticator resolves the caller of an admin use case from their access token.
+type Authenticator interface {
+	IntrospectToken(ctx context.Context, req models.IntrospectTokenRequest) (models.Introspection, error)
+}
+
+type UserProvider interface {
+	// FindByID returns domain.ErrUserNotFound if no user exists with the id.
+	FindByID(ctx context.Context, userID int64) (models.User, error)
+	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	// ListUsers returns up to limit users matching filter with an id
+	// greater than afterID, in ascending id order.
+	ListUsers(ctx context.Context, filter models.UserFilter, afterID int64, limit int) ([]models.User, error)
+}
+
+type UserManager interface {
+	// SetStatus returns domain.ErrUserNotFound if no user exists with the id.
+	SetStatus(ctx context.Context, userID int64, status models.UserStatus) error
+	// SetAdmin returns domain.ErrUserNotFound if no user exists with the id.
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+}
+
+type MembershipManager interface {
+	// GrantMembership returns domain.ErrUserNotFound or domain.ErrAppNotFound for unknown ids.
+	GrantMembership(ctx context.Context, userID int64, appID int) error
+	// RevokeMembership returns domain.ErrNotMember if the user is not enrolled.
+	RevokeMembership(ctx context.Context, userID int64, appID int) error
+}
+
+type AppManager interface {
+	// SetRegistrationPolicy returns domain.ErrAppNotFound if no app exists with the id.
+	SetRegistrationPolicy(ctx context.Context, appID int, policy models.RegistrationPolicy, domains []string) error
+}
+
+type SessionRevoker interface {
+	// RevokeSessions revokes all sessions of the user except exceptID.
+	RevokeSessions(ctx context.Context, userID int64, exceptID string) error
+	// RevokeAppSessions revokes all sessions of the user in the app.
+	RevokeAppSessions(ctx context.Context, userID int64, appID int) error
+}
+
+func New(
+	log *slog.Logger,
+	auth Authenticator,
+	userProvider UserProvider,
+	userManager UserManager,
+	memberships MembershipManager,
+	apps AppManager,
+	sessions SessionRevoker,
+) *Admin {
+	return &Admin{
+		logger:      log,
+		auth:        auth,
+		usrProvider: userProvider,
+		usrManager:  userManager,
+		memberships: memberships,
+		apps:        apps,
+		sessions:    sessions,
+	}
+}
+
+// authorize returns the caller behind the access token, or
+// domain.ErrPermissionDenied if they are not an admin.
+func (a *Admin) authorize(ctx context.Context, appID int32, accessToken string) (models.User, error) {
+	info, err := a.auth.IntrospectToken(ctx, models.IntrospectTokenRequest{AppID: appID, AccessToken: accessToken})
+	if err != nil {
+		return models.User{}, err
+	}
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, info.User.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !isAdmin {
+		return models.User{}, domain.ErrPermissionDenied
+	}
+	return info.User, nil
+}
+
+// ListUsers returns one page of the users matching the request filter.
+func (a *Admin) ListUsers(ctx context.Context, req models.ListUsersRequest) (models.UserPage, error) {
+	const op = "admin.ListUsers"
+	if _, err := a.authorize(ctx, req.AppID, req.AccessToken); err != nil {
+		return models.UserPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	afterID, err := decodeCursor(req.Cursor)
+	if err != nil {
+		return models.UserPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	req.Filter.EmailPrefix = strings.ToLower(strings.TrimSpace(req.Filter.EmailPrefix))
+	limit := req.PageSize
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+	// One extra row tells whether another page follows.
+	users, err := a.usrProvider.ListUsers(ctx, req.Filter, afterID, limit+1)
+	if err != nil {
+		a.logger.Error("failed to list users", slog.String("op", op), sl.Err(err))
+		return models.UserPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	var page models.UserPage
+	if len(users) > limit {
+		users = users[:limit]
+		page.NextCursor = encodeCursor(users[limit-1].ID)
+	}
+	for i := range users {
+		users[i].PassHash = nil
+	}
+	page.Users = users
+	return page, nil
+}
+
+// GetUser returns any user, email included.
+func (a *Admin) GetUser(ctx context.Context, req models.AdminUserRequest) (models.User, error) {
+	const op = "admin.GetUser"
+	if _, err := a.authorize(ctx, req.AppID, req.AccessToken); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.findUser(ctx, req.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+// DisableUser blocks the user from logging in and ends all their sessions.
+// Pending invitations cannot be disabled, only revoked: a later EnableUser
+// would otherwise leave an account the invitee can no longer accept.
+func (a *Admin) DisableUser(ctx context.Context, req models.AdminUserRequest) (models.User, error) {
+	const op = "admin.DisableUser"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", req.UserID),
+	)
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if caller.ID == req.UserID {
+		return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrSelfModification)
+	}
+	user, err := a.findUser(ctx, req.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Status == models.StatusInvited {
+		return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrInvitationPending)
+	}
+	if err := a.usrManager.SetStatus(ctx, req.UserID, models.StatusDisabled); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.sessions.RevokeSessions(ctx, req.UserID, ""); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user disabled", slog.Int64("admin_id", caller.ID))
+	user.Status = models.StatusDisabled
+	return user, nil
+}
+
+// EnableUser lifts a disable. Users who never confirmed their
+// email go back to pending verification rather than active.
+func (a *Admin) EnableUser(ctx context.Context, req models.AdminUserRequest) (models.User, error) {
+	const op = "admin.EnableUser"
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.findUser(ctx, req.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Status != models.StatusDisabled {
+		return user, nil
+	}
+	user.Status = models.StatusActive
+	if !user.EmailVerified {
+		user.Status = models.StatusPendingVerification
+	}
+	if err := a.usrManager.SetStatus(ctx, user.ID, user.Status); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	a.logger.Info("user enabled", slog.String("op", op),
+		slog.Int64("user_id", user.ID), slog.Int64("admin_id", caller.ID))
+	return user, nil
+}
+
+// SetAdmin grants or revokes the admin role. Admins cannot demote themselves,
+// so there is always at least one admin left.
+func (a *Admin) SetAdmin(ctx context.Context, req models.SetAdminRequest) (models.User, error) {
+	const op = "admin.SetAdmin"
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if caller.ID == req.UserID && !req.IsAdmin {
+		return models.User{}, fmt.Errorf("%s: %w", op, domain.ErrSelfModification)
+	}
+	if err := a.usrManager.SetAdmin(ctx, req.UserID, req.IsAdmin); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	a.logger.Info("admin role changed", slog.String("op", op),
+		slog.Int64("user_id", req.UserID), slog.Int64("admin_id", caller.ID),
+		slog.Bool("is_admin", req.IsAdmin))
+	user, err := a.findUser(ctx, req.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+// GrantMembership enrolls a user in an app so they can log in to it.
+func (a *Admin) GrantMembership(ctx context.Context, req models.MembershipRequest) error {
+	const op = "admin.GrantMembership"
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := a.usrProvider.FindByID(ctx, req.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.memberships.GrantMembership(ctx, req.UserID, int(req.TargetAppID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.logger.Info("membership granted", slog.String("op", op),
+		slog.Int64("user_id", req.UserID), slog.Int("app_id", int(req.TargetAppID)),
+		slog.Int64("admin_id", caller.ID))
+	return nil
+}
+
+// RevokeMembership removes a user from an app and ends their sessions in it.
+func (a *Admin) RevokeMembership(ctx context.Context, req models.MembershipRequest) error {
+	const op = "admin.RevokeMembership"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", req.UserID),
+		slog.Int("app_id", int(req.TargetAppID)),
+	)
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.memberships.RevokeMembership(ctx, req.UserID, int(req.TargetAppID)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.sessions.RevokeAppSessions(ctx, req.UserID, int(req.TargetAppID)); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("membership revoked", slog.Int64("admin_id", caller.ID))
+	return nil
+}
+
+// SetRegistrationPolicy changes who may register through an app. Domains
+// are only kept for the domain policy, which needs at least one.
+func (a *Admin) SetRegistrationPolicy(ctx context.Context, req models.SetRegistrationPolicyRequest) error {
+	const op = "admin.SetRegistrationPolicy"
+	caller, err := a.authorize(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	domains, err := registrationDomains(req.Policy, req.AllowedDomains)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.apps.SetRegistrationPolicy(ctx, int(req.TargetAppID), req.Policy, domains); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	a.logger.Info("registration policy changed", slog.String("op", op),
+		slog.Int("app_id", int(req.TargetAppID)), slog.String("policy", string(req.Policy)),
+		slog.Any("domains", domains), slog.Int64("admin_id", caller.ID))
+	return nil
+}
+
+// registrationDomains validates policy and returns the normalized domains to store with it.
+func registrationDomains(policy models.RegistrationPolicy, domains []string) ([]string, error) {
+	if !policy.Valid() {
+		return nil, domain.ErrInvalidRegistrationPolicy
+	}
+	if policy != models.RegistrationDomain {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		n, err := validation.NormalizeDomain(d)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(normalized, n) {
+			normalized = append(normalized, n)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, domain.ErrInvalidRegistrationPolicy
+	}
+	return normalized, nil
+}
+
+func (a *Admin) findUser(ctx context.Context, userID int64) (models.User, error) {
+	user, err := a.usrProvider.FindByID(ctx, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	user.PassHash = nil
+	return user, nil
+}
+
+// encodeCursor makes the opaque cursor resuming a listing after userID.
+func encodeCursor(userID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(userID, 10)))
+}
+
+// decodeCursor returns the user id a cursor resumes after; the empty
+// cursor starts from the beginning.
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, domain.ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil || id < 0 {
+		return 0, domain.ErrInvalidCursor
+	}
+	return id, nil
+}
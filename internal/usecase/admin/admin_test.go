@@ -0,0 +1,383 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, id := range []int64{1, 42, 1 << 40} {
+		got, err := decodeCursor(encodeCursor(id))
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%d)): %v", id, err)
+		}
+		if got != id {
+			t.Errorf("round trip of %d gave %d", id, got)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    int64
+		wantErr error
+	}{
+		{name: "empty starts from the beginning", cursor: "", want: 0},
+		{name: "not base64", cursor: "!!!", wantErr: domain.ErrInvalidCursor},
+		{name: "not a number", cursor: "YWJj", wantErr: domain.ErrInvalidCursor},
+		{name: "negative", cursor: "LTE", wantErr: domain.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decodeCursor(%q) error = %v, want %v", tt.cursor, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeCursor(%q) = %d, want %d", tt.cursor, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeStore implements the dependencies of Admin in memory. Access tokens
+// are "token-<user id>".
+type fakeStore struct {
+	users   map[int64]models.User
+	revoked []int64
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{users: map[int64]models.User{}}
+}
+
+// add stores an active, verified user with the given email.
+func (s *fakeStore) add(id int64, email string, isAdmin bool) models.User {
+	user := models.User{
+		ID:            id,
+		Email:         email,
+		PassHash:      []byte("hash"),
+		Status:        models.StatusActive,
+		EmailVerified: true,
+		IsAdmin:       isAdmin,
+		CreatedAt:     time.Date(2026, 1, int(id), 0, 0, 0, 0, time.UTC),
+	}
+	s.users[id] = user
+	return user
+}
+
+func token(id int64) string {
+	return "token-" + strconv.FormatInt(id, 10)
+}
+
+func (s *fakeStore) IntrospectToken(_ context.Context, req models.IntrospectTokenRequest) (models.Introspection, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(req.AccessToken, "token-"), 10, 64)
+	user, ok := s.users[id]
+	if err != nil || !ok {
+		return models.Introspection{}, domain.ErrInvalidToken
+	}
+	return models.Introspection{User: user, AppID: int(req.AppID)}, nil
+}
+
+func (s *fakeStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *fakeStore) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	user, err := s.FindByID(ctx, userID)
+	return user.IsAdmin, err
+}
+
+// ListUsers filters like the postgres repository.
+func (s *fakeStore) ListUsers(_ context.Context, filter models.UserFilter, afterID int64, limit int) ([]models.User, error) {
+	var users []models.User
+	for _, id := range slices.Sorted(maps.Keys(s.users)) {
+		u := s.users[id]
+		switch {
+		case id <= afterID,
+			!strings.HasPrefix(u.Email, filter.EmailPrefix),
+			filter.Status == "" && u.Status == models.StatusDeleted,
+			filter.Status != "" && u.Status != filter.Status,
+			filter.IsAdmin != nil && u.IsAdmin != *filter.IsAdmin,
+			filter.CreatedAfter != nil && u.CreatedAt.Before(*filter.CreatedAfter),
+			filter.CreatedBefore != nil && !u.CreatedAt.Before(*filter.CreatedBefore):
+			continue
+		}
+		if len(users) == limit {
+			break
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (s *fakeStore) SetStatus(_ context.Context, userID int64, status models.UserStatus) error {
+	user, ok := s.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.Status = status
+	s.users[userID] = user
+	return nil
+}
+
+func (s *fakeStore) SetAdmin(_ context.Context, userID int64, isAdmin bool) error {
+	user, ok := s.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.IsAdmin = isAdmin
+	s.users[userID] = user
+	return nil
+}
+
+func (s *fakeStore) GrantMembership(context.Context, int64, int) error  { return nil }
+func (s *fakeStore) RevokeMembership(context.Context, int64, int) error { return nil }
+
+func (s *fakeStore) SetRegistrationPolicy(context.Context, int, models.RegistrationPolicy, []string) error {
+	return nil
+}
+
+func (s *fakeStore) RevokeSessions(_ context.Context, userID int64, _ string) error {
+	s.revoked = append(s.revoked, userID)
+	return nil
+}
+
+func (s *fakeStore) RevokeAppSessions(context.Context, int64, int) error { return nil }
+
+func newTestAdmin(store *fakeStore) *Admin {
+	return New(slog.New(slog.DiscardHandler), store, store, store, store, store, store)
+}
+
+func TestAuthorize(t *testing.T) {
+	store := newFakeStore()
+	a := newTestAdmin(store)
+	store.add(1, "root@example.com", true)
+	store.add(2, "bob@example.com", false)
+
+	_, err := a.ListUsers(context.Background(), models.ListUsersRequest{AppID: 1, AccessToken: token(2)})
+	if !errors.Is(err, domain.ErrPermissionDenied) {
+		t.Errorf("ListUsers() by a regular user error = %v, want ErrPermissionDenied", err)
+	}
+	_, err = a.ListUsers(context.Background(), models.ListUsersRequest{AppID: 1, AccessToken: "forged"})
+	if !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("ListUsers() with a forged token error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	a := newTestAdmin(store)
+	store.add(1, "root@example.com", true)
+	store.add(2, "bob@example.com", false)
+	store.add(3, "bella@example.com", false)
+	store.add(4, "carl@example.com", false)
+	gone := store.add(5, "bert@example.com", false)
+	gone.Status = models.StatusDeleted
+	store.users[gone.ID] = gone
+	disabled := store.add(6, "bill@example.com", false)
+	disabled.Status = models.StatusDisabled
+	store.users[disabled.ID] = disabled
+
+	no := false
+	jan3 := time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter models.UserFilter
+		want   []int64
+	}{
+		{"everyone but the deleted", models.UserFilter{}, []int64{1, 2, 3, 4, 6}},
+		{"email prefix is normalized", models.UserFilter{EmailPrefix: "  B"}, []int64{2, 3, 6}},
+		{"status", models.UserFilter{Status: models.StatusDisabled}, []int64{6}},
+		{"deleted only on request", models.UserFilter{Status: models.StatusDeleted}, []int64{5}},
+		{"regular users", models.UserFilter{IsAdmin: &no}, []int64{2, 3, 4, 6}},
+		{"created range", models.UserFilter{CreatedAfter: &jan3}, []int64{3, 4, 6}},
+		{"filters combine", models.UserFilter{EmailPrefix: "b", CreatedBefore: &jan3}, []int64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := a.ListUsers(ctx, models.ListUsersRequest{AppID: 1, AccessToken: token(1), Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("ListUsers() error = %v", err)
+			}
+			if got := userIDs(page.Users); !slices.Equal(got, tt.want) {
+				t.Errorf("ListUsers() = %v, want %v", got, tt.want)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("NextCursor = %q on the only page", page.NextCursor)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var got [][]int64
+		req := models.ListUsersRequest{AppID: 1, AccessToken: token(1), PageSize: 2}
+		for {
+			page, err := a.ListUsers(ctx, req)
+			if err != nil {
+				t.Fatalf("ListUsers() error = %v", err)
+			}
+			got = append(got, userIDs(page.Users))
+			for _, u := range page.Users {
+				if u.PassHash != nil {
+					t.Errorf("user %d listed with its password hash", u.ID)
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			req.Cursor = page.NextCursor
+		}
+		want := [][]int64{{1, 2}, {3, 4}, {6}}
+		if !slices.EqualFunc(got, want, slices.Equal) {
+			t.Errorf("pages = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := a.ListUsers(ctx, models.ListUsersRequest{AppID: 1, AccessToken: token(1), Cursor: "!!!"})
+		if !errors.Is(err, domain.ErrInvalidCursor) {
+			t.Errorf("ListUsers() error = %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func userIDs(users []models.User) []int64 {
+	ids := make([]int64, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestDisableUser(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	a := newTestAdmin(store)
+	store.add(1, "root@example.com", true)
+	store.add(2, "bob@example.com", false)
+
+	_, err := a.DisableUser(ctx, models.AdminUserRequest{AppID: 1, AccessToken: token(1), UserID: 1})
+	if !errors.Is(err, domain.ErrSelfModification) {
+		t.Errorf("DisableUser() of oneself error = %v, want ErrSelfModification", err)
+	}
+	if store.users[1].Status != models.StatusActive || len(store.revoked) != 0 {
+		t.Error("refused self-disable changed the caller")
+	}
+
+	user, err := a.DisableUser(ctx, models.AdminUserRequest{AppID: 1, AccessToken: token(1), UserID: 2})
+	if err != nil {
+		t.Fatalf("DisableUser() error = %v", err)
+	}
+	if user.Status != models.StatusDisabled || store.users[2].Status != models.StatusDisabled {
+		t.Errorf("status = %q, want disabled", user.Status)
+	}
+	if !slices.Equal(store.revoked, []int64{2}) {
+		t.Errorf("revoked sessions of %v, want [2]", store.revoked)
+	}
+	if user.PassHash != nil {
+		t.Error("DisableUser() returned the password hash")
+	}
+
+	invited := store.add(3, "eve@example.com", false)
+	invited.Status, invited.EmailVerified = models.StatusInvited, false
+	store.users[invited.ID] = invited
+	_, err = a.DisableUser(ctx, models.AdminUserRequest{AppID: 1, AccessToken: token(1), UserID: 3})
+	if !errors.Is(err, domain.ErrInvitationPending) {
+		t.Errorf("DisableUser() of an invited user error = %v, want ErrInvitationPending", err)
+	}
+	if store.users[3].Status != models.StatusInvited || !slices.Equal(store.revoked, []int64{2}) {
+		t.Error("refused disable changed the invited user")
+	}
+
+	_, err = a.DisableUser(ctx, models.AdminUserRequest{AppID: 1, AccessToken: token(1), UserID: 99})
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("DisableUser() of an unknown user error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestEnableUser(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		status   models.UserStatus
+		verified bool
+		want     models.UserStatus
+	}{
+		{"disabled", models.StatusDisabled, true, models.StatusActive},
+		{"never verified", models.StatusDisabled, false, models.StatusPendingVerification},
+		{"already active", models.StatusActive, true, models.StatusActive},
+		{"pending is left alone", models.StatusPendingVerification, false, models.StatusPendingVerification},
+		{"invited is left alone", models.StatusInvited, false, models.StatusInvited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			a := newTestAdmin(store)
+			store.add(1, "root@example.com", true)
+			user := store.add(2, "bob@example.com", false)
+			user.Status, user.EmailVerified = tt.status, tt.verified
+			store.users[user.ID] = user
+
+			got, err := a.EnableUser(ctx, models.AdminUserRequest{AppID: 1, AccessToken: token(1), UserID: 2})
+			if err != nil {
+				t.Fatalf("EnableUser() error = %v", err)
+			}
+			if got.Status != tt.want || store.users[2].Status != tt.want {
+				t.Errorf("status = %q (stored %q), want %q", got.Status, store.users[2].Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAdmin(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	a := newTestAdmin(store)
+	store.add(1, "root@example.com", true)
+	store.add(2, "bob@example.com", false)
+
+	_, err := a.SetAdmin(ctx, models.SetAdminRequest{AppID: 1, AccessToken: token(1), UserID: 1, IsAdmin: false})
+	if !errors.Is(err, domain.ErrSelfModification) {
+		t.Errorf("SetAdmin() demoting oneself error = %v, want ErrSelfModification", err)
+	}
+	if !store.users[1].IsAdmin {
+		t.Error("refused self-demotion demoted the caller")
+	}
+	if _, err := a.SetAdmin(ctx, models.SetAdminRequest{AppID: 1, AccessToken: token(1), UserID: 1, IsAdmin: true}); err != nil {
+		t.Errorf("SetAdmin() keeping oneself admin error = %v", err)
+	}
+
+	user, err := a.SetAdmin(ctx, models.SetAdminRequest{AppID: 1, AccessToken: token(1), UserID: 2, IsAdmin: true})
+	if err != nil {
+		t.Fatalf("SetAdmin() error = %v", err)
+	}
+	if !user.IsAdmin {
+		t.Error("SetAdmin() did not promote the user")
+	}
+	// The new admin may now demote the one who promoted them.
+	user, err = a.SetAdmin(ctx, models.SetAdminRequest{AppID: 1, AccessToken: token(2), UserID: 1, IsAdmin: false})
+	if err != nil {
+		t.Fatalf("SetAdmin() error = %v", err)
+	}
+	if user.IsAdmin {
+		t.Error("SetAdmin() did not demote the user")
+	}
+}
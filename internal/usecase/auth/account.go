@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// DeleteAccount soft-deletes the authenticated user. Login and refresh stop
+// working right away, and the user is emailed a link that restores the
+// account until the grace period runs out.
+func (a *Auth) DeleteAccount(ctx context.Context, req models.DeleteAccountRequest) error {
+	const op = "auth.DeleteAccount"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("deleting account")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.verifyPassword(p.user, req.Password); err != nil {
+		log.Warn("wrong password", slog.Int64("user_id", p.user.ID))
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	if err := a.usrSaver.SoftDeleteUser(ctx, p.user.ID); err != nil {
+		log.Error("failed to delete user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.sessions.RevokeSessions(ctx, p.user.ID, ""); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := a.issueCode(ctx, p.user.ID, models.PurposeAccountRestore, a.cfg.DeletionGracePeriod)
+	if err != nil {
+		log.Error("failed to issue restore code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      p.user.Email,
+		Subject: "Your account is scheduled for deletion",
+		Body: fmt.Sprintf("Your account and its data will be deleted permanently on %s.\n\n"+
+			"Changed your mind? Use this link to keep your account:\n\n%s",
+			time.Now().UTC().Add(a.cfg.DeletionGracePeriod).Format(time.DateOnly), a.link("/cancel-deletion", code)),
+	})
+	if err != nil {
+		log.Error("failed to send deletion notice", sl.Err(err))
+	}
+	log.Info("account deleted", slog.Int64("user_id", p.user.ID))
+	return nil
+}
+
+// CancelDeletion redeems the link sent by DeleteAccount and restores the account.
+func (a *Auth) CancelDeletion(ctx context.Context, req models.CancelDeletionRequest) error {
+	const op = "auth.CancelDeletion"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("cancelling account deletion")
+	token, err := a.consumeCode(ctx, models.PurposeAccountRestore, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.usrSaver.RestoreUser(ctx, token.UserID); err != nil {
+		log.Error("failed to restore user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("account restored", slog.Int64("user_id", token.UserID))
+	return nil
+}
+
+// PurgeDeletedAccounts hard-deletes accounts whose grace period has run out.
+// It is run periodically by the purge job.
+func (a *Auth) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	const op = "auth.PurgeDeletedAccounts"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	purged, err := a.usrSaver.PurgeDeletedUsers(ctx, time.Now().UTC().Add(-a.cfg.DeletionGracePeriod))
+	if err != nil {
+		log.Error("failed to purge deleted users", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if purged > 0 {
+		log.Info("purged deleted accounts", slog.Int64("count", purged))
+	}
+	return purged, nil
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/onetime"
+)
+
+// accountStore keeps in memory what the account deletion use cases read
+// and write. The embedded interfaces are left nil: calling their other
+// methods panics.
+type accountStore struct {
+	UserSaver
+	UserProvider
+	SessionStorage
+	TokenStorage
+
+	mu       sync.Mutex
+	user     models.User
+	app      models.App
+	tokens   []models.OneTimeToken
+	sessions map[string]models.Session
+	messages []models.Message
+}
+
+func (s *accountStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID || s.user.DeletedAt != nil {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *accountStore) SoftDeleteUser(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID || s.user.DeletedAt != nil {
+		return domain.ErrUserNotFound
+	}
+	now := time.Now().UTC()
+	s.user.DeletedAt, s.user.Status = &now, models.StatusDeleted
+	return nil
+}
+
+func (s *accountStore) RestoreUser(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID || s.user.DeletedAt == nil {
+		return domain.ErrUserNotFound
+	}
+	s.user.DeletedAt, s.user.Status = nil, models.StatusActive
+	return nil
+}
+
+func (s *accountStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *accountStore) SaveToken(_ context.Context, token models.OneTimeToken) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = int64(len(s.tokens) + 1)
+	s.tokens = append(s.tokens, token)
+	return token.ID, nil
+}
+
+func (s *accountStore) ConsumeToken(_ context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.tokens {
+		if t.Purpose == purpose && bytes.Equal(t.Hash, hash) && time.Now().Before(t.ExpiresAt) {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return t, nil
+		}
+	}
+	return models.OneTimeToken{}, domain.ErrInvalidCode
+}
+
+func (s *accountStore) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *accountStore) Session(_ context.Context, id string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *accountStore) RevokeSessions(_ context.Context, userID int64, exceptID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (s *accountStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func newAccountAuth(t *testing.T) (*Auth, *accountStore, string) {
+	t.Helper()
+	passHash := testHash(t, oldPassword)
+	store := &accountStore{
+		user:     models.User{ID: 42, Email: "bob@example.com", PassHash: passHash, PassAlgo: models.AlgoArgon2id, Status: models.StatusActive},
+		app:      models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:       slog.New(slog.DiscardHandler),
+		hasher:       testHasher,
+		usrSaver:     store,
+		usrProvider:  store,
+		appProvider:  store,
+		jwtAdapter:   jwt.New(time.Hour, 24*time.Hour),
+		tokenStorage: store,
+		sessions:     store,
+		codeIssuer:   onetime.New("code-secret"),
+		mailer:       store,
+		cfg:          Config{SessionTTL: 24 * time.Hour, DeletionGracePeriod: 30 * 24 * time.Hour},
+	}
+	access, _, err := a.startSession(context.Background(), store.user, store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, store, access
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	a, store, access := newAccountAuth(t)
+
+	err := a.DeleteAccount(ctx, models.DeleteAccountRequest{AppID: 1, AccessToken: access, Password: "wrong"})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("DeleteAccount() with a wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if store.user.DeletedAt != nil {
+		t.Fatal("refused deletion deleted the account")
+	}
+
+	err = a.DeleteAccount(ctx, models.DeleteAccountRequest{AppID: 1, AccessToken: access, Password: oldPassword})
+	if err != nil {
+		t.Fatalf("DeleteAccount() error = %v", err)
+	}
+	if store.user.DeletedAt == nil || store.user.Status != models.StatusDeleted {
+		t.Errorf("user after deletion = %+v, want soft-deleted", store.user)
+	}
+	if _, err := a.authenticate(ctx, 1, access); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("authenticate() after deletion error = %v, want ErrInvalidToken", err)
+	}
+	if len(store.messages) != 1 || store.messages[0].Subject != "Your account is scheduled for deletion" {
+		t.Errorf("messages = %+v, want the deletion notice", store.messages)
+	}
+}
+
+func TestCancelDeletion(t *testing.T) {
+	ctx := context.Background()
+	a, store, access := newAccountAuth(t)
+	if err := a.DeleteAccount(ctx, models.DeleteAccountRequest{AppID: 1, AccessToken: access, Password: oldPassword}); err != nil {
+		t.Fatalf("DeleteAccount() error = %v", err)
+	}
+	body := store.messages[0].Body
+	code := body[strings.LastIndex(body, "\n")+1:]
+
+	if err := a.CancelDeletion(ctx, models.CancelDeletionRequest{Code: "bogus.code"}); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("CancelDeletion() with a bogus code error = %v, want ErrInvalidCode", err)
+	}
+	if err := a.CancelDeletion(ctx, models.CancelDeletionRequest{Code: code}); err != nil {
+		t.Fatalf("CancelDeletion() error = %v", err)
+	}
+	if store.user.DeletedAt != nil || store.user.Status != models.StatusActive {
+		t.Errorf("user after restore = %+v, want active", store.user)
+	}
+	// Sessions revoked by the deletion stay revoked.
+	if _, err := a.authenticate(ctx, 1, access); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("authenticate() of a session revoked by the deletion error = %v, want ErrInvalidToken", err)
+	}
+	if err := a.CancelDeletion(ctx, models.CancelDeletionRequest{Code: code}); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("second CancelDeletion() error = %v, want ErrInvalidCode", err)
+	}
+}
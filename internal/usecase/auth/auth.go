@@ -5,22 +5,111 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/LockMessage/sso/internal/domain"
 	"github.com/LockMessage/sso/internal/domain/models"
 	"github.com/LockMessage/sso/internal/domain/rules/validation"
 	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn"
+	"github.com/google/uuid"
 )
 
 type Auth struct {
-	logger      *slog.Logger
-	usrSaver    UserSaver
-	usrProvider UserProvider
-	appProvider AppProvider
-	jwtAdapter  JwtAdapter
+	logger       *slog.Logger
+	usrSaver     UserSaver
+	usrProvider  UserProvider
+	appProvider  AppProvider
+	jwtAdapter   JwtAdapter
+	hasher       PasswordHasher
+	breaches     BreachChecker
+	sealer       SecretSealer
+	tokenStorage TokenStorage
+	sessions     SessionStorage
+	memberships  MembershipStorage
+	history      LoginHistory
+	mfa          MFAStorage
+	passkeys     PasskeyStorage
+	codeIssuer   CodeIssuer
+	mailer       Mailer
+	cfg          Config
+
+	// dummyHash is verified against when a login names no user, so that
+	// unknown logins cost as much as wrong passwords.
+	dummyHash []byte
+	dummyAlgo models.PasswordAlgorithm
+}
+
+// Config holds the tunables of the auth use cases.
+type Config struct {
+	// VerificationTTL is how long an email verification code stays valid.
+	VerificationTTL time.Duration
+	// PasswordResetTTL is how long a password reset code stays valid.
+	PasswordResetTTL time.Duration
+	// EmailChangeTTL is how long the code confirming a new email stays valid.
+	EmailChangeTTL time.Duration
+	// EmailChangeUndoTTL is how long the old address can undo an email change.
+	EmailChangeUndoTTL time.Duration
+	// InvitationTTL is how long an invitation can be accepted.
+	InvitationTTL time.Duration
+	// DeletionGracePeriod is how long a deleted account can be restored
+	// before its data is purged.
+	DeletionGracePeriod time.Duration
+	// SessionTTL is how long a session lives; it matches the refresh token TTL.
+	SessionTTL time.Duration
+	// EmailPolicy decides which addresses are the same identity.
+	EmailPolicy validation.EmailPolicy
+	// PasswordPolicy decides which passwords users may choose.
+	PasswordPolicy validation.PasswordPolicy
+	// PasswordMaxAge is how long passwords stay valid, per role.
+	PasswordMaxAge PasswordMaxAge
+	// PasswordChangeTokenTTL is how long the token issued to users whose
+	// password expired stays valid.
+	PasswordChangeTokenTTL time.Duration
+	// PasswordHistorySize is how many of the user's last passwords, the
+	// current one included, cannot be chosen again. Zero allows any.
+	PasswordHistorySize int
+	// FlagBreachedPasswords accepts passwords found in the breach corpus and
+	// flags their users instead of refusing them.
+	FlagBreachedPasswords bool
+	// ConcealRegistrationConflicts makes registering or changing to a taken
+	// email look like a success. The owner of the address is told about the
+	// attempt instead, and RegisterNewUser returns a zero id for every
+	// registration.
+	ConcealRegistrationConflicts bool
+	// MFAIssuer names the service in authenticator apps.
+	MFAIssuer string
+	// MFAChallengeTTL is how long the token issued to users with a second
+	// factor stays valid for VerifyMFA.
+	MFAChallengeTTL time.Duration
+	// MFAMaxFailures is how many wrong codes VerifyMFA takes before it
+	// refuses codes for MFALockout after the last one. Once the lockout is
+	// over, the count starts again. Zero allows any.
+	MFAMaxFailures int
+	MFALockout     time.Duration
+	// RelyingParty is what passkeys are scoped to. Passkeys are unavailable
+	// while its ID is empty.
+	RelyingParty webauthn.RelyingParty
+	// PasskeyChallengeTTL is how long a passkey ceremony may take between
+	// its begin and finish calls.
+	PasskeyChallengeTTL time.Duration
+	// PublicURL is the base of the links sent to users by email.
+	// When empty, messages carry the bare code instead of a link.
+	PublicURL string
+}
+
+// PasswordMaxAge sets how long a password may be used before it has to be
+// changed. Zero durations never expire.
+type PasswordMaxAge struct {
+	Admin time.Duration
+	User  time.Duration
 }
 
+// tokenTypePasswordChange is the scope of the token issued instead of a
+// token pair when the password expired. It only allows ChangePassword.
+const tokenTypePasswordChange = "password_change"
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 )
@@ -29,14 +118,67 @@ var (
 // It returns an error if the user already exists or if there's a database error.
 // The user's ID field will be populated with the generated identifier.
 type UserSaver interface {
-	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
+	// SaveUser stores the user's email, optional username and password hash,
+	// and enrolls them in appID unless it is zero.
+	// It returns domain.ErrUserExists or domain.ErrUsernameTaken on conflicts.
+	SaveUser(ctx context.Context, user models.User, appID int) (uid int64, err error)
+	// SetEmailVerified marks the user's email as verified and activates
+	// users pending verification.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	SetEmailVerified(ctx context.Context, userID int64) error
+	// UpdatePassword replaces the user's password hash and the algorithm it was made with.
+	// Unless keep is zero, the replaced hash is kept in the user's password
+	// history, which is pruned to its keep newest entries.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	UpdatePassword(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm, keep int) error
+	// RehashPassword replaces the hash of the user's current password,
+	// leaving its history and age alone.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	RehashPassword(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm) error
+	// SetPasswordBreached records whether the user's current password was
+	// found in a breach corpus.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	SetPasswordBreached(ctx context.Context, userID int64, breached bool) error
+	// UpdateEmail switches the user to a verified email address and its canonical form,
+	// activating users pending verification.
+	// It returns domain.ErrUserExists if the address is taken.
+	UpdateEmail(ctx context.Context, userID int64, email, canonical string) error
+	// SoftDeleteUser hides the user from every lookup until it is purged.
+	// It returns domain.ErrUserNotFound if no active user exists with the id.
+	SoftDeleteUser(ctx context.Context, userID int64) error
+	// RestoreUser brings back a soft-deleted user.
+	// It returns domain.ErrUserNotFound if the user is not soft-deleted.
+	RestoreUser(ctx context.Context, userID int64) error
+	// UpdateProfile changes the profile fields set in update.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	UpdateProfile(ctx context.Context, userID int64, update models.ProfileUpdate) (models.User, error)
+	// ActivateInvitedUser sets the password of an invited user and activates them.
+	// It returns domain.ErrUserNotFound if the user is not waiting on an invitation.
+	ActivateInvitedUser(ctx context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm) error
+	// DeleteInvitedUser removes a user whose invitation was never accepted.
+	// It returns domain.ErrUserNotFound if the user is not waiting on an invitation.
+	DeleteInvitedUser(ctx context.Context, userID int64) error
+	// PurgeDeletedUsers hard-deletes users soft-deleted before deletedBefore.
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 // UserProvider provides user.
 type UserProvider interface {
-	// FindByEmail retrieves a user by their email address.
+	// FindByEmail retrieves a user by their canonical email address.
 	// It returns domain.ErrUserNotFound if no user exists with the given email.
-	FindByEmail(ctx context.Context, email string) (models.User, error)
+	FindByEmail(ctx context.Context, canonical string) (models.User, error)
+	// FindByLogin retrieves a user by their canonical email or their username.
+	// It returns domain.ErrUserNotFound if no user matches the login.
+	FindByLogin(ctx context.Context, login string) (models.User, error)
+	// FindByID retrieves a user by their id.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	FindByID(ctx context.Context, userID int64) (models.User, error)
+	// FindByIDIncludingDeleted is FindByID that also finds soft-deleted users.
+	// It returns domain.ErrUserNotFound if no user exists with the id.
+	FindByIDIncludingDeleted(ctx context.Context, userID int64) (models.User, error)
+	// PreviousPasswords lists the last limit hashes the user's password was
+	// replaced from, newest first.
+	PreviousPasswords(ctx context.Context, userID int64, limit int) ([]models.PreviousPassword, error)
 	// IsAdmin retrieves is admin boolean by user id.
 	// It returns domain.ErrUserNotFound if no user exists with the id.
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
@@ -48,29 +190,180 @@ type AppProvider interface {
 
 type JwtAdapter interface {
 	RenewAccessToken(oldRefresh string, user models.User, app models.App) (string, error)
-	GenerateTokenPair(user models.User, app models.App) (access, refresh string, err error)
+	GenerateTokenPair(user models.User, app models.App, sessionID string) (access, refresh string, err error)
+	// GenerateScopedToken issues a token of type scope bound to no session.
+	GenerateScopedToken(scope string, user models.User, app models.App, ttl time.Duration) (string, error)
 	DecodeTokenWithVerification(tokenString, secretKey string) (map[string]any, error)
 }
 
+// PasswordHasher hashes new passwords with the native scheme and verifies
+// hashes of every scheme users may carry.
+type PasswordHasher interface {
+	Hash(password string) ([]byte, models.PasswordAlgorithm, error)
+	// Verify returns passhash.ErrMismatch if the password is wrong.
+	Verify(algo models.PasswordAlgorithm, hash []byte, password string) error
+	// NeedsRehash reports whether the hash uses another scheme or weaker
+	// parameters than Hash would.
+	NeedsRehash(algo models.PasswordAlgorithm, hash []byte) bool
+}
+
+// BreachChecker tells whether a password appears in a known breach corpus.
+type BreachChecker interface {
+	Breached(password string) bool
+}
+
+// SecretSealer encrypts secrets before they are stored. The additional
+// data is authenticated, binding a sealed value to its owner.
+type SecretSealer interface {
+	Seal(plaintext, additional []byte) ([]byte, error)
+	// Open returns sealer.ErrNoKey if no key is configured.
+	Open(sealed, additional []byte) ([]byte, error)
+}
+
+// TokenStorage persists single-use tokens by their hash.
+type TokenStorage interface {
+	SaveToken(ctx context.Context, token models.OneTimeToken) (int64, error)
+	// FindToken returns an unused, unexpired token without consuming it.
+	// It returns domain.ErrInvalidCode if there is no such token.
+	FindToken(ctx context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error)
+	// ConsumeToken marks the token as used and returns it.
+	// It returns domain.ErrInvalidCode if the token is unknown, expired or already used.
+	ConsumeToken(ctx context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error)
+	// RevokeTokens invalidates every unused token of the user issued for purpose.
+	RevokeTokens(ctx context.Context, userID int64, purpose models.TokenPurpose) error
+}
+
+// SessionStorage keeps track of the sessions token pairs are issued for.
+type SessionStorage interface {
+	SaveSession(ctx context.Context, session models.Session) error
+	// Session returns domain.ErrSessionNotFound if no session exists with the id.
+	Session(ctx context.Context, id string) (models.Session, error)
+	// RevokeSessions revokes all sessions of the user except exceptID.
+	RevokeSessions(ctx context.Context, userID int64, exceptID string) error
+	// UserSessions lists every session of the user, newest first.
+	UserSessions(ctx context.Context, userID int64) ([]models.Session, error)
+}
+
+// MembershipStorage tells which apps users are enrolled in.
+type MembershipStorage interface {
+	IsMember(ctx context.Context, userID int64, appID int) (bool, error)
+	// UserMemberships lists the apps the user is enrolled in, oldest first.
+	UserMemberships(ctx context.Context, userID int64) ([]models.Membership, error)
+}
+
+// LoginHistory keeps the outcome of every login and token refresh.
+type LoginHistory interface {
+	// SaveLoginEvent records the event; successful logins also become the
+	// user's last login time.
+	SaveLoginEvent(ctx context.Context, event models.LoginEvent) error
+	// LoginEvents lists the user's events older than beforeID, newest first.
+	LoginEvents(ctx context.Context, userID, beforeID int64, limit int) ([]models.LoginEvent, error)
+}
+
+// MFAStorage keeps users' second factors.
+type MFAStorage interface {
+	// SaveTOTP stores a pending enrollment, replacing any unconfirmed one.
+	// It returns domain.ErrMFAAlreadyEnabled if the user confirmed one already.
+	SaveTOTP(ctx context.Context, userID int64, secret []byte) error
+	// TOTP retrieves the user's enrollment, confirmed or not.
+	// It returns domain.ErrMFANotEnrolled if the user has none.
+	TOTP(ctx context.Context, userID int64) (models.TOTPCredential, error)
+	// ConfirmTOTP makes the pending enrollment a second factor.
+	// It returns domain.ErrMFANotEnrolled if no enrollment is pending.
+	ConfirmTOTP(ctx context.Context, userID, step int64) error
+	// UseTOTPStep records an accepted code of step and clears the count of
+	// wrong codes. It returns domain.ErrInvalidMFACode if step was already used.
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	// RecordTOTPFailure counts a wrong code and returns how many were sent
+	// since the last accepted one. Failures older than window no longer
+	// count: the first wrong code after them starts the count again.
+	RecordTOTPFailure(ctx context.Context, userID int64, window time.Duration) (int, error)
+}
+
+// PasskeyStorage keeps users' passkeys and the challenges of ceremonies
+// in progress.
+type PasskeyStorage interface {
+	// SavePasskey returns domain.ErrPasskeyExists if the credential id is taken.
+	SavePasskey(ctx context.Context, passkey models.Passkey) (int64, error)
+	// UserPasskeys lists the user's passkeys, oldest first.
+	UserPasskeys(ctx context.Context, userID int64) ([]models.Passkey, error)
+	// PasskeyByCredentialID returns domain.ErrPasskeyNotFound if no passkey has the id.
+	PasskeyByCredentialID(ctx context.Context, credentialID []byte) (models.Passkey, error)
+	// UpdatePasskeyUsage records a login with the passkey and its new counter.
+	// It returns domain.ErrInvalidPasskey if the counter did not grow meanwhile.
+	UpdatePasskeyUsage(ctx context.Context, id int64, signCount uint32, backedUp bool) error
+	SaveWebAuthnChallenge(ctx context.Context, challenge models.WebAuthnChallenge) error
+	// ConsumeWebAuthnChallenge deletes the challenge and returns it.
+	// It returns domain.ErrInvalidChallenge if it is unknown, expired or of
+	// another ceremony.
+	ConsumeWebAuthnChallenge(ctx context.Context, id string, ceremony models.WebAuthnCeremony) (models.WebAuthnChallenge, error)
+}
+
+// CodeIssuer mints and verifies signed single-use codes.
+type CodeIssuer interface {
+	Issue(purpose models.TokenPurpose) (code string, hash []byte, err error)
+	// Verify returns the hash of a well-signed code.
+	// It returns domain.ErrInvalidCode if the signature does not match.
+	Verify(purpose models.TokenPurpose, code string) ([]byte, error)
+}
+
+// Mailer delivers messages to users.
+type Mailer interface {
+	Send(ctx context.Context, msg models.Message) error
+}
+
 func New(
 	log *slog.Logger,
 	userSaver UserSaver,
 	userProvider UserProvider,
 	appProvider AppProvider,
 	jwtAdapter JwtAdapter,
-) *Auth {
+	hasher PasswordHasher,
+	breaches BreachChecker,
+	sealer SecretSealer,
+	tokenStorage TokenStorage,
+	sessions SessionStorage,
+	memberships MembershipStorage,
+	history LoginHistory,
+	mfa MFAStorage,
+	passkeys PasskeyStorage,
+	codeIssuer CodeIssuer,
+	mailer Mailer,
+	cfg Config,
+) (*Auth, error) {
+	const op = "auth.New"
 
-	return &Auth{
-		logger:      log,
-		usrSaver:    userSaver,
-		usrProvider: userProvider,
-		appProvider: appProvider,
-		jwtAdapter:  jwtAdapter,
+	dummyHash, dummyAlgo, err := hasher.Hash(uuid.NewString())
+	if err != nil {
+		return nil, fmt.Errorf("%s: dummy password hash: %w", op, err)
 	}
+	return &Auth{
+		logger:       log,
+		usrSaver:     userSaver,
+		usrProvider:  userProvider,
+		appProvider:  appProvider,
+		jwtAdapter:   jwtAdapter,
+		hasher:       hasher,
+		breaches:     breaches,
+		sealer:       sealer,
+		tokenStorage: tokenStorage,
+		sessions:     sessions,
+		memberships:  memberships,
+		history:      history,
+		mfa:          mfa,
+		passkeys:     passkeys,
+		codeIssuer:   codeIssuer,
+		mailer:       mailer,
+		cfg:          cfg,
+		dummyHash:    dummyHash,
+		dummyAlgo:    dummyAlgo,
+	}, nil
 }
 
-func (a *Auth) RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (string, error) {
+func (a *Auth) RefreshToken(ctx context.Context, req models.RefreshTokenRequest) (token string, err error) {
 	const op = "auth.RefreshToken"
+	var userID int64
+	defer func() { a.recordLogin(ctx, models.LoginEventRefresh, userID, req.AppID, req.Client, loginOutcome(err)) }()
 	log := a.logger.With(
 		slog.String("op", op),
 	)
@@ -84,7 +377,10 @@ func (a *Auth) RefreshToken(ctx context.Context, req models.RefreshTokenRequest)
 		a.logger.Error("failed to decode token", sl.Err(err))
 		return "", fmt.Errorf("%s: %w", op, domain.ErrInvalidToken)
 	}
-	user, err := a.usrProvider.FindByEmail(ctx, claims["email"].(string))
+	// The email claim goes stale once the user changes their address,
+	// so the user is resolved by the stable id instead.
+	uid, _ := claims["uid"].(float64)
+	user, err := a.usrProvider.FindByID(ctx, int64(uid))
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
 			a.logger.Warn("user not found", sl.Err(err))
@@ -93,6 +389,20 @@ func (a *Auth) RefreshToken(ctx context.Context, req models.RefreshTokenRequest)
 		a.logger.Error("failed to get user", sl.Err(err))
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
+	userID = user.ID
+	if err := checkStatus(user, app); err != nil {
+		log.Warn("user may not refresh", slog.Int64("user_id", user.ID), sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.checkMembership(ctx, user.ID, app.ID); err != nil {
+		log.Warn("user may not refresh", slog.Int64("user_id", user.ID), sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	sid, _ := claims["sid"].(string)
+	if err := a.checkSession(ctx, sid, user.ID); err != nil {
+		log.Warn("session is not active", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
 
 	newToken, err := a.jwtAdapter.RenewAccessToken(req.RefreshToken, user, app)
 	if err != nil {
@@ -102,35 +412,221 @@ func (a *Auth) RefreshToken(ctx context.Context, req models.RefreshTokenRequest)
 	return newToken, nil
 }
 
-func (a *Auth) Login(ctx context.Context, req models.LoginRequest) (string, string, error) {
+// Login checks the user's password and opens a session in the app. Users
+// whose password expired get a password change token instead.
+func (a *Auth) Login(ctx context.Context, req models.LoginRequest) (result models.LoginResult, err error) {
 	const op = "auth.Login"
+	var userID int64
+	defer func() {
+		outcome := loginOutcome(err)
+		if err == nil && result.MFAToken != "" {
+			outcome = models.OutcomeMFARequired
+		}
+		if err == nil && result.PasswordChangeToken != "" {
+			outcome = models.OutcomePasswordExpired
+		}
+		a.recordLogin(ctx, models.LoginEventLogin, userID, req.AppID, req.Client, outcome)
+	}()
 	log := a.logger.With(
 		slog.String("op", op),
 	)
 	log.Info("attempting to login user")
-	user, err := a.usrProvider.FindByEmail(ctx, req.Email)
+	user, err := a.findByLogin(ctx, req.Login)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
 			a.logger.Warn("user not found", sl.Err(err))
-			return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			a.verifyDummyPassword(req.PassHash)
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 		a.logger.Error("failed to get user", sl.Err(err))
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
 	}
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(req.PassHash)); err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	userID = user.ID
+	if err := a.verifyPassword(user, req.PassHash); err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if a.hasher.NeedsRehash(user.PassAlgo, user.PassHash) {
+		a.upgradePassword(ctx, user, req.PassHash)
 	}
 	app, err := a.appProvider.App(ctx, req.AppID)
 	if err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := checkStatus(user, app); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.checkMembership(ctx, user.ID, app.ID); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	enrolled, err := a.mfaEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get second factor", sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if enrolled {
+		token, err := a.issueMFAToken(ctx, user.ID, app.ID, "")
+		if err != nil {
+			log.Error("failed to issue mfa token", sl.Err(err))
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		log.Info("second factor required", slog.Int64("user_id", user.ID))
+		return models.LoginResult{MFAToken: token}, nil
+	}
+	result, err = a.completeLogin(ctx, user, app)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
 	}
 	log.Info("user logged successfully")
-	token, refToken, err := a.jwtAdapter.GenerateTokenPair(user, app)
+	return result, nil
+}
+
+// completeLogin issues the token pair to a user who proved who they are,
+// or a password change token if their password expired.
+func (a *Auth) completeLogin(ctx context.Context, user models.User, app models.App) (models.LoginResult, error) {
+	if a.passwordExpired(user, time.Now().UTC()) {
+		token, err := a.jwtAdapter.GenerateScopedToken(tokenTypePasswordChange, user, app, a.cfg.PasswordChangeTokenTTL)
+		if err != nil {
+			a.logger.Error("failed to issue password change token", sl.Err(err))
+			return models.LoginResult{}, err
+		}
+		a.logger.Info("password expired, change required", slog.Int64("user_id", user.ID))
+		return models.LoginResult{PasswordChangeToken: token}, nil
+	}
+	var result models.LoginResult
+	var err error
+	result.AccessToken, result.RefreshToken, err = a.startSession(ctx, user, app)
 	if err != nil {
-		a.logger.Error("failed to generate token", sl.Err(err))
-		return "", "", fmt.Errorf("%s: %w", op, err)
+		a.logger.Error("failed to start session", sl.Err(err))
+		return models.LoginResult{}, err
+	}
+	return result, nil
+}
+
+// passwordExpired reports whether the user's password is older than the
+// maximum age of their role.
+func (a *Auth) passwordExpired(user models.User, now time.Time) bool {
+	maxAge := a.cfg.PasswordMaxAge.User
+	if user.IsAdmin {
+		maxAge = a.cfg.PasswordMaxAge.Admin
+	}
+	return maxAge > 0 && now.Sub(user.PasswordChangedAt) > maxAge
+}
+
+// startSession opens a new session of user in app and issues its token pair.
+func (a *Auth) startSession(ctx context.Context, user models.User, app models.App) (string, string, error) {
+	session := models.Session{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		AppID:     app.ID,
+		ExpiresAt: time.Now().UTC().Add(a.cfg.SessionTTL),
+	}
+	if err := a.sessions.SaveSession(ctx, session); err != nil {
+		return "", "", err
 	}
-	return token, refToken, nil
+	return a.jwtAdapter.GenerateTokenPair(user, app, session.ID)
+}
+
+// principal is the caller of an authenticated use case.
+type principal struct {
+	user      models.User
+	app       models.App
+	sessionID string
+}
+
+// authenticate resolves the user behind an access token issued for appID.
+// It returns domain.ErrInvalidToken if the token is forged, expired or
+// belongs to a revoked session, domain.ErrWrongType for refresh tokens,
+// and the error of checkStatus if the account may not be used.
+func (a *Auth) authenticate(ctx context.Context, appID int32, accessToken string) (principal, error) {
+	return a.authenticateScoped(ctx, appID, accessToken, "")
+}
+
+// authenticateScoped is authenticate also accepting a token of type scope.
+// Scoped tokens are bound to no session, so the principal has none.
+func (a *Auth) authenticateScoped(ctx context.Context, appID int32, accessToken, scope string) (principal, error) {
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		return principal{}, err
+	}
+	claims, err := a.jwtAdapter.DecodeTokenWithVerification(accessToken, app.Secret)
+	if err != nil {
+		a.logger.Warn("failed to decode token", sl.Err(err))
+		return principal{}, domain.ErrInvalidToken
+	}
+	tokenType, _ := claims["type"].(string)
+	if tokenType != "access" && (scope == "" || tokenType != scope) {
+		return principal{}, domain.ErrWrongType
+	}
+	uid, _ := claims["uid"].(float64)
+	user, err := a.usrProvider.FindByID(ctx, int64(uid))
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return principal{}, domain.ErrInvalidToken
+		}
+		return principal{}, err
+	}
+	if err := checkStatus(user, app); err != nil {
+		return principal{}, err
+	}
+	if tokenType != "access" {
+		return principal{user: user, app: app}, nil
+	}
+	sid, _ := claims["sid"].(string)
+	if err := a.checkSession(ctx, sid, user.ID); err != nil {
+		return principal{}, err
+	}
+	return principal{user: user, app: app, sessionID: sid}, nil
+}
+
+// authenticateAdmin is authenticate for use cases reserved to admins.
+// It returns domain.ErrPermissionDenied if the caller is not an admin.
+func (a *Auth) authenticateAdmin(ctx context.Context, appID int32, accessToken string) (principal, error) {
+	p, err := a.authenticate(ctx, appID, accessToken)
+	if err != nil {
+		return principal{}, err
+	}
+	isAdmin, err := a.usrProvider.IsAdmin(ctx, p.user.ID)
+	if err != nil {
+		return principal{}, err
+	}
+	if !isAdmin {
+		a.logger.Warn("admin access denied", slog.Int64("user_id", p.user.ID))
+		return principal{}, domain.ErrPermissionDenied
+	}
+	return p, nil
+}
+
+// checkMembership returns domain.ErrNotMember unless the user is enrolled in the app.
+func (a *Auth) checkMembership(ctx context.Context, userID int64, appID int) error {
+	isMember, err := a.memberships.IsMember(ctx, userID, appID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return domain.ErrNotMember
+	}
+	return nil
+}
+
+// checkSession makes sure the session a token was issued for is still active
+// and belongs to userID. Tokens without a session are rejected.
+func (a *Auth) checkSession(ctx context.Context, sessionID string, userID int64) error {
+	if sessionID == "" {
+		return domain.ErrInvalidToken
+	}
+	session, err := a.sessions.Session(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return domain.ErrInvalidToken
+		}
+		return err
+	}
+	if session.UserID != userID || !session.Active(time.Now().UTC()) {
+		return domain.ErrInvalidToken
+	}
+	return nil
 }
 
 func (a *Auth) RegisterNewUser(ctx context.Context, req models.RegisterRequest) (int64, error) {
@@ -139,30 +635,105 @@ func (a *Auth) RegisterNewUser(ctx context.Context, req models.RegisterRequest)
 		slog.String("op", op),
 	)
 	log.Info("registering user")
-	if err := validation.ValidateEmail(req.Email); err != nil {
-		return 0, fmt.Errorf("%s: %w", op, domain.ErrWrongEmailFormat)
+	email, canonical, err := a.normalizeEmail(req.Email)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	if err := validation.ValidatePassword(req.Password); err != nil {
-		return 0, fmt.Errorf("%s: %w", op, domain.ErrWrongPasswordFormat)
+	breached, err := a.checkPassword(req.Password, email)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	_, err := a.usrProvider.FindByEmail(ctx, req.Email)
-	if !errors.Is(err, domain.ErrUserNotFound) {
-		return 0, fmt.Errorf("%s: %w", op, domain.ErrUserExists)
+	username := validation.NormalizeUsername(req.Username)
+	if username != "" {
+		if err := validation.ValidateUsername(username); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
 	}
-	passHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Users always register through an app, whose policy decides whether
+	// they may and which enrolls them.
+	app, err := a.appProvider.App(ctx, req.AppID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := checkRegistration(app, email); err != nil {
+		log.Warn("registration refused", slog.Int("app_id", app.ID), sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	// The password is hashed before the lookup so that taken addresses
+	// answer as slowly as free ones.
+	passHash, algo, err := a.hasher.Hash(req.Password)
 	if err != nil {
 		log.Error("failed to generate password hash", sl.Err(err))
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	id, err := a.usrSaver.SaveUser(ctx, req.Email, passHash)
+	existing, err := a.findByEmail(ctx, email)
+	if err == nil {
+		return 0, a.emailConflict(ctx, op, existing, signUpConflictNotice)
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		log.Error("failed to get user", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	id, err := a.usrSaver.SaveUser(ctx, models.User{
+		Email:            email,
+		EmailCanonical:   canonical,
+		Username:         username,
+		PassHash:         passHash,
+		PassAlgo:         algo,
+		Status:           models.StatusPendingVerification,
+		PasswordBreached: breached,
+	}, app.ID)
+	if errors.Is(err, domain.ErrUserExists) {
+		// Lost a race with another registration of the same address.
+		existing, err := a.findByEmail(ctx, email)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, domain.ErrUserExists)
+		}
+		return 0, a.emailConflict(ctx, op, existing, signUpConflictNotice)
+	}
 	if err != nil {
 		log.Error("failed to save user", sl.Err(err))
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 	log.Info("user registered")
+	if err := a.sendVerification(ctx, models.User{ID: id, Email: email}); err != nil {
+		// The account exists at this point; the user can ask for a new code.
+		log.Error("failed to send verification", sl.Err(err))
+	}
+	if a.cfg.ConcealRegistrationConflicts {
+		return 0, nil
+	}
 	return id, nil
 }
 
+// signUpConflictNotice tells the owner of an address that someone tried to
+// register it again.
+var signUpConflictNotice = models.Message{
+	Subject: "Someone tried to sign up with your email",
+	Body: "Someone tried to create an account with this email address, which already has one. " +
+		"No new account was created.\n\nIf it was you, log in or reset your password instead. " +
+		"If it was not you, you can ignore this email.",
+}
+
+// emailConflict answers a request for an address that already belongs to
+// existing. It returns domain.ErrUserExists unless conflicts are concealed,
+// in which case the owner is sent notice and the caller sees success.
+func (a *Auth) emailConflict(ctx context.Context, op string, existing models.User, notice models.Message) error {
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", existing.ID),
+	)
+	if !a.cfg.ConcealRegistrationConflicts {
+		return fmt.Errorf("%s: %w", op, domain.ErrUserExists)
+	}
+	log.Warn("use of a taken email concealed")
+	notice.To = existing.Email
+	if err := a.mailer.Send(ctx, notice); err != nil {
+		log.Error("failed to notify the owner", sl.Err(err))
+	}
+	return nil
+}
+
 func (a *Auth) IsAdmin(ctx context.Context, req models.IsAdminRequest) (bool, error) {
 	const op = "Auth.IsAdmin"
 
@@ -182,3 +753,40 @@ func (a *Auth) IsAdmin(ctx context.Context, req models.IsAdminRequest) (bool, er
 
 	return isAdmin, nil
 }
+
+// verifyPassword checks password against the user's stored hash, whatever
+// scheme it was made with. It returns ErrInvalidCredentials on mismatch.
+func (a *Auth) verifyPassword(user models.User, password string) error {
+	err := a.hasher.Verify(user.PassAlgo, user.PassHash, password)
+	if errors.Is(err, passhash.ErrMismatch) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// verifyDummyPassword runs a password check that always fails, costing as
+// much as checking a real user's password with the current scheme.
+func (a *Auth) verifyDummyPassword(password string) {
+	_ = a.hasher.Verify(a.dummyAlgo, a.dummyHash, password)
+}
+
+// upgradePassword replaces a legacy or weaker hash with a native one once
+// the password is known. Failures are logged and retried on the next login.
+func (a *Auth) upgradePassword(ctx context.Context, user models.User, password string) {
+	const op = "auth.upgradePassword"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+		slog.String("from", string(user.PassAlgo)),
+	)
+	passHash, algo, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to hash password", sl.Err(err))
+		return
+	}
+	if err := a.usrSaver.RehashPassword(ctx, user.ID, passHash, algo); err != nil {
+		log.Error("failed to store upgraded hash", sl.Err(err))
+		return
+	}
+	log.Info("password hash upgraded")
+}
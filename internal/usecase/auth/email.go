@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// emailChangeConflictNotice tells the owner of an address that another
+// account tried to move to it.
+var emailChangeConflictNotice = models.Message{
+	Subject: "Someone tried to use your email",
+	Body: "Someone tried to move another account to this email address, which already has one. " +
+		"Nothing was changed.\n\nIf it was not you, you can ignore this email.",
+}
+
+// ChangeEmail starts moving the authenticated user to a new address.
+// The user keeps logging in with the old address until the code sent to
+// the new one is confirmed. The old address receives a link that cancels
+// the change, or reverts it if it was already confirmed. When registration
+// conflicts are concealed, a taken address is answered like a free one and
+// its owner is told about the attempt instead.
+func (a *Auth) ChangeEmail(ctx context.Context, req models.ChangeEmailRequest) error {
+	const op = "auth.ChangeEmail"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("changing email")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.verifyPassword(p.user, req.Password); err != nil {
+		log.Warn("wrong password", slog.Int64("user_id", p.user.ID))
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	newEmail, _, err := a.normalizeEmail(req.NewEmail)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	existing, err := a.findByEmail(ctx, newEmail)
+	if err == nil {
+		return a.emailConflict(ctx, op, existing, emailChangeConflictNotice)
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Only the latest request can be confirmed.
+	if err := a.tokenStorage.RevokeTokens(ctx, p.user.ID, models.PurposeEmailChange); err != nil {
+		log.Error("failed to revoke pending email changes", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	code, err := a.issueCodeWithPayload(ctx, p.user.ID, models.PurposeEmailChange, newEmail, a.cfg.EmailChangeTTL)
+	if err != nil {
+		log.Error("failed to issue email change code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	undo, err := a.issueCodeWithPayload(ctx, p.user.ID, models.PurposeEmailChangeUndo, p.user.Email, a.cfg.EmailChangeUndoTTL)
+	if err != nil {
+		log.Error("failed to issue email change undo code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, models.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body:    "To start using this address for your account, use this code:\n\n" + a.link("/confirm-email-change", code),
+	})
+	if err != nil {
+		log.Error("failed to send email change code", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      p.user.Email,
+		Subject: "Your email is being changed",
+		Body: "Someone asked to move your account to " + newEmail + ".\n\n" +
+			"If this wasn't you, use this link to keep your current address:\n\n" + a.link("/undo-email-change", undo),
+	})
+	if err != nil {
+		log.Error("failed to send email change undo link", sl.Err(err))
+	}
+	log.Info("email change requested", slog.Int64("user_id", p.user.ID))
+	return nil
+}
+
+// ConfirmEmailChange redeems the code sent to the new address and switches
+// the user over to it.
+func (a *Auth) ConfirmEmailChange(ctx context.Context, req models.ConfirmEmailChangeRequest) error {
+	const op = "auth.ConfirmEmailChange"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("confirming email change")
+	token, err := a.consumeCode(ctx, models.PurposeEmailChange, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	canonical := validation.CanonicalEmail(token.Payload, a.cfg.EmailPolicy)
+	if err := a.usrSaver.UpdateEmail(ctx, token.UserID, token.Payload, canonical); err != nil {
+		log.Error("failed to update email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("email changed", slog.Int64("user_id", token.UserID))
+	return nil
+}
+
+// UndoEmailChange redeems the link sent to the old address. It cancels a
+// pending change, restores the old address if the change already went
+// through, and revokes every session of the user.
+func (a *Auth) UndoEmailChange(ctx context.Context, req models.UndoEmailChangeRequest) error {
+	const op = "auth.UndoEmailChange"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("undoing email change")
+	token, err := a.consumeCode(ctx, models.PurposeEmailChangeUndo, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.tokenStorage.RevokeTokens(ctx, token.UserID, models.PurposeEmailChange); err != nil {
+		log.Error("failed to revoke pending email changes", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrProvider.FindByID(ctx, token.UserID)
+	if err != nil {
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Email != token.Payload {
+		canonical := validation.CanonicalEmail(token.Payload, a.cfg.EmailPolicy)
+		if err := a.usrSaver.UpdateEmail(ctx, user.ID, token.Payload, canonical); err != nil {
+			log.Error("failed to restore email", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := a.sessions.RevokeSessions(ctx, user.ID, ""); err != nil {
+		log.Error("failed to revoke sessions", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("email change undone", slog.Int64("user_id", user.ID))
+	return nil
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/onetime"
+)
+
+// emailStore keeps in memory what the email change use cases read and
+// write. The embedded interfaces are left nil: calling their other
+// methods panics.
+type emailStore struct {
+	UserSaver
+	UserProvider
+	SessionStorage
+	TokenStorage
+
+	mu       sync.Mutex
+	users    map[int64]models.User
+	app      models.App
+	tokens   []models.OneTimeToken
+	used     map[int64]bool
+	sessions map[string]models.Session
+	messages []models.Message
+}
+
+func (s *emailStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *emailStore) FindByEmail(_ context.Context, canonical string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.EmailCanonical == canonical {
+			return u, nil
+		}
+	}
+	return models.User{}, domain.ErrUserNotFound
+}
+
+func (s *emailStore) UpdateEmail(_ context.Context, userID int64, email, canonical string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	user.Email, user.EmailCanonical, user.EmailVerified = email, canonical, true
+	if user.Status == models.StatusPendingVerification {
+		user.Status = models.StatusActive
+	}
+	s.users[userID] = user
+	return nil
+}
+
+func (s *emailStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *emailStore) SaveToken(_ context.Context, token models.OneTimeToken) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = int64(len(s.tokens) + 1)
+	s.tokens = append(s.tokens, token)
+	return token.ID, nil
+}
+
+func (s *emailStore) ConsumeToken(_ context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.Purpose == purpose && bytes.Equal(t.Hash, hash) && !s.used[t.ID] && time.Now().Before(t.ExpiresAt) {
+			s.used[t.ID] = true
+			return t, nil
+		}
+	}
+	return models.OneTimeToken{}, domain.ErrInvalidCode
+}
+
+func (s *emailStore) RevokeTokens(_ context.Context, userID int64, purpose models.TokenPurpose) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			s.used[t.ID] = true
+		}
+	}
+	return nil
+}
+
+func (s *emailStore) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *emailStore) Session(_ context.Context, id string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *emailStore) RevokeSessions(_ context.Context, userID int64, exceptID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (s *emailStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// lastCode returns the code of the last message sent to address. Without a
+// public URL, the code is the last line of the message.
+func (s *emailStore) lastCode(t *testing.T, to string) string {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, msg := range slices.Backward(s.messages) {
+		if msg.To == to {
+			return msg.Body[strings.LastIndex(msg.Body, "\n")+1:]
+		}
+	}
+	t.Fatalf("no message sent to %s", to)
+	return ""
+}
+
+// newEmailAuth returns an Auth over a store holding bob, signed in with
+// the returned access token, and the owner of taken@example.com.
+func newEmailAuth(t *testing.T) (*Auth, *emailStore, string) {
+	t.Helper()
+	passHash := testHash(t, oldPassword)
+	store := &emailStore{
+		users: map[int64]models.User{
+			42: {ID: 42, Email: "bob@example.com", EmailCanonical: "bob@example.com", PassHash: passHash, PassAlgo: models.AlgoArgon2id, Status: models.StatusActive},
+			43: {ID: 43, Email: "taken@example.com", EmailCanonical: "taken@example.com", PassHash: passHash, PassAlgo: models.AlgoArgon2id, Status: models.StatusActive},
+		},
+		app:      models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		used:     map[int64]bool{},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:       slog.New(slog.DiscardHandler),
+		hasher:       testHasher,
+		usrSaver:     store,
+		usrProvider:  store,
+		appProvider:  store,
+		jwtAdapter:   jwt.New(time.Hour, 24*time.Hour),
+		tokenStorage: store,
+		sessions:     store,
+		codeIssuer:   onetime.New("code-secret"),
+		mailer:       store,
+		cfg:          Config{SessionTTL: 24 * time.Hour, EmailChangeTTL: time.Hour, EmailChangeUndoTTL: time.Hour},
+	}
+	access, _, err := a.startSession(context.Background(), store.users[42], store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, store, access
+}
+
+// changeEmail asks to move bob to newEmail and returns the confirmation
+// code sent to the new address and the undo code sent to the old one.
+func changeEmail(t *testing.T, a *Auth, store *emailStore, access, newEmail string) (confirm, undo string) {
+	t.Helper()
+	err := a.ChangeEmail(context.Background(), models.ChangeEmailRequest{
+		AppID: 1, AccessToken: access, NewEmail: newEmail, Password: oldPassword,
+	})
+	if err != nil {
+		t.Fatalf("ChangeEmail() error = %v", err)
+	}
+	return store.lastCode(t, newEmail), store.lastCode(t, "bob@example.com")
+}
+
+func TestChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	a, store, access := newEmailAuth(t)
+
+	tests := []struct {
+		name string
+		req  models.ChangeEmailRequest
+		want error
+	}{
+		{"wrong password", models.ChangeEmailRequest{NewEmail: "new@example.com", Password: "wrong"}, ErrInvalidCredentials},
+		{"taken address", models.ChangeEmailRequest{NewEmail: "Taken@Example.com", Password: oldPassword}, domain.ErrUserExists},
+		{"malformed address", models.ChangeEmailRequest{NewEmail: "not an email", Password: oldPassword}, domain.ErrWrongEmailFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.AppID, tt.req.AccessToken = 1, access
+			if err := a.ChangeEmail(ctx, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("ChangeEmail() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	stale, _ := changeEmail(t, a, store, access, "old-request@example.com")
+	confirm, _ := changeEmail(t, a, store, access, "new@example.com")
+	// The address only changes once confirmed.
+	if got := store.users[42].Email; got != "bob@example.com" {
+		t.Fatalf("email before confirmation = %q", got)
+	}
+	// Only the latest request can be confirmed.
+	if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: stale}); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("ConfirmEmailChange() of a superseded request error = %v, want ErrInvalidCode", err)
+	}
+	if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: confirm}); err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+	if got := store.users[42]; got.Email != "new@example.com" || got.EmailCanonical != "new@example.com" {
+		t.Errorf("email after confirmation = %q (%q)", got.Email, got.EmailCanonical)
+	}
+	if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: confirm}); !errors.Is(err, domain.ErrInvalidCode) {
+		t.Errorf("second ConfirmEmailChange() error = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestChangeEmailConcealsConflicts(t *testing.T) {
+	a, store, access := newEmailAuth(t)
+	a.cfg.ConcealRegistrationConflicts = true
+
+	err := a.ChangeEmail(context.Background(), models.ChangeEmailRequest{
+		AppID: 1, AccessToken: access, NewEmail: "Taken@Example.com", Password: oldPassword,
+	})
+	if err != nil {
+		t.Fatalf("ChangeEmail() to a taken address error = %v, want it concealed", err)
+	}
+	// Only the owner of the address hears about it; no code is issued.
+	if len(store.messages) != 1 || store.messages[0].To != "taken@example.com" || store.messages[0].Subject != emailChangeConflictNotice.Subject {
+		t.Errorf("messages = %+v, want only the conflict notice to the owner", store.messages)
+	}
+	if len(store.tokens) != 0 {
+		t.Errorf("%d codes issued, want none", len(store.tokens))
+	}
+	if got := store.users[42].Email; got != "bob@example.com" {
+		t.Errorf("email = %q, want it unchanged", got)
+	}
+}
+
+func TestConfirmEmailChangeActivatesPendingUser(t *testing.T) {
+	ctx := context.Background()
+	a, store, access := newEmailAuth(t)
+	// Apps that allow unverified logins let pending users change their email.
+	store.app.AllowUnverifiedLogin = true
+	bob := store.users[42]
+	bob.Status, bob.EmailVerified = models.StatusPendingVerification, false
+	store.users[42] = bob
+
+	confirm, _ := changeEmail(t, a, store, access, "new@example.com")
+	if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: confirm}); err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+	// Confirming the new address verifies it, so the account is no longer
+	// pending and logs in to every app.
+	got := store.users[42]
+	if !got.EmailVerified || got.Status != models.StatusActive {
+		t.Errorf("user after confirmation = %+v, want verified and active", got)
+	}
+	if err := checkStatus(got, models.App{}); err != nil {
+		t.Errorf("checkStatus() after confirmation = %v", err)
+	}
+}
+
+func TestUndoEmailChange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("after confirmation", func(t *testing.T) {
+		a, store, access := newEmailAuth(t)
+		confirm, undo := changeEmail(t, a, store, access, "new@example.com")
+		if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: confirm}); err != nil {
+			t.Fatalf("ConfirmEmailChange() error = %v", err)
+		}
+
+		if err := a.UndoEmailChange(ctx, models.UndoEmailChangeRequest{Code: undo}); err != nil {
+			t.Fatalf("UndoEmailChange() error = %v", err)
+		}
+		if got := store.users[42].Email; got != "bob@example.com" {
+			t.Errorf("email after undo = %q, want the old one", got)
+		}
+		// Whoever changed the address is signed out.
+		if _, err := a.authenticate(ctx, 1, access); !errors.Is(err, domain.ErrInvalidToken) {
+			t.Errorf("authenticate() after undo error = %v, want ErrInvalidToken", err)
+		}
+		if err := a.UndoEmailChange(ctx, models.UndoEmailChangeRequest{Code: undo}); !errors.Is(err, domain.ErrInvalidCode) {
+			t.Errorf("second UndoEmailChange() error = %v, want ErrInvalidCode", err)
+		}
+	})
+
+	t.Run("before confirmation", func(t *testing.T) {
+		a, store, access := newEmailAuth(t)
+		confirm, undo := changeEmail(t, a, store, access, "new@example.com")
+
+		if err := a.UndoEmailChange(ctx, models.UndoEmailChangeRequest{Code: undo}); err != nil {
+			t.Fatalf("UndoEmailChange() error = %v", err)
+		}
+		// The pending change is cancelled.
+		if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: confirm}); !errors.Is(err, domain.ErrInvalidCode) {
+			t.Errorf("ConfirmEmailChange() after undo error = %v, want ErrInvalidCode", err)
+		}
+		if got := store.users[42].Email; got != "bob@example.com" {
+			t.Errorf("email = %q, want the old one", got)
+		}
+	})
+
+	t.Run("codes are not interchangeable", func(t *testing.T) {
+		a, store, access := newEmailAuth(t)
+		confirm, undo := changeEmail(t, a, store, access, "new@example.com")
+
+		if err := a.UndoEmailChange(ctx, models.UndoEmailChangeRequest{Code: confirm}); !errors.Is(err, domain.ErrInvalidCode) {
+			t.Errorf("UndoEmailChange() with the confirmation code error = %v, want ErrInvalidCode", err)
+		}
+		if err := a.ConfirmEmailChange(ctx, models.ConfirmEmailChangeRequest{Code: undo}); !errors.Is(err, domain.ErrInvalidCode) {
+			t.Errorf("ConfirmEmailChange() with the undo code error = %v, want ErrInvalidCode", err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+func TestPasswordExpired(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &Auth{cfg: Config{PasswordMaxAge: PasswordMaxAge{Admin: 90 * 24 * time.Hour}}}
+	tests := []struct {
+		name      string
+		isAdmin   bool
+		changedAt time.Time
+		want      bool
+	}{
+		{name: "fresh admin password", isAdmin: true, changedAt: now.AddDate(0, 0, -89), want: false},
+		{name: "expired admin password", isAdmin: true, changedAt: now.AddDate(0, 0, -91), want: true},
+		{name: "user passwords never expire", isAdmin: false, changedAt: now.AddDate(-5, 0, 0), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := models.User{IsAdmin: tt.isAdmin, PasswordChangedAt: tt.changedAt}
+			if got := a.passwordExpired(user, now); got != tt.want {
+				t.Errorf("passwordExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// ExportUserData collects the personal data held about the authenticated user.
+// The service keeps no record of consents, so the export has none; consents
+// collected by the apps have to be exported by them.
+func (a *Auth) ExportUserData(ctx context.Context, req models.ExportUserDataRequest) (models.DataExport, error) {
+	const op = "auth.ExportUserData"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("exporting user data")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.DataExport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	export, err := a.exportUser(ctx, p.user)
+	if err != nil {
+		log.Error("failed to export user data", sl.Err(err))
+		return models.DataExport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user data exported", slog.Int64("user_id", p.user.ID))
+	return export, nil
+}
+
+// AdminExportUserData is ExportUserData on behalf of another user, for admins
+// handling an access request. Users whose deletion is still in its grace
+// period can be exported too.
+func (a *Auth) AdminExportUserData(ctx context.Context, req models.AdminExportUserDataRequest) (models.DataExport, error) {
+	const op = "auth.AdminExportUserData"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", req.UserID),
+	)
+	log.Info("exporting user data")
+	p, err := a.authenticateAdmin(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.DataExport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrProvider.FindByIDIncludingDeleted(ctx, req.UserID)
+	if err != nil {
+		return models.DataExport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	export, err := a.exportUser(ctx, user)
+	if err != nil {
+		log.Error("failed to export user data", sl.Err(err))
+		return models.DataExport{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user data exported", slog.Int64("admin_id", p.user.ID))
+	return export, nil
+}
+
+func (a *Auth) exportUser(ctx context.Context, user models.User) (models.DataExport, error) {
+	sessions, err := a.sessions.UserSessions(ctx, user.ID)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	memberships, err := a.memberships.UserMemberships(ctx, user.ID)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	// A zero limit lists the whole history.
+	events, err := a.history.LoginEvents(ctx, user.ID, 0, 0)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	passkeys, err := a.passkeys.UserPasskeys(ctx, user.ID)
+	if err != nil {
+		return models.DataExport{}, err
+	}
+	totp, err := a.mfa.TOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, domain.ErrMFANotEnrolled) {
+		return models.DataExport{}, err
+	}
+	export := models.DataExport{
+		GeneratedAt: time.Now().UTC(),
+		Profile: models.ExportedProfile{
+			ID:               user.ID,
+			Email:            user.Email,
+			Username:         user.Username,
+			EmailVerified:    user.EmailVerified,
+			Status:           string(user.Status),
+			IsAdmin:          user.IsAdmin,
+			DisplayName:      user.DisplayName,
+			Locale:           user.Locale,
+			AvatarURL:        user.AvatarURL,
+			CreatedAt:        user.CreatedAt,
+			UpdatedAt:        user.UpdatedAt,
+			LastLoginAt:      user.LastLoginAt,
+			PasswordBreached: user.PasswordBreached,
+			DeletedAt:        user.DeletedAt,
+		},
+		Sessions:     make([]models.ExportedSession, 0, len(sessions)),
+		Memberships:  make([]models.ExportedMembership, 0, len(memberships)),
+		LoginHistory: make([]models.ExportedLoginEvent, 0, len(events)),
+		Passkeys:     make([]models.ExportedPasskey, 0, len(passkeys)),
+	}
+	if err == nil {
+		export.TOTP = &models.ExportedTOTP{
+			CreatedAt:      totp.CreatedAt,
+			ConfirmedAt:    totp.ConfirmedAt,
+			FailedAttempts: totp.FailedAttempts,
+			LastFailureAt:  totp.LastFailureAt,
+		}
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, models.ExportedSession{
+			ID:        s.ID,
+			AppID:     s.AppID,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			RevokedAt: s.RevokedAt,
+		})
+	}
+	for _, m := range memberships {
+		export.Memberships = append(export.Memberships, models.ExportedMembership{
+			AppID:    m.AppID,
+			AppName:  m.AppName,
+			JoinedAt: m.CreatedAt,
+		})
+	}
+	for _, e := range events {
+		export.LoginHistory = append(export.LoginHistory, models.ExportedLoginEvent{
+			AppID:     e.AppID,
+			Kind:      string(e.Kind),
+			Outcome:   string(e.Outcome),
+			IP:        e.Client.IP,
+			UserAgent: e.Client.UserAgent,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	for _, p := range passkeys {
+		export.Passkeys = append(export.Passkeys, models.ExportedPasskey{
+			ID:         p.ID,
+			Transports: p.Transports,
+			BackedUp:   p.BackedUp,
+			CreatedAt:  p.CreatedAt,
+			LastUsedAt: p.LastUsedAt,
+		})
+	}
+	return export, nil
+}
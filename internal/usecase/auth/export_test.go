@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+)
+
+// exportStore keeps in memory what the export use cases read.
+// The embedded interfaces are left nil: calling their other methods panics.
+type exportStore struct {
+	UserProvider
+	SessionStorage
+	MembershipStorage
+	LoginHistory
+	MFAStorage
+	PasskeyStorage
+
+	users    map[int64]models.User
+	totp     map[int64]models.TOTPCredential
+	passkeys []models.Passkey
+	app      models.App
+	sessions map[string]models.Session
+}
+
+func (s *exportStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	user, ok := s.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *exportStore) FindByIDIncludingDeleted(_ context.Context, userID int64) (models.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *exportStore) IsAdmin(ctx context.Context, userID int64) (bool, error) {
+	user, err := s.FindByID(ctx, userID)
+	return user.IsAdmin, err
+}
+
+func (s *exportStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *exportStore) SaveSession(_ context.Context, session models.Session) error {
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *exportStore) Session(_ context.Context, id string) (models.Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *exportStore) UserSessions(_ context.Context, userID int64) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *exportStore) UserMemberships(_ context.Context, userID int64) ([]models.Membership, error) {
+	return []models.Membership{{UserID: userID, AppID: s.app.ID}}, nil
+}
+
+func (s *exportStore) LoginEvents(context.Context, int64, int64, int) ([]models.LoginEvent, error) {
+	return nil, nil
+}
+
+func (s *exportStore) TOTP(_ context.Context, userID int64) (models.TOTPCredential, error) {
+	cred, ok := s.totp[userID]
+	if !ok {
+		return models.TOTPCredential{}, domain.ErrMFANotEnrolled
+	}
+	return cred, nil
+}
+
+func (s *exportStore) UserPasskeys(_ context.Context, userID int64) ([]models.Passkey, error) {
+	var passkeys []models.Passkey
+	for _, p := range s.passkeys {
+		if p.UserID == userID {
+			passkeys = append(passkeys, p)
+		}
+	}
+	return passkeys, nil
+}
+
+func TestAdminExportUserData(t *testing.T) {
+	ctx := context.Background()
+	deletedAt := time.Now().UTC().Add(-time.Hour)
+	store := &exportStore{
+		users: map[int64]models.User{
+			1:  {ID: 1, Email: "root@example.com", Status: models.StatusActive, IsAdmin: true},
+			42: {ID: 42, Email: "bob@example.com", PassHash: []byte("hash"), Status: models.StatusActive},
+			43: {ID: 43, Email: "gone@example.com", PassHash: []byte("hash"), Status: models.StatusDeleted, DeletedAt: &deletedAt},
+		},
+		totp: map[int64]models.TOTPCredential{
+			42: {UserID: 42, Secret: []byte("sealed"), CreatedAt: deletedAt, ConfirmedAt: &deletedAt},
+		},
+		passkeys: []models.Passkey{{ID: 7, UserID: 42, PublicKey: []byte("cose key"), CreatedAt: deletedAt}},
+		app:      models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:      slog.New(slog.DiscardHandler),
+		usrProvider: store,
+		appProvider: store,
+		jwtAdapter:  jwt.New(time.Hour, 24*time.Hour),
+		sessions:    store,
+		memberships: store,
+		history:     store,
+		mfa:         store,
+		passkeys:    store,
+		cfg:         Config{SessionTTL: 24 * time.Hour},
+	}
+	root, _, err := a.startSession(ctx, store.users[1], store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _, err := a.startSession(ctx, store.users[42], store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		access       string
+		userID       int64
+		wantTOTP     bool
+		wantPasskeys int
+		want         error
+	}{
+		{name: "active user", access: root, userID: 42, wantTOTP: true, wantPasskeys: 1},
+		{name: "user in the deletion grace period", access: root, userID: 43},
+		{name: "unknown user", access: root, userID: 99, want: domain.ErrUserNotFound},
+		{name: "not an admin", access: bob, userID: 43, want: domain.ErrPermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, err := a.AdminExportUserData(ctx, models.AdminExportUserDataRequest{
+				AppID: 1, AccessToken: tt.access, UserID: tt.userID,
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AdminExportUserData() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && export.Profile.ID != tt.userID {
+				t.Errorf("exported profile = %+v, want user %d", export.Profile, tt.userID)
+			}
+			if got := export.TOTP != nil; got != tt.wantTOTP {
+				t.Errorf("exported totp = %+v, want one: %v", export.TOTP, tt.wantTOTP)
+			}
+			if len(export.Passkeys) != tt.wantPasskeys {
+				t.Errorf("exported passkeys = %+v, want %d", export.Passkeys, tt.wantPasskeys)
+			}
+		})
+	}
+}
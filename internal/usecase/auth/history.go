@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// recordLogin appends the outcome of a login or refresh to the login history.
+// The history is best effort: failing to record never fails the login.
+func (a *Auth) recordLogin(ctx context.Context, kind models.LoginEventKind, userID int64, appID int32, client models.ClientInfo, outcome models.LoginOutcome) {
+	event := models.LoginEvent{
+		UserID:  userID,
+		AppID:   appID,
+		Kind:    kind,
+		Outcome: outcome,
+		Client:  client,
+	}
+	if err := a.history.SaveLoginEvent(ctx, event); err != nil {
+		a.logger.Error("failed to record login event", slog.String("kind", string(kind)), sl.Err(err))
+	}
+}
+
+// loginOutcome names the reason a login or refresh failed with err.
+func loginOutcome(err error) models.LoginOutcome {
+	switch {
+	case err == nil:
+		return models.OutcomeSuccess
+	case errors.Is(err, ErrInvalidCredentials):
+		return models.OutcomeInvalidCredentials
+	case errors.Is(err, domain.ErrInvalidToken), errors.Is(err, domain.ErrTokenExpired), errors.Is(err, domain.ErrWrongType):
+		return models.OutcomeInvalidToken
+	case errors.Is(err, domain.ErrEmailNotVerified):
+		return models.OutcomeEmailNotVerified
+	case errors.Is(err, domain.ErrInvitationPending):
+		return models.OutcomeInvitationPending
+	case errors.Is(err, domain.ErrUserDisabled):
+		return models.OutcomeUserDisabled
+	case errors.Is(err, domain.ErrUserDeleted):
+		return models.OutcomeUserDeleted
+	case errors.Is(err, domain.ErrNotMember):
+		return models.OutcomeNotMember
+	case errors.Is(err, domain.ErrAppNotFound):
+		return models.OutcomeAppNotFound
+	case errors.Is(err, domain.ErrInvalidMFACode):
+		return models.OutcomeInvalidMFACode
+	case errors.Is(err, domain.ErrMFALocked):
+		return models.OutcomeMFALocked
+	case errors.Is(err, domain.ErrInvalidPasskey), errors.Is(err, domain.ErrInvalidChallenge):
+		return models.OutcomeInvalidPasskey
+	default:
+		return models.OutcomeError
+	}
+}
+
+// GetLoginHistory lists the login history of the caller, newest first.
+// Admins may list the history of any user.
+func (a *Auth) GetLoginHistory(ctx context.Context, req models.GetLoginHistoryRequest) (models.LoginHistoryPage, error) {
+	const op = "auth.GetLoginHistory"
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.LoginHistoryPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	userID := p.user.ID
+	if req.UserID != 0 && req.UserID != p.user.ID {
+		isAdmin, err := a.usrProvider.IsAdmin(ctx, p.user.ID)
+		if err != nil {
+			return models.LoginHistoryPage{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if !isAdmin {
+			a.logger.Warn("admin access denied", slog.String("op", op), slog.Int64("user_id", p.user.ID))
+			return models.LoginHistoryPage{}, fmt.Errorf("%s: %w", op, domain.ErrPermissionDenied)
+		}
+		userID = req.UserID
+	}
+	limit := req.PageSize
+	if limit <= 0 {
+		limit = defaultHistoryPageSize
+	}
+	limit = min(limit, maxHistoryPageSize)
+	// One extra event tells whether another page follows.
+	events, err := a.history.LoginEvents(ctx, userID, req.BeforeID, limit+1)
+	if err != nil {
+		a.logger.Error("failed to list login events", slog.String("op", op), sl.Err(err))
+		return models.LoginHistoryPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	var page models.LoginHistoryPage
+	if len(events) > limit {
+		events = events[:limit]
+		page.NextBeforeID = events[limit-1].ID
+	}
+	page.Events = events
+	return page, nil
+}
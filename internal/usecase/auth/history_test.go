@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+func TestLoginOutcome(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		err  error
+		want models.LoginOutcome
+	}{
+		{err: nil, want: models.OutcomeSuccess},
+		{err: ErrInvalidCredentials, want: models.OutcomeInvalidCredentials},
+		{err: domain.ErrTokenExpired, want: models.OutcomeInvalidToken},
+		{err: domain.ErrEmailNotVerified, want: models.OutcomeEmailNotVerified},
+		{err: domain.ErrUserDisabled, want: models.OutcomeUserDisabled},
+		{err: domain.ErrNotMember, want: models.OutcomeNotMember},
+		{err: domain.ErrAppNotFound, want: models.OutcomeAppNotFound},
+		{err: domain.ErrInvalidMFACode, want: models.OutcomeInvalidMFACode},
+		{err: domain.ErrInvalidPasskey, want: models.OutcomeInvalidPasskey},
+		{err: errors.New("connection refused"), want: models.OutcomeError},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			// Use cases wrap their errors with the op name.
+			err := tt.err
+			if err != nil {
+				err = fmt.Errorf("auth.Login: %w", err)
+			}
+			if got := loginOutcome(err); got != tt.want {
+				t.Errorf("loginOutcome(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+)
+
+// normalizeEmail returns the stored form of email and its identity key.
+// It returns domain.ErrWrongEmailFormat for malformed addresses.
+func (a *Auth) normalizeEmail(email string) (normalized, canonical string, err error) {
+	normalized, err = validation.NormalizeEmail(email)
+	if err != nil {
+		return "", "", err
+	}
+	if err := validation.ValidateEmail(normalized); err != nil {
+		return "", "", domain.ErrWrongEmailFormat
+	}
+	return normalized, validation.CanonicalEmail(normalized, a.cfg.EmailPolicy), nil
+}
+
+// findByEmail looks a user up by the identity key of email. Malformed
+// addresses are reported as domain.ErrUserNotFound.
+func (a *Auth) findByEmail(ctx context.Context, email string) (models.User, error) {
+	normalized, canonical, err := a.normalizeEmail(email)
+	if err != nil {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return lookupEmail(ctx, normalized, canonical, a.usrProvider.FindByEmail)
+}
+
+// findByLogin looks a user up by email or by username, with or without the "@".
+func (a *Auth) findByLogin(ctx context.Context, login string) (models.User, error) {
+	if !strings.Contains(login, "@") || strings.HasPrefix(login, "@") {
+		return a.usrProvider.FindByLogin(ctx, validation.NormalizeUsername(login))
+	}
+	normalized, canonical, err := a.normalizeEmail(login)
+	if err != nil {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return lookupEmail(ctx, normalized, canonical, a.usrProvider.FindByLogin)
+}
+
+// lookupEmail finds canonical and, when the email policy changed the
+// address, retries with the bare normalized address: accounts created
+// before the policy was enabled were keyed that way.
+func lookupEmail(ctx context.Context, normalized, canonical string, find func(context.Context, string) (models.User, error)) (models.User, error) {
+	user, err := find(ctx, canonical)
+	if errors.Is(err, domain.ErrUserNotFound) && canonical != normalized {
+		return find(ctx, normalized)
+	}
+	return user, err
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// InviteUser creates an invited account for req.Email and mails the invitee
+// a link to accept it. Inviting an address whose invitation is still pending
+// sends a fresh link and invalidates the previous one.
+func (a *Auth) InviteUser(ctx context.Context, req models.InviteUserRequest) (int64, error) {
+	const op = "auth.InviteUser"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("inviting user")
+	p, err := a.authenticateAdmin(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	email, canonical, err := a.normalizeEmail(req.Email)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := validation.ValidateDisplayName(req.DisplayName); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.findByEmail(ctx, email)
+	switch {
+	case err == nil && user.Status != models.StatusInvited:
+		return 0, fmt.Errorf("%s: %w", op, domain.ErrUserExists)
+	case err == nil:
+		if err := a.tokenStorage.RevokeTokens(ctx, user.ID, models.PurposeInvitation); err != nil {
+			log.Error("failed to revoke previous invitation", sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	case errors.Is(err, domain.ErrUserNotFound):
+		user, err = a.saveInvitedUser(ctx, email, canonical, req.DisplayName, p.app.ID)
+		if err != nil {
+			log.Error("failed to save invited user", sl.Err(err))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	default:
+		log.Error("failed to get user", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.sendInvitation(ctx, user); err != nil {
+		log.Error("failed to send invitation", sl.Err(err))
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user invited", slog.Int64("user_id", user.ID), slog.Int64("admin_id", p.user.ID))
+	return user.ID, nil
+}
+
+// saveInvitedUser stores an invited account enrolled in appID. Its password is
+// random and never disclosed, so nobody can log in before the invitation is accepted.
+func (a *Auth) saveInvitedUser(ctx context.Context, email, canonical, displayName string, appID int) (models.User, error) {
+	passHash, algo, err := a.hasher.Hash(rand.Text())
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{
+		Email:          email,
+		EmailCanonical: canonical,
+		PassHash:       passHash,
+		PassAlgo:       algo,
+		Status:         models.StatusInvited,
+	}
+	if user.ID, err = a.usrSaver.SaveUser(ctx, user, appID); err != nil {
+		return models.User{}, err
+	}
+	if displayName != "" {
+		if _, err := a.usrSaver.UpdateProfile(ctx, user.ID, models.ProfileUpdate{DisplayName: &displayName}); err != nil {
+			return models.User{}, err
+		}
+	}
+	return user, nil
+}
+
+func (a *Auth) sendInvitation(ctx context.Context, user models.User) error {
+	code, err := a.issueCode(ctx, user.ID, models.PurposeInvitation, a.cfg.InvitationTTL)
+	if err != nil {
+		return err
+	}
+	return a.mailer.Send(ctx, models.Message{
+		To:      user.Email,
+		Subject: "You have been invited",
+		Body: "You have been invited to create an account. To choose your password, use this code:\n\n" +
+			a.link("/accept-invitation", code),
+	})
+}
+
+// RevokeInvitation invalidates a pending invitation and removes the invited
+// account. Users who already accepted their invitation are left untouched.
+func (a *Auth) RevokeInvitation(ctx context.Context, req models.RevokeInvitationRequest) error {
+	const op = "auth.RevokeInvitation"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", req.UserID),
+	)
+	log.Info("revoking invitation")
+	p, err := a.authenticateAdmin(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// Deleting the user cascades to its invitation codes.
+	if err := a.usrSaver.DeleteInvitedUser(ctx, req.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("invitation revoked", slog.Int64("admin_id", p.user.ID))
+	return nil
+}
+
+// AcceptInvitation redeems an invitation code, sets the invitee's password
+// and activates the account. The invitee proved they own the address, so
+// their email counts as verified.
+func (a *Auth) AcceptInvitation(ctx context.Context, req models.AcceptInvitationRequest) error {
+	const op = "auth.AcceptInvitation"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("accepting invitation")
+	breached, err := a.checkNewPassword(ctx, models.PurposeInvitation, req.Code, req.Password)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	token, err := a.consumeCode(ctx, models.PurposeInvitation, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	passHash, algo, err := a.hasher.Hash(req.Password)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.usrSaver.ActivateInvitedUser(ctx, token.UserID, passHash, algo); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, domain.ErrInvalidCode)
+		}
+		log.Error("failed to activate user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if breached {
+		// The account is usable already; the flag is only advisory.
+		if err := a.usrSaver.SetPasswordBreached(ctx, token.UserID, true); err != nil {
+			log.Error("failed to flag breached password", sl.Err(err))
+		}
+	}
+	log.Info("invitation accepted", slog.Int64("user_id", token.UserID))
+	return nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+)
+
+// membershipStore keeps in memory what Login and RefreshToken read and record.
+// The embedded interfaces are left nil: calling their other methods panics.
+type membershipStore struct {
+	UserProvider
+	SessionStorage
+	MembershipStorage
+	LoginHistory
+	MFAStorage
+
+	mu       sync.Mutex
+	user     models.User
+	apps     map[int32]models.App
+	members  map[int]bool
+	sessions map[string]models.Session
+	events   []models.LoginEvent
+}
+
+func (s *membershipStore) FindByLogin(_ context.Context, login string) (models.User, error) {
+	if login != s.user.EmailCanonical {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *membershipStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	if userID != s.user.ID {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *membershipStore) App(_ context.Context, appID int32) (models.App, error) {
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return app, nil
+}
+
+func (s *membershipStore) IsMember(_ context.Context, userID int64, appID int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return userID == s.user.ID && s.members[appID], nil
+}
+
+func (s *membershipStore) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *membershipStore) Session(_ context.Context, id string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *membershipStore) SaveLoginEvent(_ context.Context, event models.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *membershipStore) TOTP(context.Context, int64) (models.TOTPCredential, error) {
+	return models.TOTPCredential{}, domain.ErrMFANotEnrolled
+}
+
+// newMembershipAuth returns a user enrolled in app 1 but not in app 2.
+func newMembershipAuth(t *testing.T) (*Auth, *membershipStore) {
+	t.Helper()
+	passHash := testHash(t, oldPassword)
+	store := &membershipStore{
+		user: models.User{
+			ID: 42, Email: "bob@example.com", EmailCanonical: "bob@example.com",
+			PassHash: passHash, PassAlgo: models.AlgoArgon2id, Status: models.StatusActive,
+		},
+		apps: map[int32]models.App{
+			1: {ID: 1, Name: "app", Secret: "app-secret"},
+			2: {ID: 2, Name: "other", Secret: "other-secret"},
+		},
+		members:  map[int]bool{1: true},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:      slog.New(slog.DiscardHandler),
+		hasher:      testHasher,
+		usrProvider: store,
+		appProvider: store,
+		jwtAdapter:  jwt.New(time.Hour, 24*time.Hour),
+		sessions:    store,
+		memberships: store,
+		history:     store,
+		mfa:         store,
+		cfg:         Config{SessionTTL: 24 * time.Hour},
+	}
+	return a, store
+}
+
+func TestLoginRequiresMembership(t *testing.T) {
+	ctx := context.Background()
+	a, store := newMembershipAuth(t)
+
+	_, err := a.Login(ctx, models.LoginRequest{AppID: 2, Login: "bob@example.com", PassHash: oldPassword})
+	if !errors.Is(err, domain.ErrNotMember) {
+		t.Fatalf("Login() to a foreign app error = %v, want ErrNotMember", err)
+	}
+	if len(store.sessions) != 0 {
+		t.Errorf("refused login opened %d sessions", len(store.sessions))
+	}
+	// A wrong password is reported as such, not as a missing membership,
+	// so the app does not learn who is enrolled elsewhere.
+	_, err = a.Login(ctx, models.LoginRequest{AppID: 2, Login: "bob@example.com", PassHash: "wrong"})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with a wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+
+	if _, err := a.Login(ctx, models.LoginRequest{AppID: 1, Login: "bob@example.com", PassHash: oldPassword}); err != nil {
+		t.Errorf("Login() to the user's app error = %v", err)
+	}
+}
+
+func TestRefreshTokenRequiresMembership(t *testing.T) {
+	ctx := context.Background()
+	a, store := newMembershipAuth(t)
+	result, err := a.Login(ctx, models.LoginRequest{AppID: 1, Login: "bob@example.com", PassHash: oldPassword})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	refresh := result.RefreshToken
+	if _, err := a.RefreshToken(ctx, models.RefreshTokenRequest{AppID: 1, RefreshToken: refresh}); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	// An admin revokes the membership; the session itself is still active.
+	store.mu.Lock()
+	delete(store.members, 1)
+	store.mu.Unlock()
+	_, err = a.RefreshToken(ctx, models.RefreshTokenRequest{AppID: 1, RefreshToken: refresh})
+	if !errors.Is(err, domain.ErrNotMember) {
+		t.Errorf("RefreshToken() after losing the membership error = %v, want ErrNotMember", err)
+	}
+	store.mu.Lock()
+	last := store.events[len(store.events)-1]
+	store.mu.Unlock()
+	if last.Kind != models.LoginEventRefresh || last.Outcome != models.OutcomeNotMember {
+		t.Errorf("last login event = %s/%s, want the refused refresh", last.Kind, last.Outcome)
+	}
+}
@@ -0,0 +1,305 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+	"github.com/LockMessage/sso/internal/infrastructure/sealer"
+	"github.com/LockMessage/sso/internal/infrastructure/totp"
+)
+
+// mfaAfterPasskey marks the MFA tokens of logins that began with a passkey
+// rather than the password.
+const mfaAfterPasskey = "passkey"
+
+// totpSkew is how many 30 second steps a code may be early or late, to
+// absorb clock drift between the server and the user's device.
+const totpSkew = 1
+
+// EnrollTOTP starts setting up an authenticator app for the authenticated
+// user. The returned secret only becomes a second factor once ConfirmTOTP
+// receives a code made from it; until then enrolling again replaces it.
+func (a *Auth) EnrollTOTP(ctx context.Context, req models.EnrollTOTPRequest) (models.TOTPEnrollment, error) {
+	const op = "auth.EnrollTOTP"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("enrolling totp")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.verifyPassword(p.user, req.Password); err != nil {
+		log.Warn("wrong password", slog.Int64("user_id", p.user.ID))
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("failed to generate totp secret", sl.Err(err))
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	sealed, err := a.sealer.Seal([]byte(secret), totpAdditionalData(p.user.ID))
+	if err != nil {
+		log.Error("failed to encrypt totp secret", sl.Err(err))
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, sealError(err))
+	}
+	if err := a.mfa.SaveTOTP(ctx, p.user.ID, sealed); err != nil {
+		return models.TOTPEnrollment{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("totp enrollment pending", slog.Int64("user_id", p.user.ID))
+	return models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(a.cfg.MFAIssuer, p.user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP turns the pending enrollment of the authenticated user into a
+// second factor, once they prove it works with a first code.
+func (a *Auth) ConfirmTOTP(ctx context.Context, req models.ConfirmTOTPRequest) error {
+	const op = "auth.ConfirmTOTP"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("confirming totp")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	cred, err := a.mfa.TOTP(ctx, p.user.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if cred.Confirmed() {
+		return fmt.Errorf("%s: %w", op, domain.ErrMFAAlreadyEnabled)
+	}
+	step, err := a.validateTOTP(cred, req.Code)
+	if err != nil {
+		log.Warn("wrong totp code", slog.Int64("user_id", p.user.ID), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.mfa.ConfirmTOTP(ctx, p.user.ID, step); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      p.user.Email,
+		Subject: "Two-factor authentication was turned on",
+		Body: "Logging in to your account now takes a code from your authenticator app.\n\n" +
+			"If this wasn't you, reset your password right away.",
+	})
+	if err != nil {
+		log.Error("failed to send mfa notice", sl.Err(err))
+	}
+	log.Info("totp confirmed", slog.Int64("user_id", p.user.ID))
+	return nil
+}
+
+// VerifyMFA completes a login that returned an MFA token: a valid code from
+// the user's authenticator app yields what Login would have without MFA.
+// The MFA token is redeemed by the first accepted code, so it completes one
+// login only. Too many wrong codes lock it for a while, see
+// Config.MFAMaxFailures.
+func (a *Auth) VerifyMFA(ctx context.Context, req models.VerifyMFARequest) (result models.LoginResult, err error) {
+	const op = "auth.VerifyMFA"
+	var userID int64
+	defer func() {
+		outcome := loginOutcome(err)
+		if err == nil && result.PasswordChangeToken != "" {
+			outcome = models.OutcomePasswordExpired
+		}
+		a.recordLogin(ctx, models.LoginEventMFA, userID, req.AppID, req.Client, outcome)
+	}()
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("verifying second factor")
+	challenge, firstFactor, err := a.mfaChallenge(ctx, req.AppID, req.MFAToken)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app, err := a.appProvider.App(ctx, req.AppID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrProvider.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidToken)
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	userID = user.ID
+	if err := checkStatus(user, app); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.checkMembership(ctx, user.ID, app.ID); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	cred, err := a.mfa.TOTP(ctx, user.ID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !cred.Confirmed() {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrMFANotEnrolled)
+	}
+	if a.mfaLocked(cred, time.Now()) {
+		log.Warn("totp locked", slog.Int64("user_id", user.ID), slog.Int("failures", cred.FailedAttempts))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrMFALocked)
+	}
+	step, err := a.validateTOTP(cred, req.Code)
+	if err != nil {
+		log.Warn("wrong totp code", slog.Int64("user_id", user.ID), sl.Err(err))
+		if errors.Is(err, domain.ErrInvalidMFACode) {
+			a.recordTOTPFailure(ctx, user)
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.mfa.UseTOTPStep(ctx, user.ID, step); err != nil {
+		log.Warn("totp code replayed", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Of concurrent requests with valid codes, only one redeems the token.
+	if _, err := a.tokenStorage.ConsumeToken(ctx, models.PurposeMFAChallenge, challenge.Hash); err != nil {
+		if errors.Is(err, domain.ErrInvalidCode) {
+			err = domain.ErrInvalidToken
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if firstFactor == mfaAfterPasskey {
+		// As in FinishPasskeyLogin, the password was not used, so its age
+		// does not matter.
+		result.AccessToken, result.RefreshToken, err = a.startSession(ctx, user, app)
+	} else {
+		result, err = a.completeLogin(ctx, user, app)
+	}
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user logged successfully")
+	return result, nil
+}
+
+// issueMFAToken issues the token VerifyMFA exchanges for a login of the user
+// to appID. firstFactor is mfaAfterPasskey when the login began with a
+// passkey, or empty for the password.
+func (a *Auth) issueMFAToken(ctx context.Context, userID int64, appID int, firstFactor string) (string, error) {
+	payload := strconv.Itoa(appID)
+	if firstFactor != "" {
+		payload += ":" + firstFactor
+	}
+	return a.issueCodeWithPayload(ctx, userID, models.PurposeMFAChallenge, payload, a.cfg.MFAChallengeTTL)
+}
+
+// mfaChallenge looks up the unredeemed MFA token issued for appID and
+// returns it with the first factor of its login, see issueMFAToken.
+// It returns domain.ErrInvalidToken for unknown, expired or used tokens
+// and for tokens of another app.
+func (a *Auth) mfaChallenge(ctx context.Context, appID int32, mfaToken string) (models.OneTimeToken, string, error) {
+	hash, err := a.codeIssuer.Verify(models.PurposeMFAChallenge, mfaToken)
+	if err != nil {
+		a.logger.Warn("invalid mfa token signature", sl.Err(err))
+		return models.OneTimeToken{}, "", domain.ErrInvalidToken
+	}
+	challenge, err := a.tokenStorage.FindToken(ctx, models.PurposeMFAChallenge, hash)
+	if errors.Is(err, domain.ErrInvalidCode) {
+		return models.OneTimeToken{}, "", domain.ErrInvalidToken
+	}
+	if err != nil {
+		return models.OneTimeToken{}, "", err
+	}
+	tokenApp, firstFactor, _ := strings.Cut(challenge.Payload, ":")
+	if tokenApp != strconv.Itoa(int(appID)) {
+		return models.OneTimeToken{}, "", domain.ErrInvalidToken
+	}
+	return challenge, firstFactor, nil
+}
+
+// mfaLocked reports whether VerifyMFA refuses codes of cred at now, after
+// too many wrong ones.
+func (a *Auth) mfaLocked(cred models.TOTPCredential, now time.Time) bool {
+	if a.cfg.MFAMaxFailures <= 0 || cred.FailedAttempts < a.cfg.MFAMaxFailures || cred.LastFailureAt == nil {
+		return false
+	}
+	return now.Before(cred.LastFailureAt.Add(a.cfg.MFALockout))
+}
+
+// recordTOTPFailure counts a wrong code of the user and tells them when it
+// locks VerifyMFA: whoever sends the codes knows their password. Once a
+// lockout is over, the next wrong code starts the count again. Failures are
+// logged only, the code is refused either way.
+func (a *Auth) recordTOTPFailure(ctx context.Context, user models.User) {
+	const op = "auth.recordTOTPFailure"
+	log := a.logger.With(
+		slog.String("op", op),
+		slog.Int64("user_id", user.ID),
+	)
+	failures, err := a.mfa.RecordTOTPFailure(ctx, user.ID, a.cfg.MFALockout)
+	if err != nil {
+		log.Error("failed to record wrong totp code", sl.Err(err))
+		return
+	}
+	if a.cfg.MFAMaxFailures <= 0 || failures != a.cfg.MFAMaxFailures {
+		return
+	}
+	log.Warn("totp locked after too many wrong codes")
+	err = a.mailer.Send(ctx, models.Message{
+		To:      user.Email,
+		Subject: "Too many wrong two-factor codes",
+		Body: "Someone logged in with your password but then entered several wrong codes " +
+			"from your authenticator app, so two-factor codes are refused for a while.\n\n" +
+			"If this wasn't you, change your password right away.",
+	})
+	if err != nil {
+		log.Error("failed to send lockout notice", sl.Err(err))
+	}
+}
+
+// mfaEnabled reports whether the user confirmed a second factor.
+func (a *Auth) mfaEnabled(ctx context.Context, userID int64) (bool, error) {
+	cred, err := a.mfa.TOTP(ctx, userID)
+	if errors.Is(err, domain.ErrMFANotEnrolled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return cred.Confirmed(), nil
+}
+
+// validateTOTP checks code against the credential and returns the time
+// step it was made for. It returns domain.ErrInvalidMFACode for wrong codes
+// and for codes no newer than the last one accepted.
+func (a *Auth) validateTOTP(cred models.TOTPCredential, code string) (int64, error) {
+	secret, err := a.sealer.Open(cred.Secret, totpAdditionalData(cred.UserID))
+	if err != nil {
+		return 0, sealError(err)
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now(), totpSkew)
+	if !ok || step <= cred.LastStep {
+		return 0, domain.ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+// totpAdditionalData binds a sealed TOTP secret to its user, so that a
+// secret copied to another row does not decrypt.
+func totpAdditionalData(userID int64) []byte {
+	return []byte("totp:" + strconv.FormatInt(userID, 10))
+}
+
+// sealError reports a missing encryption key as domain.ErrMFAUnavailable.
+func sealError(err error) error {
+	if errors.Is(err, sealer.ErrNoKey) {
+		return domain.ErrMFAUnavailable
+	}
+	return err
+}
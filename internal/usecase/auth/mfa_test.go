@@ -0,0 +1,369 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/onetime"
+	"github.com/LockMessage/sso/internal/infrastructure/sealer"
+	"github.com/LockMessage/sso/internal/infrastructure/totp"
+)
+
+// mfaStore keeps in memory what Login and VerifyMFA read and write for a
+// single user of app 1. The embedded interfaces are left nil: calling their
+// other methods panics.
+type mfaStore struct {
+	UserProvider
+	TokenStorage
+	SessionStorage
+	MembershipStorage
+	LoginHistory
+	MFAStorage
+
+	mu       sync.Mutex
+	user     models.User
+	app      models.App
+	tokens   []models.OneTimeToken
+	used     map[int64]bool
+	totp     models.TOTPCredential
+	sessions int
+	events   []models.LoginEvent
+	messages []models.Message
+}
+
+func (s *mfaStore) FindByLogin(_ context.Context, login string) (models.User, error) {
+	if login != s.user.EmailCanonical {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *mfaStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	if userID != s.user.ID {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *mfaStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *mfaStore) IsMember(_ context.Context, userID int64, appID int) (bool, error) {
+	return userID == s.user.ID && appID == s.app.ID, nil
+}
+
+func (s *mfaStore) SaveToken(_ context.Context, token models.OneTimeToken) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = int64(len(s.tokens) + 1)
+	s.tokens = append(s.tokens, token)
+	return token.ID, nil
+}
+
+// findToken must be called with s.mu held.
+func (s *mfaStore) findToken(purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	for _, t := range s.tokens {
+		if t.Purpose == purpose && bytes.Equal(t.Hash, hash) && !s.used[t.ID] && time.Now().Before(t.ExpiresAt) {
+			return t, nil
+		}
+	}
+	return models.OneTimeToken{}, domain.ErrInvalidCode
+}
+
+func (s *mfaStore) FindToken(_ context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findToken(purpose, hash)
+}
+
+func (s *mfaStore) ConsumeToken(_ context.Context, purpose models.TokenPurpose, hash []byte) (models.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.findToken(purpose, hash)
+	if err != nil {
+		return models.OneTimeToken{}, err
+	}
+	s.used[t.ID] = true
+	return t, nil
+}
+
+func (s *mfaStore) SaveSession(context.Context, models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions++
+	return nil
+}
+
+func (s *mfaStore) SaveLoginEvent(_ context.Context, event models.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *mfaStore) TOTP(_ context.Context, userID int64) (models.TOTPCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.totp.UserID {
+		return models.TOTPCredential{}, domain.ErrMFANotEnrolled
+	}
+	return s.totp, nil
+}
+
+func (s *mfaStore) UseTOTPStep(_ context.Context, userID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.totp.UserID || !s.totp.Confirmed() || s.totp.LastStep >= step {
+		return domain.ErrInvalidMFACode
+	}
+	s.totp.LastStep, s.totp.FailedAttempts = step, 0
+	return nil
+}
+
+func (s *mfaStore) RecordTOTPFailure(_ context.Context, userID int64, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.totp.UserID || !s.totp.Confirmed() {
+		return 0, domain.ErrMFANotEnrolled
+	}
+	now := time.Now().UTC()
+	if s.totp.LastFailureAt == nil || !now.Before(s.totp.LastFailureAt.Add(window)) {
+		s.totp.FailedAttempts = 0
+	}
+	s.totp.FailedAttempts++
+	s.totp.LastFailureAt = &now
+	return s.totp.FailedAttempts, nil
+}
+
+func (s *mfaStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// newMFAAuth returns an Auth over a store holding bob with a confirmed
+// authenticator app, and the app's secret.
+func newMFAAuth(t *testing.T, cfg Config) (*Auth, *mfaStore, string) {
+	t.Helper()
+	seal, err := sealer.New(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := seal.Seal([]byte(secret), totpAdditionalData(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	store := &mfaStore{
+		user: models.User{
+			ID: 42, Email: "bob@example.com", EmailCanonical: "bob@example.com",
+			PassHash: testHash(t, oldPassword), PassAlgo: models.AlgoArgon2id, Status: models.StatusActive,
+		},
+		app:  models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		used: map[int64]bool{},
+		totp: models.TOTPCredential{UserID: 42, Secret: sealed, CreatedAt: now, ConfirmedAt: &now},
+	}
+	cfg.SessionTTL, cfg.MFAChallengeTTL = 24*time.Hour, time.Minute
+	a := &Auth{
+		logger:       slog.New(slog.DiscardHandler),
+		hasher:       testHasher,
+		sealer:       seal,
+		usrProvider:  store,
+		appProvider:  store,
+		jwtAdapter:   jwt.New(time.Hour, 24*time.Hour),
+		tokenStorage: store,
+		sessions:     store,
+		memberships:  store,
+		history:      store,
+		mfa:          store,
+		codeIssuer:   onetime.New("code-secret"),
+		mailer:       store,
+		cfg:          cfg,
+	}
+	return a, store, secret
+}
+
+// totpCodes returns the current code of secret and one that is wrong at
+// any step VerifyMFA accepts.
+func totpCodes(t *testing.T, secret string) (right, wrong string) {
+	t.Helper()
+	now := totp.Step(time.Now())
+	accepted := map[string]bool{}
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		code, err := totp.Code(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted[code] = true
+	}
+	right, _ = totp.Code(secret, now)
+	for _, wrong = range []string{"000000", "111111", "222222", "333333"} {
+		if !accepted[wrong] {
+			break
+		}
+	}
+	return right, wrong
+}
+
+// mfaToken logs bob in and returns the token VerifyMFA expects.
+func mfaToken(t *testing.T, a *Auth) string {
+	t.Helper()
+	result, err := a.Login(context.Background(), models.LoginRequest{AppID: 1, Login: "bob@example.com", PassHash: oldPassword})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if result.MFAToken == "" || result.AccessToken != "" {
+		t.Fatalf("Login() = %+v, want only an MFA token", result)
+	}
+	return result.MFAToken
+}
+
+func TestVerifyMFA(t *testing.T) {
+	ctx := context.Background()
+	a, store, secret := newMFAAuth(t, Config{MFAMaxFailures: 5, MFALockout: time.Minute})
+	right, wrong := totpCodes(t, secret)
+	token := mfaToken(t, a)
+
+	_, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: wrong})
+	if !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Errorf("VerifyMFA() with a wrong code error = %v, want ErrInvalidMFACode", err)
+	}
+	access, _, err := a.startSession(ctx, store.user, store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: access, Code: right})
+	if !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("VerifyMFA() with an access token error = %v, want ErrInvalidToken", err)
+	}
+
+	// A wrong code leaves the token usable.
+	result, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: right})
+	if err != nil {
+		t.Fatalf("VerifyMFA() error = %v", err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" {
+		t.Errorf("VerifyMFA() = %+v, want a token pair", result)
+	}
+	if got := store.totp.FailedAttempts; got != 0 {
+		t.Errorf("failed attempts after an accepted code = %d, want 0", got)
+	}
+}
+
+func TestVerifyMFATokenIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	a, store, secret := newMFAAuth(t, Config{})
+	token := mfaToken(t, a)
+	right, _ := totpCodes(t, secret)
+	if _, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: right}); err != nil {
+		t.Fatalf("VerifyMFA() error = %v", err)
+	}
+
+	// Even with a fresh code, the token does not open a second session.
+	store.mu.Lock()
+	store.totp.LastStep = 0
+	store.mu.Unlock()
+	_, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: right})
+	if !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("VerifyMFA() reusing the token error = %v, want ErrInvalidToken", err)
+	}
+	if store.sessions != 1 {
+		t.Errorf("%d sessions opened, want 1", store.sessions)
+	}
+
+	// Tokens are bound to the app they were issued for.
+	other := mfaToken(t, a)
+	store.app.ID = 2
+	_, err = a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 2, MFAToken: other, Code: right})
+	if !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("VerifyMFA() for another app error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyMFALockout(t *testing.T) {
+	ctx := context.Background()
+	a, store, secret := newMFAAuth(t, Config{MFAMaxFailures: 3, MFALockout: time.Minute})
+	right, wrong := totpCodes(t, secret)
+
+	for i := range 3 {
+		// Logging in again does not reset the count.
+		_, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: mfaToken(t, a), Code: wrong})
+		if !errors.Is(err, domain.ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: VerifyMFA() error = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+	if msg := store.messages[len(store.messages)-1]; msg.Subject != "Too many wrong two-factor codes" {
+		t.Errorf("last message = %q, want the lockout notice", msg.Subject)
+	}
+
+	// Even the right code is refused while locked.
+	token := mfaToken(t, a)
+	_, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: right})
+	if !errors.Is(err, domain.ErrMFALocked) {
+		t.Fatalf("VerifyMFA() while locked error = %v, want ErrMFALocked", err)
+	}
+	if last := store.events[len(store.events)-1]; last.Outcome != models.OutcomeMFALocked {
+		t.Errorf("refused attempt recorded as %q, want %q", last.Outcome, models.OutcomeMFALocked)
+	}
+
+	// Once the lockout is over, a single wrong code does not lock again.
+	store.mu.Lock()
+	past := store.totp.LastFailureAt.Add(-time.Minute)
+	store.totp.LastFailureAt = &past
+	store.mu.Unlock()
+	_, err = a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: wrong})
+	if !errors.Is(err, domain.ErrInvalidMFACode) {
+		t.Fatalf("VerifyMFA() after the lockout error = %v, want ErrInvalidMFACode", err)
+	}
+	if got := store.totp.FailedAttempts; got != 1 {
+		t.Errorf("failed attempts after the lockout = %d, want the count started again", got)
+	}
+	if _, err := a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: token, Code: right}); err != nil {
+		t.Errorf("VerifyMFA() after the lockout error = %v", err)
+	}
+}
+
+func TestMFALocked(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-time.Second), now.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		max      int
+		failures int
+		last     *time.Time
+		want     bool
+	}{
+		{"below the limit", 3, 2, &recent, false},
+		{"at the limit", 3, 3, &recent, true},
+		{"past the limit", 3, 7, &recent, true},
+		{"lockout over", 3, 3, &old, false},
+		{"never failed", 3, 0, nil, false},
+		{"no limit", 0, 100, &recent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Auth{cfg: Config{MFAMaxFailures: tt.max, MFALockout: time.Minute}}
+			cred := models.TOTPCredential{FailedAttempts: tt.failures, LastFailureAt: tt.last}
+			if got := a.mfaLocked(cred, now); got != tt.want {
+				t.Errorf("mfaLocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn"
+	"github.com/google/uuid"
+)
+
+// BeginPasskeyRegistration starts adding a passkey to the authenticated
+// user's account. The returned options go to navigator.credentials.create();
+// its response goes to FinishPasskeyRegistration with the challenge id.
+func (a *Auth) BeginPasskeyRegistration(ctx context.Context, req models.BeginPasskeyRegistrationRequest) (models.PasskeyCeremony, error) {
+	const op = "auth.BeginPasskeyRegistration"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("starting passkey registration")
+	if !a.passkeysEnabled() {
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, domain.ErrPasskeysUnavailable)
+	}
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.verifyPassword(p.user, req.Password); err != nil {
+		log.Warn("wrong password", slog.Int64("user_id", p.user.ID))
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	// Authenticators refuse to register a second passkey for the account.
+	registered, err := a.passkeys.UserPasskeys(ctx, p.user.ID)
+	if err != nil {
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, err)
+	}
+	exclude := make([]webauthn.Credential, len(registered))
+	for i, passkey := range registered {
+		exclude[i] = webauthnCredential(passkey)
+	}
+	displayName := p.user.DisplayName
+	if displayName == "" {
+		displayName = p.user.Email
+	}
+	user := webauthn.User{Handle: userHandle(p.user.ID), Name: p.user.Email, DisplayName: displayName}
+	ceremony, err := a.beginCeremony(ctx, p.user.ID, p.app.ID, models.CeremonyRegistration,
+		func(challenge []byte) ([]byte, error) {
+			return a.cfg.RelyingParty.CreationOptions(user, challenge, exclude, a.cfg.PasskeyChallengeTTL)
+		},
+	)
+	if err != nil {
+		log.Error("failed to start passkey registration", sl.Err(err))
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return ceremony, nil
+}
+
+// FinishPasskeyRegistration verifies the credential the authenticator
+// created and stores it as a passkey of the authenticated user.
+func (a *Auth) FinishPasskeyRegistration(ctx context.Context, req models.FinishPasskeyRegistrationRequest) (int64, error) {
+	const op = "auth.FinishPasskeyRegistration"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("finishing passkey registration")
+	if !a.passkeysEnabled() {
+		return 0, fmt.Errorf("%s: %w", op, domain.ErrPasskeysUnavailable)
+	}
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	challenge, err := a.consumeChallenge(ctx, req.ChallengeID, models.CeremonyRegistration)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if challenge.UserID != p.user.ID || challenge.AppID != p.app.ID {
+		log.Warn("challenge of another user", slog.Int64("user_id", p.user.ID))
+		return 0, fmt.Errorf("%s: %w", op, domain.ErrInvalidChallenge)
+	}
+	cred, err := a.cfg.RelyingParty.VerifyRegistration(challenge.Challenge, req.Credential)
+	if err != nil {
+		log.Warn("passkey rejected", slog.Int64("user_id", p.user.ID), sl.Err(err))
+		return 0, fmt.Errorf("%s: %w: %w", op, domain.ErrInvalidPasskey, err)
+	}
+	id, err := a.passkeys.SavePasskey(ctx, models.Passkey{
+		UserID:         p.user.ID,
+		CredentialID:   cred.ID,
+		PublicKey:      cred.PublicKey,
+		SignCount:      cred.SignCount,
+		Transports:     cred.Transports,
+		AAGUID:         cred.AAGUID,
+		BackupEligible: cred.BackupEligible,
+		BackedUp:       cred.BackedUp,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      p.user.Email,
+		Subject: "A passkey was added to your account",
+		Body: "A new passkey can now be used to log in to your account.\n\n" +
+			"If this wasn't you, reset your password right away.",
+	})
+	if err != nil {
+		log.Error("failed to send passkey notice", sl.Err(err))
+	}
+	log.Info("passkey registered", slog.Int64("user_id", p.user.ID), slog.Int64("passkey_id", id))
+	return id, nil
+}
+
+// BeginPasskeyLogin starts a login with a passkey. The options name no
+// user: the authenticator offers the passkeys it holds for the relying
+// party, and the one picked tells who logs in.
+func (a *Auth) BeginPasskeyLogin(ctx context.Context, req models.BeginPasskeyLoginRequest) (models.PasskeyCeremony, error) {
+	const op = "auth.BeginPasskeyLogin"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	if !a.passkeysEnabled() {
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, domain.ErrPasskeysUnavailable)
+	}
+	app, err := a.appProvider.App(ctx, req.AppID)
+	if err != nil {
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, err)
+	}
+	ceremony, err := a.beginCeremony(ctx, 0, app.ID, models.CeremonyAuthentication,
+		func(challenge []byte) ([]byte, error) {
+			return a.cfg.RelyingParty.RequestOptions(challenge, nil, a.cfg.PasskeyChallengeTTL)
+		},
+	)
+	if err != nil {
+		log.Error("failed to start passkey login", sl.Err(err))
+		return models.PasskeyCeremony{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return ceremony, nil
+}
+
+// FinishPasskeyLogin verifies the assertion of a passkey and opens a session
+// of its user, like Login does after checking a password. The password's
+// age does not matter here since it is not used. Unless the relying party
+// requires user verification, users with a second factor get an MFA token
+// instead, as a passkey alone then only proves possession.
+func (a *Auth) FinishPasskeyLogin(ctx context.Context, req models.FinishPasskeyLoginRequest) (result models.LoginResult, err error) {
+	const op = "auth.FinishPasskeyLogin"
+	var userID int64
+	defer func() {
+		outcome := loginOutcome(err)
+		if err == nil && result.MFAToken != "" {
+			outcome = models.OutcomeMFARequired
+		}
+		a.recordLogin(ctx, models.LoginEventPasskey, userID, req.AppID, req.Client, outcome)
+	}()
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("attempting to login user with a passkey")
+	if !a.passkeysEnabled() {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrPasskeysUnavailable)
+	}
+	// The challenge is used up first, so that a failed attempt cannot be retried.
+	challenge, err := a.consumeChallenge(ctx, req.ChallengeID, models.CeremonyAuthentication)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app, err := a.appProvider.App(ctx, req.AppID)
+	if err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if challenge.AppID != app.ID {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidChallenge)
+	}
+	assertion, err := webauthn.ParseAssertion(req.Credential)
+	if err != nil {
+		log.Warn("malformed assertion", sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w: %w", op, domain.ErrInvalidPasskey, err)
+	}
+	passkey, err := a.passkeys.PasskeyByCredentialID(ctx, assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, domain.ErrPasskeyNotFound) {
+			log.Warn("unknown passkey")
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidPasskey)
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	userID = passkey.UserID
+	if len(assertion.UserHandle) > 0 && !bytes.Equal(assertion.UserHandle, userHandle(passkey.UserID)) {
+		log.Warn("passkey of another user", slog.Int64("user_id", passkey.UserID))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidPasskey)
+	}
+	cred, err := a.cfg.RelyingParty.VerifyAssertion(assertion, challenge.Challenge, webauthnCredential(passkey))
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			log.Warn("passkey counter went back, authenticator may be cloned",
+				slog.Int64("user_id", passkey.UserID), slog.Int64("passkey_id", passkey.ID))
+		} else {
+			log.Warn("passkey rejected", slog.Int64("user_id", passkey.UserID), sl.Err(err))
+		}
+		return models.LoginResult{}, fmt.Errorf("%s: %w: %w", op, domain.ErrInvalidPasskey, err)
+	}
+	if err := a.passkeys.UpdatePasskeyUsage(ctx, passkey.ID, cred.SignCount, cred.BackedUp); err != nil {
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrProvider.FindByID(ctx, passkey.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, domain.ErrInvalidPasskey)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := checkStatus(user, app); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.checkMembership(ctx, user.ID, app.ID); err != nil {
+		log.Warn("user may not log in", slog.Int64("user_id", user.ID), sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !a.cfg.RelyingParty.RequireUserVerification {
+		enrolled, err := a.mfaEnabled(ctx, user.ID)
+		if err != nil {
+			log.Error("failed to get second factor", sl.Err(err))
+			return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if enrolled {
+			token, err := a.issueMFAToken(ctx, user.ID, app.ID, mfaAfterPasskey)
+			if err != nil {
+				log.Error("failed to issue mfa token", sl.Err(err))
+				return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+			}
+			log.Info("second factor required", slog.Int64("user_id", user.ID))
+			return models.LoginResult{MFAToken: token}, nil
+		}
+	}
+	result.AccessToken, result.RefreshToken, err = a.startSession(ctx, user, app)
+	if err != nil {
+		log.Error("failed to start session", sl.Err(err))
+		return models.LoginResult{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("user logged successfully", slog.Int64("user_id", user.ID))
+	return result, nil
+}
+
+// passkeysEnabled reports whether a relying party is configured.
+func (a *Auth) passkeysEnabled() bool {
+	return a.cfg.RelyingParty.ID != ""
+}
+
+// beginCeremony stores a new challenge for the ceremony and returns it with
+// the options options builds for it.
+func (a *Auth) beginCeremony(
+	ctx context.Context,
+	userID int64,
+	appID int,
+	kind models.WebAuthnCeremony,
+	options func(challenge []byte) ([]byte, error),
+) (models.PasskeyCeremony, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return models.PasskeyCeremony{}, err
+	}
+	opts, err := options(challenge)
+	if err != nil {
+		return models.PasskeyCeremony{}, err
+	}
+	state := models.WebAuthnChallenge{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		AppID:     appID,
+		Ceremony:  kind,
+		Challenge: challenge,
+		ExpiresAt: time.Now().UTC().Add(a.cfg.PasskeyChallengeTTL),
+	}
+	if err := a.passkeys.SaveWebAuthnChallenge(ctx, state); err != nil {
+		return models.PasskeyCeremony{}, err
+	}
+	return models.PasskeyCeremony{ChallengeID: state.ID, Options: opts}, nil
+}
+
+// consumeChallenge uses up the challenge of a ceremony.
+// It returns domain.ErrInvalidChallenge if it cannot be used.
+func (a *Auth) consumeChallenge(ctx context.Context, id string, kind models.WebAuthnCeremony) (models.WebAuthnChallenge, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return models.WebAuthnChallenge{}, domain.ErrInvalidChallenge
+	}
+	return a.passkeys.ConsumeWebAuthnChallenge(ctx, id, kind)
+}
+
+// userHandle identifies the user to authenticators. It is the user id,
+// which reveals nothing about them.
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+func webauthnCredential(p models.Passkey) webauthn.Credential {
+	return webauthn.Credential{
+		ID:             p.CredentialID,
+		PublicKey:      p.PublicKey,
+		SignCount:      p.SignCount,
+		Transports:     p.Transports,
+		AAGUID:         p.AAGUID,
+		BackupEligible: p.BackupEligible,
+		BackedUp:       p.BackedUp,
+	}
+}
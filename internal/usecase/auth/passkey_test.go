@@ -0,0 +1,440 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn"
+	"github.com/LockMessage/sso/internal/infrastructure/webauthn/webauthntest"
+)
+
+const passkeyOrigin = "https://app.example.com"
+
+// passkeyStore keeps in memory what the passkey use cases read and write.
+// The embedded interfaces are left nil: calling their other methods panics.
+type passkeyStore struct {
+	UserProvider
+	SessionStorage
+	MembershipStorage
+	LoginHistory
+	MFAStorage
+
+	mu         sync.Mutex
+	user       models.User
+	app        models.App
+	sessions   map[string]models.Session
+	events     []models.LoginEvent
+	passkeys   []models.Passkey
+	challenges map[string]models.WebAuthnChallenge
+	messages   []models.Message
+}
+
+func (s *passkeyStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	if userID != s.user.ID {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *passkeyStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *passkeyStore) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *passkeyStore) Session(_ context.Context, id string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *passkeyStore) IsMember(_ context.Context, userID int64, appID int) (bool, error) {
+	return userID == s.user.ID && appID == s.app.ID, nil
+}
+
+func (s *passkeyStore) SaveLoginEvent(_ context.Context, event models.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *passkeyStore) TOTP(context.Context, int64) (models.TOTPCredential, error) {
+	return models.TOTPCredential{}, domain.ErrMFANotEnrolled
+}
+
+func (s *passkeyStore) SavePasskey(_ context.Context, passkey models.Passkey) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.passkeys {
+		if bytes.Equal(p.CredentialID, passkey.CredentialID) {
+			return 0, domain.ErrPasskeyExists
+		}
+	}
+	passkey.ID = int64(len(s.passkeys) + 1)
+	s.passkeys = append(s.passkeys, passkey)
+	return passkey.ID, nil
+}
+
+func (s *passkeyStore) UserPasskeys(_ context.Context, userID int64) ([]models.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var passkeys []models.Passkey
+	for _, p := range s.passkeys {
+		if p.UserID == userID {
+			passkeys = append(passkeys, p)
+		}
+	}
+	return passkeys, nil
+}
+
+func (s *passkeyStore) PasskeyByCredentialID(_ context.Context, credentialID []byte) (models.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.passkeys {
+		if bytes.Equal(p.CredentialID, credentialID) {
+			return p, nil
+		}
+	}
+	return models.Passkey{}, domain.ErrPasskeyNotFound
+}
+
+func (s *passkeyStore) UpdatePasskeyUsage(_ context.Context, id int64, signCount uint32, backedUp bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &s.passkeys[id-1]
+	if p.SignCount >= signCount && (p.SignCount != 0 || signCount != 0) {
+		return domain.ErrInvalidPasskey
+	}
+	p.SignCount, p.BackedUp = signCount, backedUp
+	return nil
+}
+
+func (s *passkeyStore) SaveWebAuthnChallenge(_ context.Context, challenge models.WebAuthnChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges[challenge.ID] = challenge
+	return nil
+}
+
+func (s *passkeyStore) ConsumeWebAuthnChallenge(_ context.Context, id string, ceremony models.WebAuthnCeremony) (models.WebAuthnChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[id]
+	if !ok || c.Ceremony != ceremony || !time.Now().Before(c.ExpiresAt) {
+		return models.WebAuthnChallenge{}, domain.ErrInvalidChallenge
+	}
+	delete(s.challenges, id)
+	return c, nil
+}
+
+func (s *passkeyStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *passkeyStore) lastEvent(t *testing.T) models.LoginEvent {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		t.Fatal("no login event recorded")
+	}
+	return s.events[len(s.events)-1]
+}
+
+const passkeyPassword = "correct horse battery staple"
+
+func newPasskeyAuth(t *testing.T) (*Auth, *passkeyStore) {
+	t.Helper()
+	hasher := passhash.New(passhash.Argon2Params{Memory: 1024, Time: 1, Parallelism: 1}, nil)
+	passHash, algo, err := hasher.Hash(passkeyPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &passkeyStore{
+		user: models.User{
+			ID:       42,
+			Email:    "bob@example.com",
+			PassHash: passHash,
+			PassAlgo: algo,
+			Status:   models.StatusActive,
+		},
+		app:        models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		sessions:   map[string]models.Session{},
+		challenges: map[string]models.WebAuthnChallenge{},
+	}
+	a, err := New(
+		slog.New(slog.DiscardHandler),
+		nil, store, store, jwt.New(time.Hour, 24*time.Hour), hasher, nil, nil, nil,
+		store, store, store, store, store, nil, store,
+		Config{
+			SessionTTL: 24 * time.Hour,
+			RelyingParty: webauthn.RelyingParty{
+				ID:                      "example.com",
+				Name:                    "Example",
+				Origins:                 []string{passkeyOrigin},
+				RequireUserVerification: true,
+			},
+			PasskeyChallengeTTL: time.Minute,
+		},
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return a, store
+}
+
+// registerPasskey adds a passkey of authn to the store's user.
+func registerPasskey(t *testing.T, a *Auth, store *passkeyStore, authn *webauthntest.Authenticator) {
+	t.Helper()
+	ctx := context.Background()
+	access, _, err := a.startSession(ctx, store.user, store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceremony, err := a.BeginPasskeyRegistration(ctx, models.BeginPasskeyRegistrationRequest{
+		AppID: 1, AccessToken: access, Password: passkeyPassword,
+	})
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration() error = %v", err)
+	}
+	credential, err := authn.Create(ceremony.Options, passkeyOrigin)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	_, err = a.FinishPasskeyRegistration(ctx, models.FinishPasskeyRegistrationRequest{
+		AppID: 1, AccessToken: access, ChallengeID: ceremony.ChallengeID, Credential: credential,
+	})
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration() error = %v", err)
+	}
+}
+
+// passkeyAssertion begins a passkey login and has authn answer it.
+func passkeyAssertion(t *testing.T, a *Auth, authn *webauthntest.Authenticator) models.FinishPasskeyLoginRequest {
+	t.Helper()
+	ceremony, err := a.BeginPasskeyLogin(context.Background(), models.BeginPasskeyLoginRequest{AppID: 1})
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin() error = %v", err)
+	}
+	credential, err := authn.Get(ceremony.Options, passkeyOrigin)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	return models.FinishPasskeyLoginRequest{AppID: 1, ChallengeID: ceremony.ChallengeID, Credential: credential}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	ctx := context.Background()
+	a, store := newPasskeyAuth(t)
+	authn := webauthntest.New()
+	registerPasskey(t, a, store, authn)
+	if len(store.passkeys) != 1 || store.passkeys[0].UserID != 42 {
+		t.Fatalf("passkeys = %+v, want one of user 42", store.passkeys)
+	}
+	if len(store.messages) != 1 || store.messages[0].To != "bob@example.com" {
+		t.Errorf("messages = %+v, want a notice to the user", store.messages)
+	}
+	clone := authn.Clone()
+
+	req := passkeyAssertion(t, a, authn)
+	result, err := a.FinishPasskeyLogin(ctx, req)
+	if err != nil {
+		t.Fatalf("FinishPasskeyLogin() error = %v", err)
+	}
+	// The tokens are those Login issues: an access token bound to a new session.
+	claims, err := a.jwtAdapter.DecodeTokenWithVerification(result.AccessToken, store.app.Secret)
+	if err != nil {
+		t.Fatalf("access token does not verify: %v", err)
+	}
+	if claims["uid"] != float64(42) || claims["type"] != "access" {
+		t.Errorf("access token claims = %v", claims)
+	}
+	if _, ok := store.sessions[claims["sid"].(string)]; !ok {
+		t.Errorf("access token session %v was not saved", claims["sid"])
+	}
+	if result.RefreshToken == "" {
+		t.Error("no refresh token issued")
+	}
+	if store.passkeys[0].SignCount != 1 {
+		t.Errorf("SignCount = %d, want 1", store.passkeys[0].SignCount)
+	}
+	if e := store.lastEvent(t); e.Kind != models.LoginEventPasskey || e.Outcome != models.OutcomeSuccess || e.UserID != 42 {
+		t.Errorf("login event = %+v", e)
+	}
+
+	// Each challenge finishes one ceremony.
+	if _, err := a.FinishPasskeyLogin(ctx, req); !errors.Is(err, domain.ErrInvalidChallenge) {
+		t.Errorf("replayed FinishPasskeyLogin() error = %v, want ErrInvalidChallenge", err)
+	}
+
+	// The clone's counter is behind the stored one.
+	if _, err := a.FinishPasskeyLogin(ctx, passkeyAssertion(t, a, clone)); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("FinishPasskeyLogin() with a clone error = %v, want ErrSignCount", err)
+	}
+	if e := store.lastEvent(t); e.Outcome != models.OutcomeInvalidPasskey {
+		t.Errorf("login event outcome = %q, want %q", e.Outcome, models.OutcomeInvalidPasskey)
+	}
+}
+
+func TestPasskeyLoginWithMFA(t *testing.T) {
+	ctx := context.Background()
+	pa, pkStore := newPasskeyAuth(t)
+	authn := webauthntest.New()
+	registerPasskey(t, pa, pkStore, authn)
+
+	// Bob also has an authenticator app, and his password is past its age.
+	a, store, secret := newMFAAuth(t, Config{PasswordMaxAge: PasswordMaxAge{User: time.Hour}})
+	store.user.PasswordChangedAt = time.Now().UTC().Add(-2 * time.Hour)
+	a.passkeys = pkStore
+	a.cfg.RelyingParty = pa.cfg.RelyingParty
+	a.cfg.RelyingParty.RequireUserVerification = false
+	a.cfg.PasskeyChallengeTTL = time.Minute
+
+	result, err := a.FinishPasskeyLogin(ctx, passkeyAssertion(t, a, authn))
+	if err != nil {
+		t.Fatalf("FinishPasskeyLogin() error = %v", err)
+	}
+	if result.MFAToken == "" || result.AccessToken != "" {
+		t.Fatalf("FinishPasskeyLogin() = %+v, want only an MFA token", result)
+	}
+	if e := store.events[len(store.events)-1]; e.Kind != models.LoginEventPasskey || e.Outcome != models.OutcomeMFARequired {
+		t.Errorf("login event = %+v, want a passkey login requiring mfa", e)
+	}
+
+	// The password played no part, so its age does not matter after the
+	// second factor either, as without one.
+	right, _ := totpCodes(t, secret)
+	result, err = a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: result.MFAToken, Code: right})
+	if err != nil {
+		t.Fatalf("VerifyMFA() error = %v", err)
+	}
+	if result.AccessToken == "" || result.PasswordChangeToken != "" {
+		t.Errorf("VerifyMFA() after a passkey = %+v, want a token pair", result)
+	}
+
+	// The same user logging in with the password has to change it.
+	store.mu.Lock()
+	store.totp.LastStep = 0
+	store.mu.Unlock()
+	result, err = a.VerifyMFA(ctx, models.VerifyMFARequest{AppID: 1, MFAToken: mfaToken(t, a), Code: right})
+	if err != nil {
+		t.Fatalf("VerifyMFA() error = %v", err)
+	}
+	if result.AccessToken != "" || result.PasswordChangeToken == "" {
+		t.Errorf("VerifyMFA() after the password = %+v, want a password change token", result)
+	}
+}
+
+func TestPasskeyLoginRejects(t *testing.T) {
+	ctx := context.Background()
+	a, store := newPasskeyAuth(t)
+	authn := webauthntest.New()
+	registerPasskey(t, a, store, authn)
+
+	// A passkey registered with another deployment of the same relying party.
+	other, otherStore := newPasskeyAuth(t)
+	stranger := webauthntest.New()
+	registerPasskey(t, other, otherStore, stranger)
+
+	tests := []struct {
+		name string
+		req  func() models.FinishPasskeyLoginRequest
+		want error
+	}{
+		{
+			name: "unknown challenge",
+			req: func() models.FinishPasskeyLoginRequest {
+				req := passkeyAssertion(t, a, authn)
+				req.ChallengeID = "not-a-uuid"
+				return req
+			},
+			want: domain.ErrInvalidChallenge,
+		},
+		{
+			name: "registration challenge",
+			req: func() models.FinishPasskeyLoginRequest {
+				req := passkeyAssertion(t, a, authn)
+				for id, c := range store.challenges {
+					c.Ceremony = models.CeremonyRegistration
+					store.challenges[id] = c
+				}
+				return req
+			},
+			want: domain.ErrInvalidChallenge,
+		},
+		{
+			name: "unknown passkey",
+			req: func() models.FinishPasskeyLoginRequest {
+				return passkeyAssertion(t, a, stranger)
+			},
+			want: domain.ErrInvalidPasskey,
+		},
+		{
+			name: "not json",
+			req: func() models.FinishPasskeyLoginRequest {
+				req := passkeyAssertion(t, a, authn)
+				req.Credential = []byte("{")
+				return req
+			},
+			want: domain.ErrInvalidPasskey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.FinishPasskeyLogin(ctx, tt.req()); !errors.Is(err, tt.want) {
+				t.Errorf("FinishPasskeyLogin() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Authenticators refuse to register the same account twice.
+	access, _, err := a.startSession(ctx, store.user, store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ceremony, err := a.BeginPasskeyRegistration(ctx, models.BeginPasskeyRegistrationRequest{
+		AppID: 1, AccessToken: access, Password: passkeyPassword,
+	})
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration() error = %v", err)
+	}
+	if _, err := authn.Create(ceremony.Options, passkeyOrigin); !errors.Is(err, webauthntest.ErrExcluded) {
+		t.Errorf("Create() error = %v, want ErrExcluded", err)
+	}
+	_, err = a.BeginPasskeyRegistration(ctx, models.BeginPasskeyRegistrationRequest{
+		AppID: 1, AccessToken: access, Password: "wrong",
+	})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("BeginPasskeyRegistration() with a wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+
+	a.cfg.RelyingParty = webauthn.RelyingParty{}
+	if _, err := a.BeginPasskeyLogin(ctx, models.BeginPasskeyLoginRequest{AppID: 1}); !errors.Is(err, domain.ErrPasskeysUnavailable) {
+		t.Errorf("BeginPasskeyLogin() without a relying party error = %v, want ErrPasskeysUnavailable", err)
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// RequestPasswordReset emails a password reset code to the owner of the address.
+// It reports success whether or not the address belongs to an account, and
+// failures are only logged, so callers cannot tell registered emails apart.
+func (a *Auth) RequestPasswordReset(ctx context.Context, req models.RequestPasswordResetRequest) error {
+	const op = "auth.RequestPasswordReset"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("requesting password reset")
+	user, err := a.findByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+			return nil
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return nil
+	}
+	code, err := a.issueCode(ctx, user.ID, models.PurposePasswordReset, a.cfg.PasswordResetTTL)
+	if err != nil {
+		log.Error("failed to issue reset code", sl.Err(err))
+		return nil
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "To choose a new password, use this code:\n\n" + a.link("/reset-password", code) +
+			"\n\nIf you did not ask for a password reset, you can ignore this email.",
+	})
+	if err != nil {
+		log.Error("failed to send reset code", sl.Err(err))
+		return nil
+	}
+	log.Info("password reset requested", slog.Int64("user_id", user.ID))
+	return nil
+}
+
+// ResetPassword redeems a reset code, sets the new password and revokes
+// every session of the user.
+func (a *Auth) ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error {
+	const op = "auth.ResetPassword"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("resetting password")
+	// The code is only redeemed once the password is accepted, so that
+	// the user can retry with a better one.
+	breached, err := a.checkNewPassword(ctx, models.PurposePasswordReset, req.Code, req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	token, err := a.consumeCode(ctx, models.PurposePasswordReset, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.setPassword(ctx, token.UserID, req.NewPassword, "", breached); err != nil {
+		log.Error("failed to set password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.tokenStorage.RevokeTokens(ctx, token.UserID, models.PurposePasswordReset); err != nil {
+		log.Error("failed to revoke reset codes", sl.Err(err))
+	}
+	log.Info("password reset", slog.Int64("user_id", token.UserID))
+	return nil
+}
+
+// ChangePassword replaces the password of the authenticated user after
+// checking the current one. Every other session of the user is revoked
+// and the user is notified by email. It also accepts the password change
+// token Login issues for expired passwords, in which case every session
+// is revoked.
+func (a *Auth) ChangePassword(ctx context.Context, req models.ChangePasswordRequest) error {
+	const op = "auth.ChangePassword"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("changing password")
+	p, err := a.authenticateScoped(ctx, req.AppID, req.AccessToken, tokenTypePasswordChange)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.verifyPassword(p.user, req.CurrentPassword); err != nil {
+		log.Warn("wrong current password", slog.Int64("user_id", p.user.ID))
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	breached, err := a.checkPassword(req.NewPassword, p.user.Email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.checkReuse(ctx, p.user, req.NewPassword); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.setPassword(ctx, p.user.ID, req.NewPassword, p.sessionID, breached); err != nil {
+		log.Error("failed to set password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	err = a.mailer.Send(ctx, models.Message{
+		To:      p.user.Email,
+		Subject: "Your password was changed",
+		Body: "The password of your account was just changed and your other sessions were signed out.\n\n" +
+			"If this wasn't you, reset your password right away.",
+	})
+	if err != nil {
+		log.Error("failed to send password change notice", sl.Err(err))
+	}
+	log.Info("password changed", slog.Int64("user_id", p.user.ID))
+	return nil
+}
+
+// checkPassword validates a new password against the policy and screens it
+// against the breach corpus. A breached password is refused like a policy
+// violation unless FlagBreachedPasswords is set; either way the result
+// tells whether it was breached.
+func (a *Auth) checkPassword(password, email string) (breached bool, err error) {
+	err = a.cfg.PasswordPolicy.Validate(password, email)
+	if !a.breaches.Breached(password) {
+		return false, err
+	}
+	if a.cfg.FlagBreachedPasswords {
+		return true, err
+	}
+	var policyErr *domain.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		policyErr = &domain.PasswordPolicyError{}
+	}
+	policyErr.Violations = append(policyErr.Violations, domain.PasswordViolation{
+		Rule:        domain.PasswordRuleBreached,
+		Description: "password appears in a known data breach",
+	})
+	return true, policyErr
+}
+
+// checkNewPassword runs checkPassword on the password chosen with a code,
+// for the user the code was issued to, without redeeming the code.
+func (a *Auth) checkNewPassword(ctx context.Context, purpose models.TokenPurpose, code, password string) (bool, error) {
+	hash, err := a.codeIssuer.Verify(purpose, code)
+	if err != nil {
+		a.logger.Warn("invalid code signature", sl.Err(err))
+		return false, domain.ErrInvalidCode
+	}
+	token, err := a.tokenStorage.FindToken(ctx, purpose, hash)
+	if err != nil {
+		return false, err
+	}
+	user, err := a.usrProvider.FindByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return false, domain.ErrInvalidCode
+		}
+		return false, err
+	}
+	breached, err := a.checkPassword(password, user.Email)
+	if err != nil {
+		return breached, err
+	}
+	return breached, a.checkReuse(ctx, user, password)
+}
+
+// checkReuse refuses a password matching one of the user's last
+// PasswordHistorySize passwords, the current one included. It runs after
+// the cheaper checks since it verifies the password against every hash.
+func (a *Auth) checkReuse(ctx context.Context, user models.User, password string) error {
+	if a.cfg.PasswordHistorySize <= 0 {
+		return nil
+	}
+	reused := a.hasher.Verify(user.PassAlgo, user.PassHash, password) == nil
+	if !reused && a.cfg.PasswordHistorySize > 1 {
+		previous, err := a.usrProvider.PreviousPasswords(ctx, user.ID, a.cfg.PasswordHistorySize-1)
+		if err != nil {
+			return err
+		}
+		for _, p := range previous {
+			if a.hasher.Verify(p.Algo, p.Hash, password) == nil {
+				reused = true
+				break
+			}
+		}
+	}
+	if !reused {
+		return nil
+	}
+	return &domain.PasswordPolicyError{Violations: []domain.PasswordViolation{{
+		Rule:        domain.PasswordRuleReused,
+		Description: fmt.Sprintf("password must differ from your last %d passwords", a.cfg.PasswordHistorySize),
+	}}}
+}
+
+// setPassword hashes and stores a new password and whether it was breached,
+// keeping the replaced one in the password history, then revokes every
+// session of the user except keepSessionID.
+func (a *Auth) setPassword(ctx context.Context, userID int64, password, keepSessionID string, breached bool) error {
+	passHash, algo, err := a.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	// The current password counts towards the history size.
+	keep := max(a.cfg.PasswordHistorySize-1, 0)
+	if err := a.usrSaver.UpdatePassword(ctx, userID, passHash, algo, keep); err != nil {
+		return err
+	}
+	if err := a.usrSaver.SetPasswordBreached(ctx, userID, breached); err != nil {
+		return err
+	}
+	return a.sessions.RevokeSessions(ctx, userID, keepSessionID)
+}
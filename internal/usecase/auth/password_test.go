@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/breach"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+	"github.com/LockMessage/sso/internal/infrastructure/passhash"
+)
+
+const oldPassword = "correct horse battery staple"
+
+// testHasher makes argon2id hashes cheap enough for tests.
+var testHasher = passhash.New(passhash.Argon2Params{Memory: 64, Time: 1, Parallelism: 1}, nil)
+
+// testHash hashes password with testHasher.
+func testHash(t *testing.T, password string) []byte {
+	t.Helper()
+	hash, _, err := testHasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// passwordStore keeps in memory what the password use cases read and write.
+// The embedded interfaces are left nil: calling their other methods panics.
+type passwordStore struct {
+	UserSaver
+	UserProvider
+	SessionStorage
+
+	mu       sync.Mutex
+	user     models.User
+	history  []models.PreviousPassword
+	app      models.App
+	sessions map[string]models.Session
+	messages []models.Message
+}
+
+func (s *passwordStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *passwordStore) UpdatePassword(_ context.Context, userID int64, passHash []byte, algo models.PasswordAlgorithm, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID {
+		return domain.ErrUserNotFound
+	}
+	if keep > 0 {
+		replaced := models.PreviousPassword{Hash: s.user.PassHash, Algo: s.user.PassAlgo, CreatedAt: time.Now().UTC()}
+		s.history = append([]models.PreviousPassword{replaced}, s.history...)
+		s.history = s.history[:min(len(s.history), keep)]
+	}
+	s.user.PassHash, s.user.PassAlgo = passHash, algo
+	return nil
+}
+
+func (s *passwordStore) PreviousPasswords(_ context.Context, userID int64, limit int) ([]models.PreviousPassword, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID {
+		return nil, nil
+	}
+	return s.history[:min(len(s.history), limit)], nil
+}
+
+func (s *passwordStore) SetPasswordBreached(_ context.Context, userID int64, breached bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.user.ID {
+		return domain.ErrUserNotFound
+	}
+	s.user.PasswordBreached = breached
+	return nil
+}
+
+func (s *passwordStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *passwordStore) SaveSession(_ context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *passwordStore) Session(_ context.Context, id string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *passwordStore) RevokeSessions(_ context.Context, userID int64, exceptID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for id, session := range s.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			s.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+func (s *passwordStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// activeSessions counts the sessions that can still be used.
+func (s *passwordStore) activeSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, session := range s.sessions {
+		if session.Active(time.Now().UTC()) {
+			n++
+		}
+	}
+	return n
+}
+
+func newPasswordAuth(t *testing.T) (*Auth, *passwordStore) {
+	t.Helper()
+	passHash := testHash(t, oldPassword)
+	store := &passwordStore{
+		user:     models.User{ID: 42, Email: "bob@example.com", PassHash: passHash, PassAlgo: models.AlgoArgon2id, Status: models.StatusActive},
+		app:      models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:      slog.New(slog.DiscardHandler),
+		hasher:      testHasher,
+		breaches:    breach.None{},
+		usrSaver:    store,
+		usrProvider: store,
+		appProvider: store,
+		jwtAdapter:  jwt.New(time.Hour, 24*time.Hour),
+		sessions:    store,
+		mailer:      store,
+		cfg:         Config{SessionTTL: 24 * time.Hour, PasswordPolicy: validation.DefaultPasswordPolicy()},
+	}
+	return a, store
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	a, store := newPasswordAuth(t)
+	access, _, err := a.startSession(ctx, store.user, store.app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.startSession(ctx, store.user, store.app); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		current string
+		next    string
+		want    error
+	}{
+		{name: "wrong current password", current: "wrong", next: "a brand new password", want: ErrInvalidCredentials},
+		{name: "malformed new password", current: oldPassword, next: "", want: domain.ErrWrongPasswordFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.ChangePassword(ctx, models.ChangePasswordRequest{
+				AppID: 1, AccessToken: access, CurrentPassword: tt.current, NewPassword: tt.next,
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ChangePassword() error = %v, want %v", err, tt.want)
+			}
+			if got := store.activeSessions(); got != 2 {
+				t.Errorf("refused change left %d active sessions, want 2", got)
+			}
+		})
+	}
+
+	err = a.ChangePassword(ctx, models.ChangePasswordRequest{
+		AppID: 1, AccessToken: access, CurrentPassword: oldPassword, NewPassword: "a brand new password",
+	})
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if err := testHasher.Verify(store.user.PassAlgo, store.user.PassHash, "a brand new password"); err != nil {
+		t.Errorf("new password does not verify: %v", err)
+	}
+	// The session the change was made from survives; the others do not.
+	if got := store.activeSessions(); got != 1 {
+		t.Errorf("active sessions = %d, want 1", got)
+	}
+	if _, err := a.authenticate(ctx, 1, access); err != nil {
+		t.Errorf("session of the change was revoked: %v", err)
+	}
+	if len(store.messages) != 1 || store.messages[0].Subject != "Your password was changed" {
+		t.Errorf("messages = %+v, want the change notice", store.messages)
+	}
+}
+
+func TestChangePasswordWithChangeToken(t *testing.T) {
+	ctx := context.Background()
+	a, store := newPasswordAuth(t)
+	if _, _, err := a.startSession(ctx, store.user, store.app); err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.jwtAdapter.GenerateScopedToken(tokenTypePasswordChange, store.user, store.app, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.ChangePassword(ctx, models.ChangePasswordRequest{
+		AppID: 1, AccessToken: token, CurrentPassword: oldPassword, NewPassword: "a brand new password",
+	})
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	// The token belongs to no session, so every session goes.
+	if got := store.activeSessions(); got != 0 {
+		t.Errorf("active sessions = %d, want 0", got)
+	}
+
+	// The token is good for nothing else.
+	if _, err := a.GetMe(ctx, models.GetMeRequest{AppID: 1, AccessToken: token}); err == nil {
+		t.Error("GetMe() accepted a password change token")
+	}
+}
+
+func TestChangePasswordReuse(t *testing.T) {
+	ctx := context.Background()
+	// Each user starts with oldPassword and changes it three times.
+	history := []string{oldPassword, "first new password", "second new password", "third new password"}
+	setup := func(t *testing.T, size int) (*Auth, string) {
+		t.Helper()
+		a, store := newPasswordAuth(t)
+		a.cfg.PasswordHistorySize = size
+		access, _, err := a.startSession(ctx, store.user, store.app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, next := range history[1:] {
+			err := a.ChangePassword(ctx, models.ChangePasswordRequest{
+				AppID: 1, AccessToken: access, CurrentPassword: history[i], NewPassword: next,
+			})
+			if err != nil {
+				t.Fatalf("ChangePassword(%q) error = %v", next, err)
+			}
+		}
+		return a, access
+	}
+	current := history[len(history)-1]
+
+	tests := []struct {
+		name     string
+		size     int
+		password string
+		reused   bool
+	}{
+		{"current password", 3, current, true},
+		{"previous password", 3, history[2], true},
+		{"last password in the history", 3, history[1], true},
+		{"password just out of the history", 3, history[0], false},
+		{"history of one only holds the current password", 1, history[2], false},
+		{"history of one refuses the current password", 1, current, true},
+		{"disabled", 0, current, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, access := setup(t, tt.size)
+			err := a.ChangePassword(ctx, models.ChangePasswordRequest{
+				AppID: 1, AccessToken: access, CurrentPassword: current, NewPassword: tt.password,
+			})
+			var policyErr *domain.PasswordPolicyError
+			reused := errors.As(err, &policyErr) && policyErr.Violations[0].Rule == domain.PasswordRuleReused
+			if reused != tt.reused {
+				t.Fatalf("ChangePassword() error = %v, want reused = %v", err, tt.reused)
+			}
+			if !tt.reused && err != nil {
+				t.Fatalf("ChangePassword() error = %v", err)
+			}
+		})
+	}
+}
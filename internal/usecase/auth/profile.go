@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// GetMe returns the profile of the authenticated user.
+func (a *Auth) GetMe(ctx context.Context, req models.GetMeRequest) (models.User, error) {
+	const op = "auth.GetMe"
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return ownUser(p.user), nil
+}
+
+// GetUser returns the profile of any user to an authenticated caller.
+// Account state and activity are only disclosed to the user themselves,
+// and the email to them and to admins.
+func (a *Auth) GetUser(ctx context.Context, req models.GetUserRequest) (models.User, error) {
+	const op = "auth.GetUser"
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrProvider.FindByID(ctx, req.UserID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if p.user.ID == user.ID {
+		return ownUser(user), nil
+	}
+	return publicUser(user, p.user.IsAdmin), nil
+}
+
+// UpdateProfile changes the profile fields set in the request and returns
+// the updated profile.
+func (a *Auth) UpdateProfile(ctx context.Context, req models.UpdateProfileRequest) (models.User, error) {
+	const op = "auth.UpdateProfile"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("updating profile")
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if req.Update.Username != nil {
+		username := validation.NormalizeUsername(*req.Update.Username)
+		req.Update.Username = &username
+	}
+	if err := validateProfileUpdate(req.Update); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.usrSaver.UpdateProfile(ctx, p.user.ID, req.Update)
+	if err != nil {
+		log.Error("failed to update profile", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("profile updated", slog.Int64("user_id", user.ID))
+	return ownUser(user), nil
+}
+
+func validateProfileUpdate(update models.ProfileUpdate) error {
+	if update.Username != nil {
+		if err := validation.ValidateUsername(*update.Username); err != nil {
+			return err
+		}
+	}
+	if update.DisplayName != nil {
+		if err := validation.ValidateDisplayName(*update.DisplayName); err != nil {
+			return err
+		}
+	}
+	if update.Locale != nil {
+		if err := validation.ValidateLocale(*update.Locale); err != nil {
+			return err
+		}
+	}
+	if update.AvatarURL != nil {
+		if err := validation.ValidateAvatarURL(*update.AvatarURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownUser strips the secrets off user, for the user themselves.
+func ownUser(user models.User) models.User {
+	user.PassHash = nil
+	return user
+}
+
+// publicUser is user as seen by someone else: without secrets, account
+// state or activity, and without the email unless withEmail is set.
+func publicUser(user models.User, withEmail bool) models.User {
+	user = ownUser(user)
+	user.Status = ""
+	user.IsAdmin = false
+	user.LastLoginAt = nil
+	user.PasswordBreached = false
+	if !withEmail {
+		user.Email, user.EmailCanonical = "", ""
+	}
+	return user
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/jwt"
+)
+
+// profileStore keeps in memory what the profile use cases read.
+// The embedded interfaces are left nil: calling their other methods panics.
+type profileStore struct {
+	UserProvider
+	SessionStorage
+
+	users    map[int64]models.User
+	app      models.App
+	sessions map[string]models.Session
+}
+
+func (s *profileStore) FindByID(_ context.Context, userID int64) (models.User, error) {
+	user, ok := s.users[userID]
+	if !ok {
+		return models.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *profileStore) App(_ context.Context, appID int32) (models.App, error) {
+	if int(appID) != s.app.ID {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return s.app, nil
+}
+
+func (s *profileStore) SaveSession(_ context.Context, session models.Session) error {
+	s.sessions[session.ID] = session
+	return nil
+}
+
+func (s *profileStore) Session(_ context.Context, id string) (models.Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return models.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func TestGetUser(t *testing.T) {
+	ctx := context.Background()
+	lastLogin := time.Now().UTC().Add(-time.Hour)
+	store := &profileStore{
+		users: map[int64]models.User{
+			1:  {ID: 1, Email: "root@example.com", PassHash: []byte("hash"), Status: models.StatusActive, IsAdmin: true},
+			42: {ID: 42, Email: "bob@example.com", EmailCanonical: "bob@example.com", PassHash: []byte("hash"), Status: models.StatusActive, DisplayName: "Bob", IsAdmin: true, LastLoginAt: &lastLogin, PasswordBreached: true},
+			43: {ID: 43, Email: "eve@example.com", PassHash: []byte("hash"), Status: models.StatusActive},
+		},
+		app:      models.App{ID: 1, Name: "app", Secret: "app-secret"},
+		sessions: map[string]models.Session{},
+	}
+	a := &Auth{
+		logger:      slog.New(slog.DiscardHandler),
+		usrProvider: store,
+		appProvider: store,
+		jwtAdapter:  jwt.New(time.Hour, 24*time.Hour),
+		sessions:    store,
+		cfg:         Config{SessionTTL: 24 * time.Hour},
+	}
+
+	tests := []struct {
+		name    string
+		caller  int64
+		private bool
+		email   bool
+	}{
+		{name: "themselves", caller: 42, private: true, email: true},
+		{name: "another user", caller: 43, private: false, email: false},
+		{name: "an admin", caller: 1, private: false, email: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, _, err := a.startSession(ctx, store.users[tt.caller], store.app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := a.GetUser(ctx, models.GetUserRequest{AppID: 1, AccessToken: access, UserID: 42})
+			if err != nil {
+				t.Fatalf("GetUser() error = %v", err)
+			}
+			if got.ID != 42 || got.DisplayName != "Bob" || got.PassHash != nil {
+				t.Errorf("GetUser() = %+v, want bob's profile without secrets", got)
+			}
+			if hasEmail := got.Email != "" || got.EmailCanonical != ""; hasEmail != tt.email {
+				t.Errorf("email disclosed = %v, want %v", hasEmail, tt.email)
+			}
+			if hasPrivate := got.Status != "" || got.IsAdmin || got.LastLoginAt != nil || got.PasswordBreached; hasPrivate != tt.private {
+				t.Errorf("account state disclosed = %v, want %v: %+v", hasPrivate, tt.private, got)
+			}
+		})
+	}
+}
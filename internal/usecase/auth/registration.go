@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+)
+
+// checkRegistration tells whether the normalized email may sign up through app.
+func checkRegistration(app models.App, email string) error {
+	switch app.RegistrationPolicy {
+	case models.RegistrationOpen:
+		return nil
+	case models.RegistrationInviteOnly:
+		return domain.ErrRegistrationInviteOnly
+	case models.RegistrationClosed:
+		return domain.ErrRegistrationClosed
+	case models.RegistrationDomain:
+		if slices.Contains(app.AllowedDomains, validation.EmailDomain(email)) {
+			return nil
+		}
+		return domain.ErrEmailDomainNotAllowed
+	default:
+		return fmt.Errorf("unknown registration policy %q", app.RegistrationPolicy)
+	}
+}
@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/domain/rules/validation"
+	"github.com/LockMessage/sso/internal/infrastructure/breach"
+	"github.com/LockMessage/sso/internal/infrastructure/onetime"
+)
+
+func TestCheckRegistration(t *testing.T) {
+	t.Parallel()
+	corp := models.App{RegistrationPolicy: models.RegistrationDomain, AllowedDomains: []string{"ourcorp.com", "xn--bcher-kva.example"}}
+	tests := []struct {
+		name  string
+		app   models.App
+		email string
+		want  error
+	}{
+		{name: "open", app: models.App{RegistrationPolicy: models.RegistrationOpen}, email: "bob@x.com"},
+		{name: "invite only", app: models.App{RegistrationPolicy: models.RegistrationInviteOnly}, email: "bob@x.com", want: domain.ErrRegistrationInviteOnly},
+		{name: "closed", app: models.App{RegistrationPolicy: models.RegistrationClosed}, email: "bob@x.com", want: domain.ErrRegistrationClosed},
+		{name: "allowed domain", app: corp, email: "bob@ourcorp.com"},
+		{name: "allowed punycode domain", app: corp, email: "bob@xn--bcher-kva.example"},
+		{name: "other domain", app: corp, email: "bob@x.com", want: domain.ErrEmailDomainNotAllowed},
+		{name: "subdomain is not the domain", app: corp, email: "bob@mail.ourcorp.com", want: domain.ErrEmailDomainNotAllowed},
+		{name: "suffix is not the domain", app: corp, email: "bob@notourcorp.com", want: domain.ErrEmailDomainNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRegistration(tt.app, tt.email); !errors.Is(got, tt.want) {
+				t.Errorf("checkRegistration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := checkRegistration(models.App{RegistrationPolicy: "bogus"}, "bob@x.com"); err == nil {
+		t.Error("checkRegistration() accepted an unknown policy")
+	}
+}
+
+// registrationStore only knows apps. The embedded interfaces are left nil,
+// so a refused registration that went on to store a user panics.
+type registrationStore struct {
+	UserProvider
+	UserSaver
+
+	apps map[int32]models.App
+}
+
+func (s *registrationStore) App(_ context.Context, appID int32) (models.App, error) {
+	app, ok := s.apps[appID]
+	if !ok {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return app, nil
+}
+
+func TestRegisterNewUserAppliesPolicy(t *testing.T) {
+	store := &registrationStore{apps: map[int32]models.App{
+		1: {ID: 1, Name: "closed", RegistrationPolicy: models.RegistrationClosed},
+	}}
+	a := &Auth{
+		logger:      slog.New(slog.DiscardHandler),
+		usrProvider: store,
+		usrSaver:    store,
+		appProvider: store,
+		breaches:    breach.None{},
+	}
+	tests := []struct {
+		name  string
+		appID int32
+		want  error
+	}{
+		{name: "no app", appID: 0, want: domain.ErrAppNotFound},
+		{name: "unknown app", appID: 9, want: domain.ErrAppNotFound},
+		{name: "closed app", appID: 1, want: domain.ErrRegistrationClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.RegisterNewUser(context.Background(), models.RegisterRequest{
+				AppID: tt.appID, Email: "bob@example.com", Password: oldPassword,
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("RegisterNewUser() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// signUpStore keeps in memory the users registered through app 1, the
+// messages sent to them and their login attempts. The embedded interfaces are left nil: calling
+// their other methods panics.
+type signUpStore struct {
+	UserProvider
+	UserSaver
+	TokenStorage
+	LoginHistory
+
+	mu       sync.Mutex
+	users    []models.User
+	messages []models.Message
+	events   []models.LoginEvent
+}
+
+func (s *signUpStore) FindByEmail(_ context.Context, canonical string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.EmailCanonical == canonical {
+			return u, nil
+		}
+	}
+	return models.User{}, domain.ErrUserNotFound
+}
+
+func (s *signUpStore) FindByLogin(ctx context.Context, login string) (models.User, error) {
+	return s.FindByEmail(ctx, login)
+}
+
+func (s *signUpStore) SaveUser(_ context.Context, user models.User, _ int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user.ID = int64(len(s.users) + 1)
+	s.users = append(s.users, user)
+	return user.ID, nil
+}
+
+func (s *signUpStore) App(_ context.Context, appID int32) (models.App, error) {
+	if appID != 1 {
+		return models.App{}, domain.ErrAppNotFound
+	}
+	return models.App{ID: 1, Name: "app", Secret: "app-secret", RegistrationPolicy: models.RegistrationOpen}, nil
+}
+
+func (s *signUpStore) SaveToken(_ context.Context, _ models.OneTimeToken) (int64, error) {
+	return 1, nil
+}
+
+func (s *signUpStore) Send(_ context.Context, msg models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *signUpStore) SaveLoginEvent(_ context.Context, event models.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func newSignUpAuth(t *testing.T, cfg Config) (*Auth, *signUpStore) {
+	t.Helper()
+	store := &signUpStore{}
+	cfg.PasswordPolicy = validation.DefaultPasswordPolicy()
+	a, err := New(slog.New(slog.DiscardHandler), store, store, store, nil, testHasher, breach.None{}, nil,
+		store, nil, nil, store, nil, nil, onetime.New("code-secret"), store, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return a, store
+}
+
+func TestRegisterNewUserConcealsConflicts(t *testing.T) {
+	ctx := context.Background()
+	for _, conceal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("conceal=%v", conceal), func(t *testing.T) {
+			a, store := newSignUpAuth(t, Config{ConcealRegistrationConflicts: conceal})
+			if _, err := a.RegisterNewUser(ctx, models.RegisterRequest{AppID: 1, Email: "bob@example.com", Password: oldPassword}); err != nil {
+				t.Fatalf("RegisterNewUser() of bob error = %v", err)
+			}
+
+			newID, newErr := a.RegisterNewUser(ctx, models.RegisterRequest{AppID: 1, Email: "eve@example.com", Password: oldPassword})
+			if newErr != nil {
+				t.Fatalf("RegisterNewUser() of a free email error = %v", newErr)
+			}
+			takenID, takenErr := a.RegisterNewUser(ctx, models.RegisterRequest{AppID: 1, Email: "Bob@Example.com", Password: oldPassword})
+
+			if !conceal {
+				if newID == 0 || !errors.Is(takenErr, domain.ErrUserExists) {
+					t.Errorf("RegisterNewUser() = %d, %v and %d, %v; want an id, then ErrUserExists", newID, newErr, takenID, takenErr)
+				}
+				return
+			}
+			// Both answers must look alike.
+			if newID != 0 || takenID != 0 || takenErr != nil {
+				t.Errorf("RegisterNewUser() = %d, %v and %d, %v; want 0, nil twice", newID, newErr, takenID, takenErr)
+			}
+			last := store.messages[len(store.messages)-1]
+			if last.To != "bob@example.com" || last.Subject != signUpConflictNotice.Subject {
+				t.Errorf("last message = %q to %s, want the conflict notice to bob", last.Subject, last.To)
+			}
+			if got := len(store.users); got != 2 {
+				t.Errorf("%d users stored, want 2", got)
+			}
+		})
+	}
+}
+
+// countingHasher counts the password verifications it makes.
+type countingHasher struct {
+	PasswordHasher
+	verified atomic.Int32
+}
+
+func (h *countingHasher) Verify(algo models.PasswordAlgorithm, hash []byte, password string) error {
+	h.verified.Add(1)
+	return h.PasswordHasher.Verify(algo, hash, password)
+}
+
+func TestLoginUnknownUserVerifiesPassword(t *testing.T) {
+	ctx := context.Background()
+	a, store := newSignUpAuth(t, Config{})
+	hasher := &countingHasher{PasswordHasher: testHasher}
+	a.hasher = hasher
+	store.users = append(store.users, models.User{
+		ID: 1, Email: "bob@example.com", EmailCanonical: "bob@example.com",
+		PassHash: testHash(t, oldPassword), PassAlgo: models.AlgoArgon2id, Status: models.StatusActive,
+	})
+
+	// An unknown login must cost as much as a wrong password.
+	for _, login := range []string{"nobody@example.com", "bob@example.com"} {
+		hasher.verified.Store(0)
+		_, err := a.Login(ctx, models.LoginRequest{AppID: 1, Login: login, PassHash: "wrong"})
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login(%q) error = %v, want ErrInvalidCredentials", login, err)
+		}
+		if got := hasher.verified.Load(); got != 1 {
+			t.Errorf("Login(%q) verified %d hashes, want 1", login, got)
+		}
+	}
+}
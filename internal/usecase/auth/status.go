@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+// checkStatus tells whether user may obtain or use tokens for app.
+// Every lifecycle state other than active has its own domain error.
+func checkStatus(user models.User, app models.App) error {
+	switch user.Status {
+	case models.StatusActive:
+		return nil
+	case models.StatusPendingVerification:
+		if app.AllowUnverifiedLogin {
+			return nil
+		}
+		return domain.ErrEmailNotVerified
+	case models.StatusInvited:
+		return domain.ErrInvitationPending
+	case models.StatusDisabled:
+		return domain.ErrUserDisabled
+	case models.StatusDeleted:
+		return domain.ErrUserDeleted
+	default:
+		return fmt.Errorf("unknown user status %q", user.Status)
+	}
+}
+
+// IntrospectToken tells resource servers whether an access token is usable
+// and who it belongs to. It applies the same checks as every authenticated
+// use case: signature, expiry, session and account status.
+func (a *Auth) IntrospectToken(ctx context.Context, req models.IntrospectTokenRequest) (models.Introspection, error) {
+	const op = "auth.IntrospectToken"
+	p, err := a.authenticate(ctx, req.AppID, req.AccessToken)
+	if err != nil {
+		a.logger.Info("token rejected", slog.String("op", op), slog.String("reason", err.Error()))
+		return models.Introspection{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return models.Introspection{
+		User:      ownUser(p.user),
+		AppID:     p.app.ID,
+		SessionID: p.sessionID,
+	}, nil
+}
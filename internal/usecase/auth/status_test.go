@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+)
+
+func TestCheckStatus(t *testing.T) {
+	t.Parallel()
+	strict := models.App{ID: 1}
+	lenient := models.App{ID: 2, AllowUnverifiedLogin: true}
+	tests := []struct {
+		status models.UserStatus
+		app    models.App
+		want   error
+	}{
+		{status: models.StatusActive, app: strict, want: nil},
+		{status: models.StatusPendingVerification, app: strict, want: domain.ErrEmailNotVerified},
+		{status: models.StatusPendingVerification, app: lenient, want: nil},
+		{status: models.StatusInvited, app: lenient, want: domain.ErrInvitationPending},
+		{status: models.StatusDisabled, app: lenient, want: domain.ErrUserDisabled},
+		{status: models.StatusDeleted, app: lenient, want: domain.ErrUserDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := checkStatus(models.User{Status: tt.status}, tt.app); !errors.Is(got, tt.want) {
+				t.Errorf("checkStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if err := checkStatus(models.User{Status: "bogus"}, lenient); err == nil {
+		t.Error("checkStatus() accepted an unknown status")
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/LockMessage/sso/internal/domain"
+	"github.com/LockMessage/sso/internal/domain/models"
+	"github.com/LockMessage/sso/internal/infrastructure/logger/sl"
+)
+
+// SendVerification emails a fresh verification code to the user.
+// Unknown and already verified addresses are silently ignored so the
+// endpoint cannot be used to probe which emails are registered.
+func (a *Auth) SendVerification(ctx context.Context, req models.SendVerificationRequest) error {
+	const op = "auth.SendVerification"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("sending verification code")
+	user, err := a.findByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+			return nil
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.EmailVerified {
+		log.Info("email already verified", slog.Int64("user_id", user.ID))
+		return nil
+	}
+	if err := a.sendVerification(ctx, user); err != nil {
+		log.Error("failed to send verification", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ConfirmEmail redeems a verification code and marks the owner's email as verified.
+func (a *Auth) ConfirmEmail(ctx context.Context, req models.ConfirmEmailRequest) error {
+	const op = "auth.ConfirmEmail"
+	log := a.logger.With(
+		slog.String("op", op),
+	)
+	log.Info("confirming email")
+	token, err := a.consumeCode(ctx, models.PurposeEmailVerification, req.Code)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.usrSaver.SetEmailVerified(ctx, token.UserID); err != nil {
+		log.Error("failed to mark email verified", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	log.Info("email confirmed", slog.Int64("user_id", token.UserID))
+	return nil
+}
+
+func (a *Auth) sendVerification(ctx context.Context, user models.User) error {
+	code, err := a.issueCode(ctx, user.ID, models.PurposeEmailVerification, a.cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	return a.mailer.Send(ctx, models.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body:    "To confirm your email, use this code:\n\n" + a.link("/verify-email", code),
+	})
+}
+
+// issueCode mints a code for purpose and persists its hash.
+func (a *Auth) issueCode(ctx context.Context, userID int64, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	return a.issueCodeWithPayload(ctx, userID, purpose, "", ttl)
+}
+
+// issueCodeWithPayload is issueCode for flows that need to carry data
+// from the request to the redemption of the code.
+func (a *Auth) issueCodeWithPayload(ctx context.Context, userID int64, purpose models.TokenPurpose, payload string, ttl time.Duration) (string, error) {
+	code, hash, err := a.codeIssuer.Issue(purpose)
+	if err != nil {
+		return "", err
+	}
+	_, err = a.tokenStorage.SaveToken(ctx, models.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		Hash:      hash,
+		Payload:   payload,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// consumeCode verifies the signature of code and redeems it exactly once.
+func (a *Auth) consumeCode(ctx context.Context, purpose models.TokenPurpose, code string) (models.OneTimeToken, error) {
+	hash, err := a.codeIssuer.Verify(purpose, code)
+	if err != nil {
+		a.logger.Warn("invalid code signature", sl.Err(err))
+		return models.OneTimeToken{}, domain.ErrInvalidCode
+	}
+	return a.tokenStorage.ConsumeToken(ctx, purpose, hash)
+}
+
+// link renders code as a link under PublicURL, or returns it as is
+// when no public URL is configured.
+func (a *Auth) link(path, code string) string {
+	if a.cfg.PublicURL == "" {
+		return code
+	}
+	return a.cfg.PublicURL + path + "?code=" + url.QueryEscape(code)
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_email_lower;
+DROP INDEX IF EXISTS idx_users_email_canonical;
+DROP TABLE IF EXISTS email_collisions;
+ALTER TABLE users DROP COLUMN email_canonical;
@@ -0,0 +1,58 @@
+-- email_canonical is the identity key of an account: the lowercased email,
+-- with the plus tag stripped on deployments that enable that policy.
+ALTER TABLE users
+    ADD COLUMN email_canonical TEXT;
+
+-- Accounts whose emails only differ by case cannot be merged automatically.
+-- Nor can SQL compute the canonical form of an internationalized domain,
+-- which the service stores in punycode. Both kinds of account are recorded
+-- here for an operator to resolve and are left without a canonical key, so
+-- they stay out of the unique indexes below.
+CREATE TABLE IF NOT EXISTS email_collisions
+(
+    user_id     INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email       TEXT        NOT NULL,
+    canonical   TEXT        NOT NULL,
+    reason      TEXT        NOT NULL DEFAULT 'duplicate' CHECK (reason IN ('duplicate', 'idn_domain')),
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id)
+);
+
+INSERT INTO email_collisions (user_id, email, canonical)
+SELECT id, email, LOWER(TRIM(email))
+FROM users
+WHERE LOWER(TRIM(email)) IN (SELECT LOWER(TRIM(email))
+                             FROM users
+                             GROUP BY LOWER(TRIM(email))
+                             HAVING COUNT(*) > 1);
+
+-- A domain with characters outside ASCII takes more bytes than characters.
+INSERT INTO email_collisions (user_id, email, canonical, reason)
+SELECT id, email, LOWER(TRIM(email)), 'idn_domain'
+FROM users
+WHERE OCTET_LENGTH(SUBSTRING(TRIM(email) FROM '@([^@]*)$')) <> CHAR_LENGTH(SUBSTRING(TRIM(email) FROM '@([^@]*)$'))
+ON CONFLICT (user_id) DO NOTHING;
+
+UPDATE users
+SET email           = LOWER(TRIM(email)),
+    email_canonical = LOWER(TRIM(email))
+WHERE id NOT IN (SELECT user_id FROM email_collisions);
+
+DO
+$$
+    DECLARE
+        collisions INTEGER;
+    BEGIN
+        SELECT COUNT(DISTINCT canonical) INTO collisions FROM email_collisions WHERE reason = 'duplicate';
+        IF collisions > 0 THEN
+            RAISE WARNING '% email addresses are shared by several accounts; see the email_collisions table', collisions;
+        END IF;
+        SELECT COUNT(*) INTO collisions FROM email_collisions WHERE reason = 'idn_domain';
+        IF collisions > 0 THEN
+            RAISE WARNING '% email addresses have an internationalized domain and cannot log in until converted to punycode; see the email_collisions table', collisions;
+        END IF;
+    END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_canonical ON users (email_canonical);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email)) WHERE email_canonical IS NOT NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE users
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+        CHECK (status IN ('active', 'pending_verification', 'disabled', 'deleted'));
+
+UPDATE users
+SET status = CASE
+                 WHEN deleted_at IS NOT NULL THEN 'deleted'
+                 WHEN NOT email_verified THEN 'pending_verification'
+                 ELSE 'active'
+    END;
@@ -0,0 +1,2 @@
+-- Serves the admin listing's email prefix filter (email LIKE 'prefix%').
+CREATE INDEX IF NOT EXISTS idx_users_email_pattern ON users (email text_pattern_ops);
@@ -0,0 +1,3 @@
+-- Imported users keep their legacy hash until their first successful login.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pass_algo TEXT NOT NULL DEFAULT 'bcrypt'
+    CONSTRAINT users_pass_algo_check CHECK (pass_algo IN ('bcrypt', 'pbkdf2-sha256', 'sha1-salted'));
@@ -0,0 +1,5 @@
+DELETE FROM users WHERE status = 'invited';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_status_check;
+ALTER TABLE users
+    ADD CONSTRAINT users_status_check
+        CHECK (status IN ('active', 'pending_verification', 'disabled', 'deleted'));
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS app_memberships
+(
+    user_id    INTEGER     NOT NULL
+        CONSTRAINT app_memberships_user_id_fkey REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER     NOT NULL
+        CONSTRAINT app_memberships_app_id_fkey REFERENCES apps (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, app_id)
+);
+CREATE INDEX IF NOT EXISTS idx_app_memberships_app ON app_memberships (app_id);
+
+-- Every app used to accept every user; keep existing accounts working.
+INSERT INTO app_memberships (user_id, app_id)
+SELECT u.id, a.id
+FROM users u
+         CROSS JOIN apps a
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+ALTER TABLE apps
+    DROP COLUMN IF EXISTS registration_policy,
+    DROP COLUMN IF EXISTS allowed_email_domains;
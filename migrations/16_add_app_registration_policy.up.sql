@@ -0,0 +1,5 @@
+ALTER TABLE apps
+    ADD COLUMN registration_policy   TEXT   NOT NULL DEFAULT 'open'
+        CONSTRAINT apps_registration_policy_check
+            CHECK (registration_policy IN ('open', 'invite_only', 'closed', 'domain')),
+    ADD COLUMN allowed_email_domains TEXT[] NOT NULL DEFAULT '{}';
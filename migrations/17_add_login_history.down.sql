@@ -0,0 +1,11 @@
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+CREATE TRIGGER users_set_updated_at
+    BEFORE UPDATE
+    ON users
+    FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_login_at;
+
+DROP TABLE IF EXISTS login_history;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS login_history
+(
+    id         BIGSERIAL PRIMARY KEY,
+    -- NULL when the login did not match any user.
+    user_id    INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER     NOT NULL,
+    kind       TEXT        NOT NULL CHECK (kind IN ('login', 'refresh')),
+    outcome    TEXT        NOT NULL,
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_login_history_user ON login_history (user_id, id DESC);
+
+ALTER TABLE users
+    ADD COLUMN last_login_at TIMESTAMPTZ;
+
+-- Signing in is not a profile update.
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+CREATE TRIGGER users_set_updated_at
+    BEFORE UPDATE
+    ON users
+    FOR EACH ROW
+    WHEN (OLD.last_login_at IS NOT DISTINCT FROM NEW.last_login_at)
+EXECUTE FUNCTION set_updated_at();
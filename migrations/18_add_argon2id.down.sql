@@ -0,0 +1,8 @@
+-- argon2id hashes cannot be verified once the scheme is gone; those users
+-- have to reset their password.
+UPDATE users SET pass_hash = '', pass_algo = 'bcrypt' WHERE pass_algo = 'argon2id';
+ALTER TABLE users ALTER COLUMN pass_algo SET DEFAULT 'bcrypt';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pass_algo_check;
+ALTER TABLE users
+    ADD CONSTRAINT users_pass_algo_check
+        CHECK (pass_algo IN ('bcrypt', 'pbkdf2-sha256', 'sha1-salted'));
@@ -0,0 +1,6 @@
+-- New passwords are hashed with argon2id; bcrypt hashes are upgraded on login.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_pass_algo_check;
+ALTER TABLE users
+    ADD CONSTRAINT users_pass_algo_check
+        CHECK (pass_algo IN ('argon2id', 'bcrypt', 'pbkdf2-sha256', 'sha1-salted'));
+ALTER TABLE users ALTER COLUMN pass_algo SET DEFAULT 'argon2id';
@@ -0,0 +1,2 @@
+-- Set when a password found in the breach corpus was accepted anyway.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_breached BOOLEAN NOT NULL DEFAULT FALSE;
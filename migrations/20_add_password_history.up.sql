@@ -0,0 +1,10 @@
+-- Hashes users' passwords were replaced from, pruned to password.history_size.
+CREATE TABLE IF NOT EXISTS password_history
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    pass_hash  BYTEA       NOT NULL,
+    pass_algo  TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_user ON password_history (user_id, id DESC);
@@ -0,0 +1,3 @@
+-- Existing passwords count from the migration, so that nobody is forced to
+-- rotate their password as soon as the service is upgraded.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,5 @@
+DELETE FROM login_history WHERE kind = 'mfa';
+ALTER TABLE login_history DROP CONSTRAINT IF EXISTS login_history_kind_check;
+ALTER TABLE login_history ADD CONSTRAINT login_history_kind_check CHECK (kind IN ('login', 'refresh'));
+
+DROP TABLE IF EXISTS user_totp;
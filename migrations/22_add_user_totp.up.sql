@@ -0,0 +1,18 @@
+-- Authenticator app enrollments. secret is encrypted with the MFA key and
+-- only counts as a second factor once confirmed_at is set.
+CREATE TABLE IF NOT EXISTS user_totp
+(
+    user_id      INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret       BYTEA       NOT NULL,
+    -- Time step of the last accepted code; older or equal steps are replays.
+    last_step       BIGINT      NOT NULL DEFAULT 0,
+    -- Wrong codes sent since the last accepted one. Past a limit, VerifyMFA
+    -- refuses codes until some time after the last failure.
+    failed_attempts INTEGER     NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    confirmed_at    TIMESTAMPTZ
+);
+
+ALTER TABLE login_history DROP CONSTRAINT IF EXISTS login_history_kind_check;
+ALTER TABLE login_history ADD CONSTRAINT login_history_kind_check CHECK (kind IN ('login', 'refresh', 'mfa'));
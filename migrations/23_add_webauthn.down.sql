@@ -0,0 +1,6 @@
+DELETE FROM login_history WHERE kind = 'passkey';
+ALTER TABLE login_history DROP CONSTRAINT IF EXISTS login_history_kind_check;
+ALTER TABLE login_history ADD CONSTRAINT login_history_kind_check CHECK (kind IN ('login', 'refresh', 'mfa'));
+
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
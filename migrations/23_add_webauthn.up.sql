@@ -0,0 +1,34 @@
+-- Passkeys. sign_count is the last signature counter seen; an assertion
+-- that does not raise it comes from a cloned authenticator.
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id   BYTEA       NOT NULL UNIQUE,
+    public_key      BYTEA       NOT NULL,
+    sign_count      BIGINT      NOT NULL DEFAULT 0,
+    transports      TEXT[]      NOT NULL DEFAULT '{}',
+    aaguid          BYTEA,
+    backup_eligible BOOLEAN     NOT NULL DEFAULT FALSE,
+    backed_up       BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+-- Challenges of ceremonies between their begin and finish calls. Rows are
+-- deleted when the ceremony finishes; expired ones are swept on insert.
+CREATE TABLE IF NOT EXISTS webauthn_challenges
+(
+    id         UUID PRIMARY KEY,
+    -- NULL for logins, where the passkey tells who the user is.
+    user_id    INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER     NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    ceremony   TEXT        NOT NULL CHECK (ceremony IN ('registration', 'authentication')),
+    challenge  BYTEA       NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges (expires_at);
+
+ALTER TABLE login_history DROP CONSTRAINT IF EXISTS login_history_kind_check;
+ALTER TABLE login_history ADD CONSTRAINT login_history_kind_check CHECK (kind IN ('login', 'refresh', 'mfa', 'passkey'));
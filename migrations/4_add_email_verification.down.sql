@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS one_time_tokens;
+ALTER TABLE apps DROP COLUMN allow_unverified_login;
+ALTER TABLE users DROP COLUMN email_verified;
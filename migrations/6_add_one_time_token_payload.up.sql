@@ -0,0 +1,2 @@
+ALTER TABLE one_time_tokens
+    ADD COLUMN payload TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+ALTER TABLE apps DROP COLUMN profile_claims;
+DROP TRIGGER IF EXISTS users_set_updated_at ON users;
+DROP FUNCTION IF EXISTS set_updated_at();
+ALTER TABLE users
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN avatar_url,
+    DROP COLUMN locale,
+    DROP COLUMN display_name;
@@ -0,0 +1,24 @@
+ALTER TABLE users
+    ADD COLUMN display_name TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN locale       TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url   TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS
+$$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_set_updated_at
+    BEFORE UPDATE
+    ON users
+    FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+-- Apps opt in to receiving the user's name and locale in their tokens.
+ALTER TABLE apps
+    ADD COLUMN profile_claims BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN username TEXT;
+-- Usernames are stored lowercased; the index enforces uniqueness only for users that picked one.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username) WHERE username IS NOT NULL;